@@ -1,32 +1,78 @@
 package main
 
 import (
+	"cmp"
 	"context"
+	"fmt"
+	"net"
 	"os"
 	"os/signal"
+	"strings"
+	"time"
 
 	"github.com/charmbracelet/log"
 
 	"github.com/alecthomas/kong"
 	"github.com/amberpixels/aictx/internal/aictx"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
 )
 
 type CliParams struct {
-	InputPath string `arg:"" default:"." help:"Input directory (or git repo URL) to process"`
-	Local     bool   `short:"l" help:"Treat inputPath arg as a local directory. If inputPath is '.' it is automatically makes local=true." default:"false"` //nolint:lll
+	Dump     DumpCmd     `cmd:"" default:"withargs" help:"Dump the project tree and sources (default command)"`
+	Hotspots HotspotsCmd `cmd:"" help:"Rank files by how much they changed in the git history"`
+	Watch    WatchCmd    `cmd:"" help:"Dump the project, then regenerate the output whenever its files change"`
+	Serve    ServeCmd    `cmd:"" help:"Serve the project tree and sources over an HTTP API"`
+	MCP      MCPCmd      `cmd:"" name:"mcp" help:"Serve the project to agents as a Model Context Protocol server over stdio"`
+	Pick     PickCmd     `cmd:"" help:"Select the files to dump in an interactive tree, then dump them"`
+
+	Local   bool   `short:"l" help:"Treat inputPath arg as a local directory. If inputPath is '.' it is automatically makes local=true." default:"false"`               //nolint:lll
+	GitHost string `help:"Default git host for 'owner/repo' shorthands (may include a scheme, e.g. http://gitea.local:3000)" default:"github.com" env:"AICTX_GIT_HOST"` //nolint:lll
+
+	Git struct {
+		SSHKey             string            `help:"Private key file for SSH remotes (passphrase is prompted or read from $AICTX_SSH_PASSPHRASE)" env:"AICTX_SSH_KEY" type:"path"` //nolint:lll
+		NoCredentialHelper bool              `help:"Do not ask git credential helpers for HTTPS credentials" default:"false"`
+		TokenHost          map[string]string `help:"Send a forge's token (GITLAB_TOKEN, ...) to a self-hosted host, e.g. git.corp.com=gitlab" env:"AICTX_GIT_TOKEN_HOSTS"` //nolint:lll
+	} `embed:"" prefix:"git."`
+
+	Submodules     bool    `help:"Include git submodule contents (cloned in-memory if not initialized)" default:"false"`
+	History        int     `help:"Append a section listing the last N commits for the input path" default:"0"`
+	FileHistory    bool    `help:"Add each file's last commit and author to its header in source mode" default:"false"`
+	Blame          bool    `help:"Prefix source lines with the commit, author and age of their last change" default:"false"`
+	BlameThreshold float64 `help:"Skip blame for files >= threshold (Mb)" default:"0.05"`
+	Order          string  `help:"Order of source files: path, churn (most changed first) or hotspot (churn weighted by size)" enum:"path,churn,hotspot" default:"path"` //nolint:lll
+	Since          string  `help:"Git history window for churn ranking (e.g. 90d, 6mo, 1y, 2024-01-31; empty for all history)" default:"90d"`                            //nolint:lll
+	Rev            string  `help:"Read a local repository at the given revision (branch, tag, commit) without touching the worktree" default:""`                         //nolint:lll
 
 	// Global include/exclude patterns will be applied to both source/tree modes unless overridden.
-	Include string `short:"i" help:"Global include glob pattern (supports comma-separated list)" default:""`
+	Include string `short:"i" help:"Global include glob pattern (supports comma-separated list, path:120-240 and path#Symbol targets)" default:""` //nolint:lll
 	Exclude string `short:"x" help:"Global exclude glob pattern (supports comma-separated list)" default:""`
 
 	Source struct {
 		Disabled   bool    `help:"Disable source mode" default:"false"`
 		Include    string  `help:"Include glob pattern specific for source mode. Global include is used if not specified." default:""` //nolint:lll
 		Exclude    string  `help:"Exclude glob pattern specific for source mode. Global exclude is used if not specified." default:""` //nolint:lll
-		Threshold  float64 `help:"Exclude sources for files >= threshold (Mb)" default:"0.1"`
+		Threshold  float64 `help:"Exclude sources for files >= threshold (Mb), see --oversize" default:"0.1"`
 		ShowHidden bool    `help:"Show hidden files in source mode" default:"false"`
 	} `embed:"" prefix:"source."`
 
+	Oversize     string `help:"Handling of files over the source threshold: skip, truncate (head and tail lines) or outline" enum:"skip,truncate,outline" default:"skip"` //nolint:lll
+	OversizeHead int    `help:"Number of first lines kept when truncating oversized files" default:"100"`
+	OversizeTail int    `help:"Number of last lines kept when truncating oversized files" default:"20"`
+
+	StripComments      bool `help:"Strip comments from sources (Go, JS/TS, Python, Java, C/C++, C#, Rust, Shell, SQL, YAML)" default:"false"` //nolint:lll
+	KeepDocComments    bool `help:"Strip comments but keep doc comments (implies --strip-comments)" default:"false"`
+	CollapseBlankLines bool `help:"Collapse runs of blank lines into a single one" default:"false"`
+	LineNumbers        bool `help:"Prefix source lines with their line numbers" default:"false"`
+
+	NoRedactSecrets bool   `help:"Disable redaction of secrets (API keys, private keys, tokens, .env values) in sources" default:"false"` //nolint:lll
+	FailOnSecrets   bool   `help:"Exit with an error if secrets were redacted (for CI)" default:"false"`
+	MaskPII         bool   `help:"Mask emails, phone numbers, IPs and IBANs with stable placeholders (detectors and files can be set in the config)" default:"false"` //nolint:lll
+	Config          string `help:"User config file (redaction rules, ...). Defaults to $XDG_CONFIG_HOME/aictx/config.yaml" default:""`                                //nolint:lll
+
+	Skeleton bool   `help:"Reduce Go files to declarations and exported signatures with bodies elided" default:"false"`
+	Outline  string `help:"Glob pattern of files reduced to declarations and signatures, e.g. *.ts,*.py (supports comma-separated list)" default:""` //nolint:lll
+	Full     string `help:"Glob pattern of files kept complete in skeleton and outline modes (supports comma-separated list)" default:""`            //nolint:lll
+
 	Tree struct {
 		Disabled   bool   `help:"Disable tree mode" default:"false"`
 		Include    string `help:"Include glob pattern specific for tree mode. Global include is used if not specified." default:""` //nolint:lll
@@ -34,8 +80,14 @@ type CliParams struct {
 		ShowHidden bool   `help:"Show hidden files in tree mode" default:"false"`
 	} `embed:"" prefix:"tree."`
 
-	Out string `short:"o" help:"Output destination file (\"stdout\" for stdout)" default:"output.txt"`
+	Out           string  `short:"o" help:"Output destination file (\"stdout\" for stdout). Defaults to output.txt, or stdout for hotspots" default:""` //nolint:lll
+	MaxOutputSize float64 `help:"Stop the output cleanly once it reaches this size (Mb, 0 for no limit)" default:"0"`
+
+	Incremental bool   `help:"Cache file hashes and renderings between runs, re-reading only changed files" default:"false"`                           //nolint:lll
+	OnlyChanged bool   `name:"only-changed-since-last-run" help:"Only output the source files changed since the last incremental run" default:"false"` //nolint:lll
+	CacheDir    string `help:"Directory of the incremental cache. Defaults to $XDG_CACHE_HOME/aictx" default:""`
 
+	Jobs            int  `short:"j" help:"Number of files read and rendered concurrently (0 for the number of CPUs)" default:"0"` //nolint:lll
 	Verbose         bool `short:"v" help:"Verbose mode" default:"false"`
 	Raw             bool `short:"r" help:"Concatenate file contents in raw mode without headers or summary" default:"false"` //nolint:lll
 	ListCoreIgnores bool `short:"L" help:"List core ignore patterns and exit" default:"false"`
@@ -43,6 +95,54 @@ type CliParams struct {
 	NoGitIgnore     bool `help:"Disable respecting .gitignore file" default:"false"`
 }
 
+// DumpCmd dumps the project tree and sources.
+type DumpCmd struct {
+	InputPath string   `arg:"" default:"." help:"Input directory (or git repo URL) to process"`
+	Targets   []string `arg:"" optional:"" help:"File slices to output: path:120-240 (line range) or path#Symbol (declaration)"` //nolint:lll
+}
+
+// HotspotsCmd ranks the project files by their git churn.
+type HotspotsCmd struct {
+	InputPath string `arg:"" default:"." help:"Input directory (or git repo URL) to process"`
+	Top       int    `help:"Number of files to list (0 for all)" default:"20"`
+}
+
+// WatchCmd regenerates the dump whenever files under the input change.
+type WatchCmd struct {
+	InputPath string        `arg:"" default:"." help:"Input directory to watch"`
+	Debounce  time.Duration `help:"Wait for changes to settle for this long before regenerating" default:"300ms"`
+}
+
+// ServeCmd serves the project tree and sources over HTTP.
+type ServeCmd struct {
+	InputPath string `arg:"" default:"." help:"Input directory to serve (requests can't access files outside of it)"`
+	Addr      string `help:"Address to listen on" default:"127.0.0.1:7777"`
+	// There is no authentication: other interfaces expose the project to the network.
+	AllowRemote bool `help:"Allow listening on non-loopback addresses (there is no authentication)" default:"false"`
+}
+
+// Validate rejects non-loopback addresses unless --allow-remote is set.
+func (c *ServeCmd) Validate() error {
+	host, _, err := net.SplitHostPort(c.Addr)
+	if err != nil {
+		return fmt.Errorf("invalid address %q: %w", c.Addr, err)
+	}
+	if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) && !c.AllowRemote {
+		return fmt.Errorf("%q is reachable from other hosts, without authentication: use --allow-remote", c.Addr)
+	}
+	return nil
+}
+
+// MCPCmd serves the project over the Model Context Protocol.
+type MCPCmd struct {
+	InputPath string `arg:"" default:"." help:"Input directory to serve (tools can't access files outside of it)"`
+}
+
+// PickCmd dumps the files selected in an interactive tree.
+type PickCmd struct {
+	InputPath string `arg:"" default:"." help:"Input directory to pick files from"`
+}
+
 func main() {
 	var cli CliParams
 	// Parse CLI arguments using Kong.
@@ -61,11 +161,41 @@ func main() {
 		return
 	}
 
+	configPath := cli.Config
+	if configPath == "" {
+		// The user config is optional: without a config dir, there is none.
+		configPath, _ = aictx.UserConfigPath()
+	}
+	var cfg *aictx.Config
+	if configPath != "" {
+		var err error
+		cfg, err = aictx.LoadConfig(configPath)
+		kctx.FatalIfErrorf(err)
+	}
+
 	app := &aictx.App{
 		Lgr: logger,
 
-		InputPath: cli.InputPath,
+		InputPath: cli.Dump.InputPath,
+		Targets:   cli.Dump.Targets,
 		Local:     cli.Local,
+		GitHost:   cli.GitHost,
+		GitAuth: aictx.GitAuthOptions{
+			SSHKeyPath:         cli.Git.SSHKey,
+			NoCredentialHelper: cli.Git.NoCredentialHelper,
+			TokenHosts:         cli.Git.TokenHost,
+		},
+		Submodules: cli.Submodules,
+		Rev:        cli.Rev,
+
+		History:     cli.History,
+		FileHistory: cli.FileHistory,
+
+		Blame:          cli.Blame,
+		BlameThreshold: cli.BlameThreshold,
+
+		Order: cli.Order,
+		Since: cli.Since,
 
 		// Global include/exclude patterns.
 		Include: cli.Include,
@@ -78,33 +208,108 @@ func main() {
 		SourceThreshold:  cli.Source.Threshold,
 		SourceShowHidden: cli.Source.ShowHidden,
 
+		Oversize:     cli.Oversize,
+		OversizeHead: cli.OversizeHead,
+		OversizeTail: cli.OversizeTail,
+
+		StripComments:      cli.StripComments,
+		KeepDocComments:    cli.KeepDocComments,
+		CollapseBlankLines: cli.CollapseBlankLines,
+		LineNumbers:        cli.LineNumbers,
+
+		NoRedactSecrets: cli.NoRedactSecrets,
+		FailOnSecrets:   cli.FailOnSecrets,
+		MaskPII:         cli.MaskPII,
+		Config:          cfg,
+
+		Skeleton: cli.Skeleton,
+		Outline:  cli.Outline,
+		Full:     cli.Full,
+
 		TreeEnabled:    !cli.Tree.Disabled,
 		TreeInclude:    cli.Tree.Include,
 		TreeExclude:    cli.Tree.Exclude,
 		TreeShowHidden: cli.Tree.ShowHidden,
 
-		Raw:     cli.Raw,
-		Verbose: cli.Verbose,
+		Raw:           cli.Raw,
+		Jobs:          cli.Jobs,
+		MaxOutputSize: cli.MaxOutputSize,
+		Verbose:       cli.Verbose,
+
+		Incremental: cli.Incremental,
+		OnlyChanged: cli.OnlyChanged,
+		CacheDir:    cli.CacheDir,
 
 		NoCoreIgnores: cli.NoCoreIgnores,
 		NoGitIgnore:   cli.NoGitIgnore,
 	}
 
-	if cli.Out == "stdout" || cli.Out == "std" || cli.Out == "-" {
+	hotspots := strings.HasPrefix(kctx.Command(), "hotspots")
+	if hotspots {
+		app.InputPath = cli.Hotspots.InputPath
+	}
+	watch := strings.HasPrefix(kctx.Command(), "watch")
+	if watch {
+		app.InputPath = cli.Watch.InputPath
+	}
+	// When serving, responses are the output: a previous dump to the output file is only excluded.
+	if strings.HasPrefix(kctx.Command(), "serve") {
+		app.InputPath, app.OutFilename = cli.Serve.InputPath, cmp.Or(cli.Out, "output.txt")
+		kctx.FatalIfErrorf(app.Serve(ctx, cli.Serve.Addr))
+		return
+	}
+	if strings.HasPrefix(kctx.Command(), "mcp") {
+		// Stdout is the transport: logs go to stderr.
+		app.InputPath, app.OutFilename = cli.MCP.InputPath, cmp.Or(cli.Out, "output.txt")
+		kctx.FatalIfErrorf(app.ServeMCP(ctx, &mcp.StdioTransport{}))
+		return
+	}
+
+	if strings.HasPrefix(kctx.Command(), "pick") {
+		// The picker is drawn on stderr, so the output can go to stdout. The output file
+		// is only created once the selection is confirmed, and a previous dump isn't offered.
+		app.InputPath, app.OutFilename = cli.Pick.InputPath, cmp.Or(cli.Out, "output.txt")
+		picked, err := app.Pick(ctx, os.Stdin, os.Stderr)
+		kctx.FatalIfErrorf(err)
+		if !picked {
+			return
+		}
+	}
+
+	out := cli.Out
+	if out == "" {
+		out = "output.txt"
+		if hotspots {
+			out = "stdout"
+		}
+	}
+
+	if out == "stdout" || cli.Out == "std" || cli.Out == "-" {
 		app.Out = os.Stdout
 		// If we output to stdout we need to disable the verbose mode
 		app.Verbose = false
+	} else if watch {
+		// The output file is replaced on each regeneration.
+		app.OutFilename = out
 	} else {
-		f, err := os.Create(cli.Out)
+		f, err := os.Create(out)
 		if err != nil {
-			log.Printf("Error creating output file '%s': %v", cli.Out, err)
+			log.Printf("Error creating output file '%s': %v", out, err)
 			return
 		}
 		defer f.Close()
 		app.Out = f
-		app.OutFilename = cli.Out
+		app.OutFilename = out
 	}
 
-	err := app.Run(ctx)
+	var err error
+	switch {
+	case hotspots:
+		err = app.RunHotspots(ctx, cli.Hotspots.Top)
+	case watch:
+		err = app.Watch(ctx, cli.Watch.Debounce)
+	default:
+		err = app.Run(ctx)
+	}
 	kctx.FatalIfErrorf(err)
 }
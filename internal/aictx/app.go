@@ -10,6 +10,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/charmbracelet/log"
 	"github.com/yarlson/pin"
@@ -30,9 +31,48 @@ type App struct {
 	// Local, when true, forces the input to be treated as a local directory.
 	Local bool
 
+	// GitHost is the host used for bare "owner/repo" shorthands (DefaultGitHost if empty).
+	GitHost string
+
+	// GitAuth configures how credentials for private repositories are resolved.
+	GitAuth GitAuthOptions
+
+	// Submodules, when true, includes the contents of git submodules under their paths.
+	Submodules bool
+
+	// History is the number of recent commits (for the input path) to list
+	// in a history section after the output. Zero disables the section.
+	History int
+
+	// FileHistory, when true, adds the last commit modifying each file to its header.
+	FileHistory bool
+
+	// Blame, when true, prefixes the lines of each file with the commit, author and age
+	// of their last change.
+	Blame bool
+
+	// BlameThreshold is the maximum file size (in MB) annotated with blame.
+	BlameThreshold float64
+
+	// Order is the order of files in source output: OrderPath (default), OrderChurn or OrderHotspot.
+	Order string
+
+	// Since is the git history window used for churn ranking ("90d", "6mo", "2024-01-31").
+	// Empty means the whole history.
+	Since string
+
+	// Rev, when set, reads a local repository at the given revision (branch, tag or commit)
+	// instead of the worktree, without touching it.
+	Rev string
+
 	// Include is an optional global glob pattern to include files (supports comma-separated lists).
+	// Patterns can be targets selecting a slice of a file (see Targets).
 	Include string
 
+	// Targets are slices of files to emit: line ranges ("app.go:120-240") or declarations
+	// ("app.go#App.Run"). They are added to the global include.
+	Targets []string
+
 	// Exclude is an optional global glob pattern to exclude files (supports comma-separated lists).
 	Exclude string
 
@@ -68,6 +108,52 @@ type App struct {
 	// SourceThreshold is the maximum file size (in MB) allowed for source output.
 	SourceThreshold float64
 
+	// Oversize is how files exceeding SourceThreshold are handled: OversizeSkip (default),
+	// OversizeTruncate or OversizeOutline.
+	Oversize string
+
+	// OversizeHead and OversizeTail are the numbers of first and last lines kept
+	// when oversized files are truncated.
+	OversizeHead, OversizeTail int
+
+	// StripComments removes comments from the source of supported languages.
+	StripComments bool
+
+	// KeepDocComments removes comments like StripComments, but keeps the doc comments
+	// (Go declaration comments, /** */ blocks, Rust ///, Python docstrings).
+	KeepDocComments bool
+
+	// CollapseBlankLines replaces runs of blank lines with a single one.
+	CollapseBlankLines bool
+
+	// LineNumbers, when true, prefixes each source line with its right-aligned line number.
+	LineNumbers bool
+
+	// Skeleton, when true, reduces Go files to their package clause, imports, declarations
+	// and exported signatures (with doc comments), eliding function bodies.
+	Skeleton bool
+
+	// Outline is a glob pattern (supports comma-separated lists) of files reduced to their outline
+	// (declarations and signatures) by the Outliner registered for their extension.
+	Outline string
+
+	// Full is a glob pattern (supports comma-separated lists) of files kept complete
+	// in skeleton and outline modes.
+	Full string
+
+	// NoRedactSecrets disables the redaction of secrets (API keys, private keys, tokens, ...)
+	// in source output.
+	NoRedactSecrets bool
+
+	// FailOnSecrets makes Run fail with ErrSecretsFound if any secret was redacted.
+	FailOnSecrets bool
+
+	// Config is the user configuration. The project's ProjectConfigFile is merged into it.
+	Config *Config
+
+	// MaskPII enables all the PII detectors (PIIDetectors) unless the configuration lists them.
+	MaskPII bool
+
 	// Out is the destination writer where output will be written.
 	Out io.Writer
 
@@ -86,8 +172,61 @@ type App struct {
 	// Raw, when true, concatenates file contents in source mode without headers or summary.
 	Raw bool
 
+	// Jobs is the number of files read and rendered concurrently (the number of CPUs if <= 0).
+	Jobs int
+
+	// Incremental, when true, caches the state and rendering of source files (see CacheDir),
+	// so unchanged files are not read and transformed again by later runs.
+	Incremental bool
+
+	// OnlyChanged, when true, only outputs the source files changed since the last
+	// incremental run, and lists the removed ones. It implies Incremental.
+	OnlyChanged bool
+
+	// CacheDir is the directory of the incremental cache ($XDG_CACHE_HOME/aictx if empty).
+	CacheDir string
+
+	// MaxOutputSize is the maximum size of the output (in MB). The output stops at the last
+	// complete line within the limit, followed by a truncation note. Zero disables the limit.
+	MaxOutputSize float64
+
 	// Verbose, when true, prints verbose output.
 	Verbose bool
+
+	// git is the repository backing the processed filesystem (if needed and available).
+	git *repoContext
+
+	// targets are the targets parsed from Targets and the include patterns.
+	targets []target
+
+	// targetPaths are the include patterns standing for the files of targets (of all includes).
+	targetPaths map[string]bool
+
+	// projectInclude are the include patterns picked (see Pick) or of the config (see Config.Include),
+	// used when no include pattern is set. They are relative to the input directory.
+	projectInclude string
+	// picked are the include patterns picked (see Pick), used instead of those of the config.
+	picked string
+
+	// secrets are the secrets redacted from the output.
+	secrets []secretFinding
+
+	// maskRules are the user-defined and PII masking rules.
+	maskRules []maskRule
+
+	// cache is the cache of incremental runs.
+	cache *fileCache
+
+	// realRoot, when set, is the directory (with symlinks resolved) files are read from:
+	// symlinks resolving outside of it are skipped. Set by servers.
+	realRoot string
+	// pathBase, when set, is the directory the paths of the output are relative to. Set by servers.
+	pathBase string
+
+	// maskPlaceholders maps masked values (by kind) to their placeholders,
+	// and maskCounts counts the unique values of each kind.
+	maskPlaceholders map[string]string
+	maskCounts       map[string]int
 }
 
 // Run executes the main application logic.
@@ -99,78 +238,133 @@ func (a *App) Run(ctx context.Context) error {
 		return errors.New("at least one of tree or source mode must be enabled")
 	}
 
-	p := pin.New(".",
-		pin.WithSpinnerColor(pin.ColorMagenta),
-		pin.WithTextColor(pin.ColorYellow),
-	)
-	var pCancel context.CancelFunc
+	p := newSpinner()
+	fsys, info, err := a.prepare(ctx, p)
+	if err != nil {
+		return err
+	}
 
-	var fsys billy.Filesystem
-	//nolint:nestif // we're OK with this
-	if a.InputPath == "." || a.Local {
-		// Use OS filesystem.
-		root := "."
-		if strings.HasPrefix(a.InputPath, "/") {
-			root = "/"
-		}
-		fsys = osfs.New(root)
-		a.Local = true
+	// The input is walked once for both modes.
+	root, err := a.walk(ctx, fsys, a.InputPath, info)
+	if err != nil {
+		return fmt.Errorf("error filtering files: %w", err)
+	}
 
-		absPath, _ := filepath.Abs(a.InputPath)
-		if absPath == "" {
-			absPath = "."
+	if a.SourceEnabled && (a.Incremental || a.OnlyChanged) {
+		if a.cache, err = a.openCache(); err != nil {
+			return fmt.Errorf("error opening cache: %w", err)
 		}
+	}
 
-		if a.Verbose {
-			p.UpdateMessage("Loading local path...")
-			pCancel = p.Start(ctx)
-			defer pCancel()
+	out := &limitWriter{w: a.Out, limit: int64(a.MaxOutputSize * MB)}
 
-			p.Stop(fmt.Sprintf(`Loaded local path "%s"`, absPath))
+	if a.TreeEnabled {
+		if err := a.displayTree(ctx, fsys, root, out, p); err != nil {
+			return err
 		}
-	} else {
-		// Treat inputPath as a Git repository URL.
-		repoURL, branch, err := ValidateGitRepoName(a.InputPath)
-		if err != nil {
-			return fmt.Errorf("invalid git repository URL[%s]: %w", a.InputPath, err)
+	}
+
+	if a.SourceEnabled && !out.exceeded {
+		if a.TreeEnabled {
+			// let's have an empty line between tree and source
+			fmt.Fprintln(out)
+		}
+		if err := a.displaySource(ctx, fsys, root, out, p); err != nil && !errors.Is(err, errOutputLimit) {
+			return err
 		}
+	}
 
-		strRepoURL := repoURL
-		if branch != "" {
-			strRepoURL = strRepoURL + " (branch " + branch + ")"
+	if a.History > 0 && a.git != nil && !out.exceeded {
+		if a.TreeEnabled || a.SourceEnabled {
+			fmt.Fprintln(out)
+		}
+		repoPath, _ := a.git.repoPath(a.InputPath)
+		if err := a.git.printHistory(out, repoPath, a.History); err != nil && !errors.Is(err, errOutputLimit) {
+			return err
 		}
+	}
 
-		if a.Verbose {
-			p.UpdateMessage(fmt.Sprintf("Cloning %s...", strRepoURL))
-			pCancel = p.Start(ctx)
-			defer pCancel()
+	// A truncated output left files out: they must still count as changed on the next run.
+	if a.cache != nil && a.cache.current != nil && !out.exceeded {
+		if err := a.cache.save(); err != nil {
+			a.logger().Warnf("Failed to save the cache: %s", err)
 		}
+	}
 
-		gitFS, err := ReadGit(repoURL, branch)
-		if err != nil {
-			p.Stop(fmt.Sprintf("Failed on cloning %s", strRepoURL))
-			return fmt.Errorf("failed to load git repo: %w", err)
+	if out.exceeded {
+		a.logger().Warnf("Output truncated: exceeds the maximum output size of %s", formatSize(out.limit))
+		fmt.Fprintln(a.Out, truncationNote(out.limit))
+	}
+
+	if a.Verbose {
+		// The output file is always written to the local disk, whatever fsys is.
+		if f, err := os.Stat(a.OutFilename); err == nil {
+			cancel := p.Start(ctx)
+			p.Stop(fmt.Sprintf(
+				"Dumped to file %s (%s)",
+				f.Name(), formatSize(f.Size()),
+			))
+			cancel()
 		}
-		fsys = gitFS
+	}
+
+	if a.FailOnSecrets && len(a.secrets) > 0 {
+		return fmt.Errorf("%w: %d secret(s) redacted from the output", ErrSecretsFound, len(a.secrets))
+	}
+
+	return nil
+}
+
+// newSpinner creates the progress spinner used in verbose mode.
+func newSpinner() *pin.Pin {
+	return pin.New(".",
+		pin.WithSpinnerColor(pin.ColorMagenta),
+		pin.WithTextColor(pin.ColorYellow),
+	)
+}
 
-		// Reset input path to root.
-		a.InputPath = "."
+// prepare loads the filesystem for the input (local or cloned) and the ignore patterns.
+// It returns the filesystem and the info of the input path within it.
+func (a *App) prepare(ctx context.Context, p *pin.Pin) (billy.Filesystem, os.FileInfo, error) {
+	if err := a.checkOptions(); err != nil {
+		return nil, nil, err
+	}
+	if err := a.prepareTargets(); err != nil {
+		return nil, nil, err
+	}
 
-		if a.Verbose {
-			p.Stop(fmt.Sprintf("Cloned %s", strRepoURL))
+	// Existing local directories are processed in place, unless they are bare
+	// repositories (which have no worktree and have to be cloned).
+	if isLocalRepoPath(a.InputPath) && !isBareRepo(expandHome(a.InputPath)) {
+		if info, err := os.Stat(expandHome(a.InputPath)); err == nil && info.IsDir() {
+			a.InputPath = expandHome(a.InputPath)
+			a.Local = true
 		}
 	}
 
+	var (
+		fsys billy.Filesystem
+		err  error
+	)
+	if a.InputPath == "." || a.Local {
+		fsys, err = a.loadLocal(ctx, p)
+	} else {
+		fsys, err = a.loadRemote(ctx, p)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
 	info, err := fsys.Stat(a.InputPath)
 	if err != nil {
-		return fmt.Errorf("failed to access input path '%s': %w", a.InputPath, err)
+		return nil, nil, fmt.Errorf("failed to access input path '%s': %w", a.InputPath, err)
 	}
 
 	// If the input is a directory, attempt to load .aictxignore.
 	if info.IsDir() {
 		ignorePatterns, err := loadDotIgnoreFromFS(fsys, ".aictxignore", a.InputPath)
 		if err != nil {
-			return fmt.Errorf("error reading .aictxignore: %w", err)
+			return nil, nil, fmt.Errorf("error reading .aictxignore: %w", err)
 		}
 		a.AictxIgnore = ignorePatterns
 
@@ -178,49 +372,246 @@ func (a *App) Run(ctx context.Context) error {
 		if !a.NoGitIgnore {
 			gitIgnorePatterns, err := loadDotIgnoreFromFS(fsys, ".gitignore", a.InputPath)
 			if err != nil {
-				return fmt.Errorf("error reading .gitignore: %w", err)
+				return nil, nil, fmt.Errorf("error reading .gitignore: %w", err)
 			}
 			a.AictxIgnore = append(a.AictxIgnore, gitIgnorePatterns...)
 		}
 	}
 
-	if a.TreeEnabled {
-		if err := a.displayTree(ctx, fsys, info, a.Out, p); err != nil {
-			return err
+	cfg := &Config{}
+	if a.Config != nil {
+		cfg.merge(a.Config)
+	}
+	if info.IsDir() {
+		projectCfg, err := loadProjectConfig(fsys, a.InputPath)
+		if err != nil {
+			return nil, nil, err
+		}
+		cfg.merge(projectCfg)
+	}
+	if a.maskRules, err = buildMaskRules(cfg, a.MaskPII); err != nil {
+		return nil, nil, err
+	}
+	a.projectInclude = ""
+	switch {
+	case a.Include != "" || a.SourceInclude != "" || a.TreeInclude != "":
+		// Include patterns (and targets) given to the app replace the saved ones.
+	case a.picked != "":
+		a.projectInclude = a.picked
+	case len(cfg.Include) > 0:
+		patterns, targets, err := splitTargets(strings.Join(cfg.Include, ","))
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid include of %s: %w", ProjectConfigFile, err)
 		}
+		a.projectInclude = patterns
+		a.targets = append(a.targets, targets...)
+		a.addTargetPaths(targets)
+		a.logger().Infof("Including only %s, as selected in %s (--include overrides it)",
+			strings.Join(cfg.Include, ", "), ProjectConfigFile)
 	}
 
-	if a.SourceEnabled {
-		if a.TreeEnabled {
-			// let's have an empty line between tree and source
-			fmt.Fprintln(a.Out)
+	return fsys, info, nil
+}
+
+// checkOptions validates the options taking one of a set of values.
+func (a *App) checkOptions() error {
+	switch a.Order {
+	case "", OrderPath, OrderChurn, OrderHotspot:
+	default:
+		return fmt.Errorf("unknown order %q (expected %s, %s or %s)", a.Order, OrderPath, OrderChurn, OrderHotspot)
+	}
+	switch a.Oversize {
+	case "", OversizeSkip, OversizeTruncate, OversizeOutline:
+	default:
+		return fmt.Errorf("unknown oversize mode %q (expected %s, %s or %s)",
+			a.Oversize, OversizeSkip, OversizeTruncate, OversizeOutline)
+	}
+	return nil
+}
+
+// RunHotspots writes the table of the n files (all if n <= 0) changed the most in the
+// git history window (Since), ranked by Order (churn if unset or "path").
+func (a *App) RunHotspots(ctx context.Context, n int) error {
+	if a.Order == "" || a.Order == OrderPath {
+		a.Order = OrderChurn
+	}
+
+	fsys, info, err := a.prepare(ctx, newSpinner())
+	if err != nil {
+		return err
+	}
+	if a.git == nil {
+		return errors.New("hotspots require a git repository")
+	}
+
+	var root *TreeNode
+	if info.IsDir() {
+		walked, err := a.walk(ctx, fsys, a.InputPath, info)
+		if err != nil {
+			return fmt.Errorf("error filtering files: %w", err)
 		}
-		if err := a.displaySource(ctx, fsys, info, a.Out, p); err != nil {
-			return err
+		root = walked.treeRoot()
+	} else {
+		root = &TreeNode{Name: filepath.Base(a.InputPath), Path: a.InputPath, Size: info.Size()}
+	}
+
+	since, err := ParseSince(a.Since, time.Now())
+	if err != nil {
+		return err
+	}
+	if err := a.git.annotateChurn(root, since); err != nil {
+		return err
+	}
+
+	var files []*TreeNode
+	root.walkFiles(func(node *TreeNode) { files = append(files, node) })
+	printHotspots(a.Out, files, a.Order, n, a.Since)
+	return nil
+}
+
+// loadLocal returns the filesystem for a local input path.
+func (a *App) loadLocal(ctx context.Context, p *pin.Pin) (billy.Filesystem, error) {
+	// Use OS filesystem.
+	root := "."
+	if strings.HasPrefix(a.InputPath, "/") {
+		root = "/"
+	}
+	var fsys billy.Filesystem = osfs.New(root)
+	a.Local = true
+	localPath := a.InputPath
+
+	if a.Rev != "" {
+		if a.Submodules {
+			return nil, errors.New("--submodules can't be combined with --rev")
+		}
+		var err error
+		if fsys, a.InputPath, err = OpenLocalRevision(a.InputPath, a.Rev); err != nil {
+			return nil, err
+		}
+	}
+
+	if a.Submodules {
+		var err error
+		if fsys, err = MountLocalSubmodules(ctx, fsys, root, a.InputPath, a.GitAuth); err != nil {
+			return nil, fmt.Errorf("failed to load git submodules: %w", err)
+		}
+	}
+
+	if a.needsGit() {
+		if err := a.openLocalGit(localPath); err != nil {
+			a.logger().Warnf("Git history is not available: %s", err)
 		}
 	}
 
+	absPath, _ := filepath.Abs(localPath)
+	if absPath == "" {
+		absPath = "."
+	}
+
 	if a.Verbose {
-		cancel := p.Start(ctx)
-		f, _ := fsys.Stat(a.OutFilename)
-		p.Stop(fmt.Sprintf(
-			"Dumped to file %s (%s)",
-			f.Name(), formatSize(f.Size()),
-		))
-		cancel()
+		p.UpdateMessage("Loading local path...")
+		pCancel := p.Start(ctx)
+		defer pCancel()
+
+		if a.Rev != "" {
+			absPath += " at " + a.Rev
+		}
+		p.Stop(fmt.Sprintf(`Loaded local path "%s"`, absPath))
 	}
 
-	return nil
+	return fsys, nil
+}
+
+// openLocalGit opens the git repository containing the local input path for history features.
+func (a *App) openLocalGit(localPath string) error {
+	r, wtRoot, err := openLocalRepo(localPath)
+	if err != nil {
+		return err
+	}
+	// With --rev the filesystem is rooted at the repository root.
+	if a.Rev != "" {
+		wtRoot = ""
+	}
+	a.git, err = newRepoContext(r, wtRoot, a.Rev)
+	return err
+}
+
+// loadRemote clones the git repository given as input path into memory
+// and returns its filesystem.
+func (a *App) loadRemote(ctx context.Context, p *pin.Pin) (billy.Filesystem, error) {
+	if a.Rev != "" {
+		return nil, errors.New("--rev is only supported for local inputs (use <repo>@<branch> for remote ones)")
+	}
+
+	// Treat inputPath as a Git repository URL.
+	repo, err := ParseGitRepo(a.InputPath, cmp.Or(a.GitHost, DefaultGitHost))
+	if err != nil {
+		return nil, fmt.Errorf("invalid git repository URL[%s]: %w", a.InputPath, err)
+	}
+
+	strRepoURL := repo.URL
+	if repo.Branch != "" {
+		strRepoURL = strRepoURL + " (branch " + repo.Branch + ")"
+	}
+
+	// Resolve credentials before the spinner starts, as it may prompt for a passphrase.
+	authOpts := a.GitAuth.forRepo(repo.URL)
+	auth, err := ResolveGitAuth(ctx, repo, authOpts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve git credentials for %s: %w", repo.URL, err)
+	}
+
+	if a.Verbose {
+		p.UpdateMessage(fmt.Sprintf("Cloning %s...", strRepoURL))
+		pCancel := p.Start(ctx)
+		defer pCancel()
+	}
+
+	r, gitFS, err := cloneGit(ctx, repo, ReadGitOptions{
+		Auth: auth, Submodules: a.Submodules, SubmoduleAuth: authOpts,
+	})
+	if err != nil {
+		p.Stop(fmt.Sprintf("Failed on cloning %s", strRepoURL))
+		return nil, fmt.Errorf("failed to load git repo: %w", err)
+	}
+
+	if a.needsGit() {
+		if a.git, err = newRepoContext(r, "", ""); err != nil {
+			return nil, err
+		}
+	}
+
+	// Reset input path to the repository root or the requested subdirectory.
+	a.InputPath = cmp.Or(repo.Subdir, ".")
+
+	if a.Verbose {
+		p.Stop(fmt.Sprintf("Cloned %s", strRepoURL))
+	}
+
+	return gitFS, nil
+}
+
+// needsGit returns true if any of the enabled features requires access to the git repository.
+func (a *App) needsGit() bool {
+	return a.History > 0 || a.FileHistory || a.Blame || (a.Order != "" && a.Order != OrderPath)
+}
+
+// logger returns the configured logger, or the default one.
+func (a *App) logger() *log.Logger {
+	if a.Lgr != nil {
+		return a.Lgr
+	}
+	return log.Default()
 }
 
-// displayTree processes tree mode: it prints a filtered directory tree.
-// In this updated version, we first build a filtered tree structure, then
-// print a summary line, and finally print the tree structure.
-func (a *App) displayTree(ctx context.Context, fsys billy.Filesystem, info os.FileInfo, w io.Writer, p *pin.Pin) error {
+// displayTree processes tree mode: it prints the directory tree of the walked input.
+// It first classifies the files of the tree, then prints a summary line,
+// and finally prints the tree structure.
+func (a *App) displayTree(ctx context.Context, fsys billy.Filesystem, root *walkNode, w io.Writer, p *pin.Pin) error {
 	// If input is not a directory, simply print it if allowed.
-	if !info.IsDir() {
-		if a.isAllowed(a.InputPath, false) {
-			fmt.Fprintln(w, filepath.Base(a.InputPath))
+	if !root.isDir {
+		if root.inTree {
+			fmt.Fprintln(w, root.name)
 		}
 		return nil
 	}
@@ -239,22 +630,21 @@ func (a *App) displayTree(ctx context.Context, fsys billy.Filesystem, info os.Fi
 		}()
 	}
 
-	// Build the filtered tree structure.
-	rootNode, err := a.filterTree(ctx, fsys, a.InputPath)
-	if err != nil {
-		if errors.Is(err, ErrFilterSkipped) {
-			// nothing to show
-			return nil
-		}
-		return fmt.Errorf("error filtering tree: %w", err)
+	if err := a.classify(ctx, fsys, root); err != nil {
+		return fmt.Errorf("error reading files: %w", err)
 	}
+	rootNode := root.treeRoot()
 
 	// Compute summary.
 	s = rootNode.summary()
 	// Format the summary concisely.
+	legend := "* - for binary files"
+	if rootNode.hasLFS() {
+		legend += ", (LFS) - for Git LFS pointers"
+	}
 	summaryStr := fmt.Sprintf(
-		"Project Tree [%d files, %s total, max %s] (* - for binary files)",
-		s.fileCount, formatSize(s.totalSize), formatSize(s.maxSize),
+		"Project Tree [%d files, %s total, max %s] (%s)",
+		s.fileCount, formatSize(s.totalSize), formatSize(s.maxSize), legend,
 	)
 
 	// Print the root node with the summary appended.
@@ -265,152 +655,85 @@ func (a *App) displayTree(ctx context.Context, fsys billy.Filesystem, info os.Fi
 	return nil
 }
 
-// displaySource processes source mode: it builds a filtered tree of source files,
+// displaySource processes source mode: it builds the tree of source files from the walked input,
 // computes a summary, prints the summary, and then prints the content of each file.
-func (a *App) displaySource(ctx context.Context, fs billy.Filesystem, info os.FileInfo, w io.Writer, p *pin.Pin) error {
-	var rootNode *TreeNode
-	var err error
-
+func (a *App) displaySource(ctx context.Context, fs billy.Filesystem, root *walkNode, w io.Writer, p *pin.Pin) error {
 	var s summary
+	var files []*TreeNode
 	if a.Verbose {
 		p.UpdateMessage("Concatenating source files...")
 		cancel := p.Start(ctx)
 		defer func() {
 			cancel()
+			tokens := ""
+			if a.cache != nil {
+				tokens = fmt.Sprintf(", ~%d tokens", a.cache.tokens(files))
+			}
 			p.Stop(fmt.Sprintf(
-				"Concatenated source of %d files (%s)",
-				s.fileCount, formatSize(s.totalSize),
+				"Concatenated source of %d files (%s%s)",
+				s.fileCount, formatSize(s.totalSize), tokens,
 			))
 		}()
 	}
 
-	// If the input is a file, process it directly.
-	if !info.IsDir() { //nolint: nestif // we're OK with this
-		// If not allowed or exceeds threshold, skip.
-		if !a.isAllowed(a.InputPath, true) || exceedsThreshold(info.Size(), a.SourceThreshold) {
-			return nil
-		}
-		rootNode = &TreeNode{
-			Name:  filepath.Base(a.InputPath),
-			Path:  a.InputPath,
-			IsDir: false,
-			Size:  info.Size(),
-		}
-	} else {
-		// Build the filtered tree structure for source mode.
-		rootNode, err = a.filterSourceTree(ctx, fs, a.InputPath)
-		if err != nil {
-			if errors.Is(err, ErrFilterSkipped) {
-				// Nothing to display.
-				return nil
-			}
-			return fmt.Errorf("error filtering source files: %w", err)
-		}
-	}
-
-	if a.Raw {
-		// Raw mode: simply print the file contents without summary or fancy headers.
-		return a.printSourceFilesRaw(ctx, fs, rootNode, w)
-	}
-
-	// Compute summary.
-	s = rootNode.summary()
-
-	fmt.Fprintf(w,
-		"Project Source [%d files, %s total, max %s]\n",
-		s.fileCount, formatSize(s.totalSize), formatSize(s.maxSize),
-	)
-
-	// Now display the source content.
-	var counter int
-	if err = a.printSourceFiles(ctx, fs, rootNode, w, s.fileCount, &counter); err != nil {
-		return err
+	rootNode := root.tree(true)
+	if rootNode == nil {
+		// Nothing to display.
+		return nil
 	}
 
-	return nil
-}
-
-// filterSourceTree recursively builds a tree of allowed source files/directories.
-// It uses isAllowed in source mode and skips files that exceed the size threshold.
-//
-//nolint:gocognit // TODO: refactor this at some point.
-func (a *App) filterSourceTree(ctx context.Context, fs billy.Filesystem, root string) (*TreeNode, error) {
-	// Check cancellation.
-	select {
-	case <-ctx.Done():
-		return nil, ctx.Err()
-	default:
+	if a.FileHistory && a.git != nil {
+		if err := a.git.annotateFileHistory(rootNode); err != nil {
+			return err
+		}
 	}
 
-	info, err := fs.Stat(root)
-	if err != nil {
-		return nil, err
+	rootNode.walkFiles(func(node *TreeNode) { files = append(files, node) })
+	if a.Order != "" && a.Order != OrderPath && a.git != nil {
+		since, err := ParseSince(a.Since, time.Now())
+		if err != nil {
+			return err
+		}
+		if err := a.git.annotateChurn(rootNode, since); err != nil {
+			return err
+		}
+		sortFiles(files, a.Order)
 	}
 
-	// For files, check allowed and threshold.
-	if !info.IsDir() {
-		if !a.isAllowed(root, true) || exceedsThreshold(info.Size(), a.SourceThreshold) {
-			return nil, ErrFilterSkipped
+	if a.cache != nil {
+		if err := a.cache.check(ctx, a.jobs(), fs, files); err != nil {
+			return fmt.Errorf("error checking files: %w", err)
+		}
+		if a.OnlyChanged {
+			files = a.cache.changedFiles(files)
 		}
-		return &TreeNode{
-			Name:  info.Name(),
-			Path:  root,
-			IsDir: false,
-			Size:  info.Size(),
-		}, nil
 	}
 
-	// For directories.
-	node := &TreeNode{
-		Name:  info.Name(),
-		Path:  root,
-		IsDir: true,
+	if a.Raw {
+		// Raw mode: simply print the file contents without summary or fancy headers.
+		return a.printSourceFilesRaw(ctx, fs, files, w)
 	}
 
-	entries, err := fs.ReadDir(root)
-	if err != nil {
-		return nil, err
-	}
-	for _, entry := range entries {
-		childPath := filepath.Join(root, entry.Name())
-		if entry.IsDir() { //nolint: nestif // we're OK with this
-			// Only include directories if they or their descendants are allowed.
-			ok, err := a.hasAllowed(fs, childPath, true)
-			if err != nil {
-				return nil, err
-			}
-			if !ok {
-				continue
-			}
-			childNode, err := a.filterSourceTree(ctx, fs, childPath)
-			if err != nil && !errors.Is(err, ErrFilterSkipped) {
-				return nil, err
-			}
-			if childNode != nil {
-				node.Children = append(node.Children, childNode)
-			}
-		} else if a.isAllowed(childPath, true) {
-			childInfo, err := fs.Stat(childPath)
-			if err != nil {
-				return nil, err
-			}
-			// Skip files exceeding threshold.
-			if exceedsThreshold(childInfo.Size(), a.SourceThreshold) {
-				continue
-			}
-			node.Children = append(node.Children, &TreeNode{
-				Name:  entry.Name(),
-				Path:  childPath,
-				IsDir: false,
-				Size:  childInfo.Size(),
-			})
+	// Compute summary.
+	s = summarize(files)
+
+	if a.OnlyChanged {
+		fmt.Fprintf(w,
+			"Project Source [%d files changed since the last run, %s total, max %s]\n",
+			s.fileCount, formatSize(s.totalSize), formatSize(s.maxSize),
+		)
+		if removed := a.cache.removed(); len(removed) > 0 {
+			fmt.Fprintf(w, "Removed since the last run: %s\n", strings.Join(removed, ", "))
 		}
+	} else {
+		fmt.Fprintf(w,
+			"Project Source [%d files, %s total, max %s]\n",
+			s.fileCount, formatSize(s.totalSize), formatSize(s.maxSize),
+		)
 	}
-	// If directory has no allowed children, return nil.
-	if len(node.Children) == 0 {
-		return nil, ErrFilterSkipped
-	}
-	return node, nil
+
+	// Now display the source content.
+	return a.printSourceFiles(ctx, fs, files, w, s.fileCount)
 }
 
 // matchPattern returns true if the given pattern matches the provided path.
@@ -472,35 +795,73 @@ func matchPattern(pattern, pathStr string) bool {
 	return err == nil && match
 }
 
+// matchesBelow reports whether a pattern matching a directory matches all the paths below it:
+// literal patterns (matching path segments and prefixes) and "dir/**" prefix patterns.
+func matchesBelow(pattern string) bool {
+	if strings.HasPrefix(pattern, "/") {
+		return false
+	}
+	return strings.HasSuffix(pattern, "/**") || !strings.ContainsAny(pattern, "*?[")
+}
+
+// matchAnyPattern reports whether the path matches any of the comma-separated patterns.
+func matchAnyPattern(patterns, pathStr string) bool {
+	normalizedPath := filepath.ToSlash(pathStr)
+	for _, pattern := range strings.Split(patterns, ",") {
+		pattern = strings.TrimSpace(pattern)
+		if pattern != "" && matchPattern(pattern, normalizedPath) {
+			return true
+		}
+	}
+	return false
+}
+
 // isAllowed determines whether a file should be processed, matching
 // against the full normalized (slash-separated) path so that patterns
 // like "internal", "**.go", and anchored patterns such as "/README.md"
 // (which only match files in the root folder) work as expected.
-//
-//nolint:gocognit // TODO: refactor this at some point.
 func (a *App) isAllowed(filePath string, isSourceMode bool) bool {
+	return !a.isExcluded(filePath, isSourceMode) && a.isIncluded(filePath, isSourceMode)
+}
+
+// isExcluded reports whether a path is excluded by the output file, hidden files,
+// core ignores, ignore files or exclude patterns of the mode.
+func (a *App) isExcluded(filePath string, isSourceMode bool) bool {
+	return a.exclusion(filePath, isSourceMode) != ""
+}
+
+// excludesBelow reports whether the directory is excluded by a rule excluding all the paths below it
+// as well (e.g. "node_modules" or "build/**", unlike "*.go"), so that it doesn't need to be read.
+func (a *App) excludesBelow(dirPath string, isSourceMode bool) bool {
+	return a.excludingRule(dirPath, isSourceMode, true) != ""
+}
+
+// exclusion returns the rule excluding a path (see isExcluded), or "" if it is not excluded.
+func (a *App) exclusion(filePath string, isSourceMode bool) string {
+	return a.excludingRule(filePath, isSourceMode, false)
+}
+
+// excludingRule returns the rule excluding a path, or "" if it is not excluded.
+// With below, only the rules excluding all the paths below the path as well are applied.
+//
+//nolint:gocognit // one check per kind of rule
+func (a *App) excludingRule(filePath string, isSourceMode, below bool) string {
 	// Immediately ignore the destination file (if OutFilename is set)
-	if a.OutFilename != "" && filepath.Base(a.OutFilename) == filepath.Base(filePath) {
-		return false
+	if !below && a.isOutputFile(filePath) {
+		return "it is the output file"
 	}
 
 	// Select mode-specific settings.
-	var showHidden bool
-	var modeInclude, modeExclude string
+	showHidden, modeExclude := a.TreeShowHidden, a.TreeExclude
 	if isSourceMode {
-		showHidden = a.SourceShowHidden
-		modeInclude = a.SourceInclude
-		modeExclude = a.SourceExclude
-	} else {
-		showHidden = a.TreeShowHidden
-		modeInclude = a.TreeInclude
-		modeExclude = a.TreeExclude
+		showHidden, modeExclude = a.SourceShowHidden, a.SourceExclude
 	}
 
 	// Disallow hidden files/folders if not allowed.
 	if !showHidden {
-		if isHidden(filePath) || isHidden(filepath.Base(filePath)) {
-			return false
+		// Note: only paths starting with a dot are hidden below as well.
+		if isHidden(filePath) || !below && isHidden(filepath.Base(filePath)) {
+			return "it is hidden"
 		}
 	}
 
@@ -510,14 +871,14 @@ func (a *App) isAllowed(filePath string, isSourceMode bool) bool {
 	// 1. Apply Core Ignores unless disabled.
 	if !a.NoCoreIgnores {
 		for _, pattern := range CoreIgnores {
-			if matchPattern(pattern, normalizedPath) {
-				return false
+			if matchPattern(pattern, normalizedPath) && (!below || matchesBelow(pattern)) {
+				return fmt.Sprintf("core ignore pattern %q", pattern)
 			}
 		}
 		if isSourceMode {
 			for _, pattern := range CoreSourceIgnores {
-				if matchPattern(pattern, normalizedPath) {
-					return false
+				if matchPattern(pattern, normalizedPath) && (!below || matchesBelow(pattern)) {
+					return fmt.Sprintf("core source ignore pattern %q", pattern)
 				}
 			}
 		}
@@ -529,70 +890,82 @@ func (a *App) isAllowed(filePath string, isSourceMode bool) bool {
 		if pattern == "" {
 			continue
 		}
-		if matchPattern(pattern, normalizedPath) {
-			return false
+		if matchPattern(pattern, normalizedPath) && (!below || matchesBelow(pattern)) {
+			return fmt.Sprintf(".aictxignore/.gitignore pattern %q", pattern)
 		}
 	}
 
-	// 3. Determine effective include.
-	effectiveInclude := cmp.Or(modeInclude, a.Include, "**")
-	var matched bool
-	for _, pattern := range strings.Split(effectiveInclude, ",") {
+	// 3. Determine effective exclude.
+	effectiveExclude := cmp.Or(modeExclude, a.Exclude)
+	for _, pattern := range strings.Split(effectiveExclude, ",") {
 		pattern = strings.TrimSpace(pattern)
 		if pattern == "" {
 			continue
 		}
-		if matchPattern(pattern, normalizedPath) {
-			matched = true
-			break
+		if matchPattern(pattern, normalizedPath) && (!below || matchesBelow(pattern)) {
+			return fmt.Sprintf("exclude pattern %q", pattern)
 		}
 	}
-	if !matched {
+
+	return ""
+}
+
+// isOutputFile reports whether the file is the output file (OutFilename), or one of
+// the temporary files it is written to in watch mode.
+func (a *App) isOutputFile(filePath string) bool {
+	if a.OutFilename == "" {
 		return false
 	}
+	out, base := filepath.Base(a.OutFilename), filepath.Base(filePath)
+	return base == out || strings.HasPrefix(base, out+strings.TrimSuffix(outputTempSuffix, "*"))
+}
+
+// isIncluded reports whether a file matches the effective include patterns of the mode.
+func (a *App) isIncluded(filePath string, isSourceMode bool) bool {
+	modeInclude := a.TreeInclude
+	if isSourceMode {
+		modeInclude = a.SourceInclude
+	}
 
-	// 4. Determine effective exclude.
-	effectiveExclude := cmp.Or(modeExclude, a.Exclude)
-	for _, pattern := range strings.Split(effectiveExclude, ",") {
+	normalizedPath := filepath.ToSlash(filePath)
+	if a.projectInclude != "" {
+		// The saved patterns are relative to the input directory: "pkg/**" includes
+		// "../project/pkg/a.go" when processing "../project".
+		return a.matchesProjectInclude(a.relativePath(normalizedPath))
+	}
+	effectiveInclude := cmp.Or(modeInclude, a.Include, "**")
+	for _, pattern := range strings.Split(effectiveInclude, ",") {
 		pattern = strings.TrimSpace(pattern)
 		if pattern == "" {
 			continue
 		}
-		if matchPattern(pattern, normalizedPath) {
-			return false
+		if a.matchInclude(pattern, normalizedPath) {
+			return true
 		}
 	}
-
-	return true
+	return false
 }
 
-// hasAllowed checks recursively whether a given directory (or file) contains any allowed content.
-func (a *App) hasAllowed(fsys billy.Filesystem, path string, isSourceMode bool) (bool, error) {
-	info, err := fsys.Stat(path)
-	if err != nil {
-		return false, err
-	}
-	// For files, simply check if allowed.
-	if !info.IsDir() {
-		return a.isAllowed(path, isSourceMode), nil
-	}
-	// For directories, check each child.
-	entries, err := fsys.ReadDir(path)
-	if err != nil {
-		return false, err
+// matchesProjectInclude reports whether a path relative to the input directory matches the saved
+// include patterns (see projectInclude). Besides the usual patterns, they name the files picked
+// in a directory by their relative path (see pickItem.patterns), which matches exactly.
+func (a *App) matchesProjectInclude(relPath string) bool {
+	for _, pattern := range strings.Split(a.projectInclude, ",") {
+		pattern = strings.TrimSpace(pattern)
+		if pattern != "" && (pattern == relPath || a.matchInclude(pattern, relPath)) {
+			return true
+		}
 	}
-	for _, entry := range entries {
-		childPath := filepath.Join(path, entry.Name())
+	return false
+}
 
-		var allowed bool
-		if allowed, err = a.hasAllowed(fsys, childPath, isSourceMode); err != nil {
-			return false, err
-		}
-		if allowed {
-			return true, nil
-		}
+// relativePath returns the normalized path relative to the input directory.
+func (a *App) relativePath(normalizedPath string) string {
+	root := filepath.ToSlash(filepath.Clean(a.InputPath))
+	if root == "." {
+		return normalizedPath
 	}
-	return false, nil
+	return strings.TrimPrefix(normalizedPath, strings.TrimSuffix(root, "/")+"/")
 }
 
 // TreeNode is a simple structure for building the filtered directory tree.
@@ -600,9 +973,17 @@ type TreeNode struct {
 	Name     string
 	Path     string
 	IsDir    bool
-	Size     int64 // File size in bytes (only used if IsDir==false)
+	Size     int64     // File size in bytes (only used if IsDir==false)
+	ModTime  time.Time // Modification time of the file
 	Children []*TreeNode
 	IsBinary bool
+	IsLFS    bool   // Git LFS pointer file (content is not available)
+	MIME     string // MIME type detected from the content (empty if the file was not read)
+
+	Oversized bool // Exceeds SourceThreshold (kept only when oversized files are shortened)
+
+	LastCommit *CommitInfo // Last commit modifying the file (only with FileHistory)
+	Churn      *FileChurn  // Changes of the file in the history window (only with churn ordering)
 }
 
 type summary struct {
@@ -637,83 +1018,39 @@ func (node *TreeNode) summary() summary {
 	return s
 }
 
-var ErrFilterSkipped = errors.New("filter skipped")
-
-// filterTree recursively builds a tree structure of allowed nodes.
-// It applies the same isAllowed/hasAllowed logic but does not do any printing.
-func (a *App) filterTree(ctx context.Context, fsys billy.Filesystem, root string) (*TreeNode, error) {
-	// Check for cancellation.
-	select {
-	case <-ctx.Done():
-		return nil, ctx.Err()
-	default:
-	}
-
-	info, err := fsys.Stat(root)
-	if err != nil {
-		return nil, err
+// summarize returns the summary of the given files.
+func summarize(files []*TreeNode) summary {
+	var s summary
+	for _, node := range files {
+		s.fileCount++
+		s.totalSize += node.Size
+		s.maxSize = max(s.maxSize, node.Size)
 	}
+	return s
+}
 
-	node := &TreeNode{
-		Name:  info.Name(),
-		Path:  root,
-		IsDir: info.IsDir(),
+// hasLFS returns true if the tree contains any Git LFS pointer files.
+func (node *TreeNode) hasLFS() bool {
+	if !node.IsDir {
+		return node.IsLFS
 	}
-
-	// If this is a file, include it only if allowed.
-	if !info.IsDir() {
-		if a.isAllowed(root, false) {
-			node.Size = info.Size()
-			return node, nil
+	for _, child := range node.Children {
+		if child.hasLFS() {
+			return true
 		}
-		return nil, ErrFilterSkipped
 	}
+	return false
+}
 
-	// For directories, process each child.
-	entries, err := fsys.ReadDir(root)
-	if err != nil {
-		return nil, err
+// walkFiles calls fn for every file of the tree, in tree order.
+func (node *TreeNode) walkFiles(fn func(*TreeNode)) {
+	if !node.IsDir {
+		fn(node)
+		return
 	}
-
-	for _, entry := range entries {
-		childPath := filepath.Join(root, entry.Name())
-		if entry.IsDir() { //nolint: nestif // we're OK with this
-			// Only include directories if they (or any of their descendants) are allowed.
-			ok, err := a.hasAllowed(fsys, childPath, false)
-			if err != nil {
-				return nil, err
-			}
-			if !ok {
-				continue
-			}
-			childNode, err := a.filterTree(ctx, fsys, childPath)
-			if err != nil {
-				return nil, err
-			}
-			if childNode != nil {
-				node.Children = append(node.Children, childNode)
-			}
-		} else if a.isAllowed(childPath, false) {
-			childInfo, err := fsys.Stat(childPath)
-			if err != nil {
-				return nil, err
-			}
-			// Read file content to determine if binary.
-			data, err := fsutils.ReadAll(fsys, childPath)
-			if err != nil {
-				return nil, err
-			}
-			node.Children = append(node.Children, &TreeNode{
-				Name:     entry.Name(),
-				Path:     childPath,
-				IsDir:    false,
-				Size:     childInfo.Size(),
-				IsBinary: isBinary(data),
-			})
-		}
+	for _, child := range node.Children {
+		child.walkFiles(fn)
 	}
-
-	return node, nil
 }
 
 // printTree recursively prints the node and its children.
@@ -728,6 +1065,9 @@ func (node *TreeNode) printTree(prefix string, w io.Writer) {
 		if !child.IsDir && child.IsBinary {
 			childName += " *"
 		}
+		if !child.IsDir && child.IsLFS {
+			childName += " (LFS)"
+		}
 		connector := "├── "
 		newPrefix := prefix + "│   "
 		if i == childCount-1 {
@@ -741,88 +1081,155 @@ func (node *TreeNode) printTree(prefix string, w io.Writer) {
 	}
 }
 
-// printSourceFiles recursively traverses the tree and prints file content for each file.
-// totalFiles is the total number of files (from the summary) and fileCounter is a pointer
-// to a running counter.
-func (a *App) printSourceFiles(ctx context.Context, fs billy.Filesystem,
-	node *TreeNode, w io.Writer, totalFiles int, fileCounter *int,
+// renderedFile is a source file ready to be written.
+type renderedFile struct {
+	data      []byte
+	notes     []string
+	lineCount int
+	// secrets are the secrets redacted from data, reported when the file is written.
+	secrets []secretFinding
+	// stream is set for files streamed when they are written (see streams): data is empty.
+	stream bool
+	// skip is set for files left out of the output (unreadable, binary or LFS pointers).
+	skip bool
+}
+
+// renderFile reads and renders a source file. It is safe for concurrent use:
+// the state shared by the whole output is updated when the file is written (see writeFile).
+// Streamed files are only classified: they are read when written.
+func (a *App) renderFile(fs billy.Filesystem, node *TreeNode) renderedFile {
+	// Skip binary files and LFS pointers (their text is not the real content),
+	// without reading them again if they were classified for the tree.
+	if node.IsBinary || node.IsLFS {
+		return renderedFile{skip: true}
+	}
+	if f, ok := a.cache.output(node.Path); ok {
+		return f
+	}
+	f := a.readFile(fs, node)
+	a.cache.store(node, f)
+	return f
+}
+
+// readFile reads and renders a source file (see renderFile).
+func (a *App) readFile(fs billy.Filesystem, node *TreeNode) renderedFile {
+	ct, err := sniffFile(fs, node.Path, node.Size)
+	if err != nil {
+		log.Printf("Error reading file '%s': %s", node.Path, err)
+		return renderedFile{skip: true}
+	}
+	node.MIME = ct.mime
+	if ct.binary || ct.lfs {
+		return renderedFile{skip: true}
+	}
+
+	if a.streams(node) {
+		// The file is read when written.
+		return renderedFile{stream: true}
+	}
+
+	data, err := fsutils.ReadAll(fs, node.Path)
+	if err != nil {
+		log.Printf("Error reading file '%s': %s", node.Path, err)
+		return renderedFile{skip: true}
+	}
+	data = decodeText(data, ct.mime)
+
+	f := renderedFile{lineCount: countLines(data)}
+	f.data, f.notes, f.secrets = a.renderContent(node, data)
+	return f
+}
+
+// writeFile reports the secrets of the rendered file, masks it and writes it to w,
+// with its header unless raw is set. Files are written one by one, in output order.
+func (a *App) writeFile(w io.Writer, fs billy.Filesystem, node *TreeNode, f renderedFile,
+	fileNum, totalFiles int, raw bool,
 ) error {
-	// Check cancellation.
-	select {
-	case <-ctx.Done():
-		return ctx.Err()
-	default:
+	if f.stream {
+		return a.writeStreamedFile(w, fs, node, fileNum, totalFiles, raw)
 	}
 
-	// If it's a file, print its content.
-	if !node.IsDir {
-		*fileCounter++ // increment the counter
-		// *fileCounter = *fileCounter // just to emphasize its updated
-		data, err := fsutils.ReadAll(fs, node.Path)
-		if err != nil {
-			log.Printf("Error reading file '%s': %s", node.Path, err)
-			return nil
-		}
-		// Skip binary files.
-		if isBinary(data) {
-			return nil
+	a.reportSecrets(f.secrets)
+	data, masked := a.maskContent(node.Path, f.data)
+	if !raw {
+		notes := f.notes
+		if len(masked) > 0 {
+			notes = append(notes, maskNote(masked))
 		}
-
 		// Write the header including file number.
-		if _, err = w.Write(fileHeader(node, *fileCounter, totalFiles)); err != nil {
-			log.Printf("Error writing header for '%s': %s", node.Path, err)
-		}
-		if _, err = w.Write(data); err != nil {
-			log.Printf("Error writing content from '%s': %s", node.Path, err)
+		header := fileHeader(node, a.outputPath(node.Path), fileNum, totalFiles, f.lineCount, notes...)
+		if _, err := w.Write(header); err != nil {
+			return fmt.Errorf("error writing header for '%s': %w", node.Path, err)
 		}
-		fmt.Fprintln(w) // Separate files with a blank line.
-		return nil
 	}
-
-	// If it's a directory, process its children.
-	for _, child := range node.Children {
-		if err := a.printSourceFiles(ctx, fs, child, w, totalFiles, fileCounter); err != nil {
-			return err
-		}
+	if _, err := w.Write(data); err != nil {
+		return fmt.Errorf("error writing content from '%s': %w", node.Path, err)
 	}
-	return nil
+	_, err := fmt.Fprintln(w) // Separate files with a blank line.
+	return err
 }
 
-// printSourceFilesRaw recursively traverses the tree and prints the content of each file
-// without any headers or summary information.
-func (a *App) printSourceFilesRaw(ctx context.Context, fs billy.Filesystem, node *TreeNode, w io.Writer) error {
-	// Check cancellation.
-	select {
-	case <-ctx.Done():
-		return ctx.Err()
-	default:
+// writeStreamedFile renders the file line by line and writes it to w (see writeFile),
+// exactly as if it was rendered in memory.
+func (a *App) writeStreamedFile(w io.Writer, fs billy.Filesystem, node *TreeNode,
+	fileNum, totalFiles int, raw bool,
+) error {
+	sf, err := a.streamFile(fs, node, a.maskPlaceholder)
+	if err != nil {
+		return fmt.Errorf("error reading '%s': %w", node.Path, err)
 	}
+	defer sf.close()
 
-	// If it's a file, print its content.
-	if !node.IsDir {
-		data, err := fsutils.ReadAll(fs, node.Path)
-		if err != nil {
-			log.Printf("Error reading file '%s': %s", node.Path, err)
-			return nil
+	a.reportSecrets(sf.secrets)
+	if !raw {
+		notes := sf.notes
+		if len(sf.secrets) > 0 {
+			notes = append(notes, secretsNote(sf.secrets))
 		}
-		// Skip binary files.
-		if isBinary(data) {
-			return nil
+		if len(sf.masked) > 0 {
+			notes = append(notes, maskNote(sf.masked))
 		}
-		if _, err = w.Write(data); err != nil {
-			log.Printf("Error writing content from '%s': %s", node.Path, err)
+		header := fileHeader(node, a.outputPath(node.Path), fileNum, totalFiles, sf.lineCount, notes...)
+		if _, err := w.Write(header); err != nil {
+			return fmt.Errorf("error writing header for '%s': %w", node.Path, err)
 		}
-		fmt.Fprintln(w) // Separate files with a blank line.
-		return nil
 	}
-
-	// If it's a directory, process its children.
-	for _, child := range node.Children {
-		if err := a.printSourceFilesRaw(ctx, fs, child, w); err != nil {
-			return err
-		}
+	if err := sf.writeTo(w, a.LineNumbers); err != nil {
+		return fmt.Errorf("error writing content from '%s': %w", node.Path, err)
 	}
-	return nil
+	_, err = fmt.Fprintln(w) // Separate files with a blank line.
+	return err
+}
+
+// printSourceFiles prints the header and content of each file.
+// totalFiles is the total number of files (from the summary).
+// Files are read and rendered concurrently (see Jobs), and written in order.
+func (a *App) printSourceFiles(ctx context.Context, fs billy.Filesystem,
+	files []*TreeNode, w io.Writer, totalFiles int,
+) error {
+	return forEachOrdered(ctx, a.jobs(), files,
+		func(_ context.Context, node *TreeNode) renderedFile { return a.renderFile(fs, node) },
+		func(i int, node *TreeNode, f renderedFile) error {
+			if f.skip {
+				return nil
+			}
+			return a.writeFile(w, fs, node, f, i+1, totalFiles, false)
+		},
+	)
+}
+
+// printSourceFilesRaw prints the content of each file
+// without any headers or summary information.
+func (a *App) printSourceFilesRaw(ctx context.Context, fs billy.Filesystem, files []*TreeNode, w io.Writer) error {
+	return forEachOrdered(ctx, a.jobs(), files,
+		func(_ context.Context, node *TreeNode) renderedFile { return a.renderFile(fs, node) },
+		func(_ int, node *TreeNode, f renderedFile) error {
+			if f.skip {
+				return nil
+			}
+			return a.writeFile(w, fs, node, f, 0, 0, true)
+		},
+	)
 }
 
 // loadDotIgnoreFromFS tries to open and read the .aictxignore file
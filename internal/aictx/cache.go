@@ -0,0 +1,324 @@
+package aictx
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/go-git/go-billy/v5"
+)
+
+// cacheVersion is bumped when the cache format or the rendering of files changes.
+const cacheVersion = 1
+
+// maxCachedOutput is the maximum size of the files whose rendered output is cached.
+// Larger files are streamed, and only their hashes are cached.
+const maxCachedOutput = MB
+
+// bytesPerToken is the average number of bytes of a token, used to estimate token counts.
+const bytesPerToken = 4
+
+// cacheEntry is the state of a source file at the last run.
+type cacheEntry struct {
+	ModTime time.Time `json:"mtime"`
+	Size    int64     `json:"size"`
+	// Hash is the SHA-256 of the file content.
+	Hash string `json:"hash"`
+	// Tokens is the estimated number of tokens of the rendered file.
+	Tokens int `json:"tokens"`
+	// Output is the rendered file, if cached.
+	Output *cachedOutput `json:"output,omitempty"`
+}
+
+// cachedOutput is a rendered file, before masking (which depends on the whole output).
+type cachedOutput struct {
+	Data      []byte          `json:"data"`
+	Notes     []string        `json:"notes,omitempty"`
+	LineCount int             `json:"lines"`
+	Secrets   []secretFinding `json:"secrets,omitempty"`
+}
+
+// cacheFile is the content of a cache file.
+type cacheFile struct {
+	Version int `json:"version"`
+	// Options is the fingerprint of the options the cached output depends on.
+	Options string                 `json:"options"`
+	Files   map[string]*cacheEntry `json:"files"`
+}
+
+// fileCache is the cache of --incremental runs for an input.
+type fileCache struct {
+	path    string
+	options string
+
+	// previous are the entries of the last run. current are the entries of the files
+	// of this run, and changed the files changed since the last run (see check).
+	previous map[string]*cacheEntry
+	current  map[string]*cacheEntry
+	changed  map[string]bool
+}
+
+// cacheOptions are the options the rendered files depend on.
+type cacheOptions struct {
+	Version            int
+	Include            string
+	ProjectInclude     string
+	Exclude            string
+	SourceInclude      string
+	SourceExclude      string
+	SourceShowHidden   bool
+	SourceThreshold    float64
+	Oversize           string
+	OversizeHead       int
+	OversizeTail       int
+	StripComments      bool
+	KeepDocComments    bool
+	CollapseBlankLines bool
+	LineNumbers        bool
+	Skeleton           bool
+	Outline            string
+	Full               string
+	Targets            []string
+	NoRedactSecrets    bool
+	NoCoreIgnores      bool
+	NoGitIgnore        bool
+	Blame              bool
+	BlameThreshold     float64
+	// Head is the commit blamed lines are attributed to.
+	Head string
+}
+
+// openCache loads the cache of the input, from CacheDir ($XDG_CACHE_HOME/aictx by default).
+// The entries of the last run are dropped if they were produced with different options.
+func (a *App) openCache() (*fileCache, error) {
+	dir := a.CacheDir
+	if dir == "" {
+		userDir, err := os.UserCacheDir()
+		if err != nil {
+			return nil, err
+		}
+		dir = filepath.Join(userDir, "aictx")
+	}
+
+	// Local inputs are identified by their absolute path, remote ones by their URL.
+	input := a.InputPath
+	if a.Local {
+		if abs, err := filepath.Abs(input); err == nil {
+			input = abs
+		}
+	}
+	c := &fileCache{
+		path:     filepath.Join(expandHome(dir), hashString(input + "\x00" + a.Rev)[:16]+".json"),
+		options:  a.cacheOptions(),
+		previous: make(map[string]*cacheEntry),
+	}
+
+	data, err := os.ReadFile(c.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var file cacheFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		a.logger().Warnf("Ignoring invalid cache %s: %s", c.path, err)
+		return c, nil
+	}
+	if file.Version == cacheVersion && file.Options == c.options && file.Files != nil {
+		c.previous = file.Files
+	}
+	return c, nil
+}
+
+// cacheOptions returns the fingerprint of the options the rendered files depend on.
+func (a *App) cacheOptions() string {
+	opts := cacheOptions{
+		Version:            cacheVersion,
+		Include:            a.Include,
+		ProjectInclude:     a.projectInclude,
+		Exclude:            a.Exclude,
+		SourceInclude:      a.SourceInclude,
+		SourceExclude:      a.SourceExclude,
+		SourceShowHidden:   a.SourceShowHidden,
+		SourceThreshold:    a.SourceThreshold,
+		Oversize:           a.Oversize,
+		OversizeHead:       a.OversizeHead,
+		OversizeTail:       a.OversizeTail,
+		StripComments:      a.StripComments,
+		KeepDocComments:    a.KeepDocComments,
+		CollapseBlankLines: a.CollapseBlankLines,
+		LineNumbers:        a.LineNumbers,
+		Skeleton:           a.Skeleton,
+		Outline:            a.Outline,
+		Full:               a.Full,
+		Targets:            a.Targets,
+		NoRedactSecrets:    a.NoRedactSecrets,
+		NoCoreIgnores:      a.NoCoreIgnores,
+		NoGitIgnore:        a.NoGitIgnore,
+		Blame:              a.Blame,
+		BlameThreshold:     a.BlameThreshold,
+	}
+	if a.Blame && a.git != nil {
+		opts.Head = a.git.head.String()
+	}
+	data, _ := json.Marshal(opts) //nolint:errchkjson // plain struct
+	return hashString(string(data))
+}
+
+// cacheCheck is the state of a file compared to the last run.
+type cacheCheck struct {
+	entry   *cacheEntry
+	changed bool
+}
+
+// check compares the files with the last run: files with the same size and modification time
+// are unchanged, the others are hashed (concurrently, see Jobs) to find out.
+func (c *fileCache) check(ctx context.Context, jobs int, fsys billy.Filesystem, files []*TreeNode) error {
+	c.current = make(map[string]*cacheEntry, len(files))
+	c.changed = make(map[string]bool, len(files))
+	return forEachOrdered(ctx, jobs, files,
+		func(ctx context.Context, node *TreeNode) cacheCheck {
+			prev := c.previous[node.Path]
+			if prev != nil && prev.Size == node.Size && prev.ModTime.Equal(node.ModTime) {
+				return cacheCheck{entry: prev}
+			}
+			hash, err := hashFile(ctx, fsys, node.Path)
+			if err != nil {
+				// Unreadable files are reported when rendered.
+				return cacheCheck{changed: true}
+			}
+			entry := &cacheEntry{ModTime: node.ModTime, Size: node.Size, Hash: hash}
+			if prev != nil && prev.Hash == hash {
+				entry.Tokens, entry.Output = prev.Tokens, prev.Output
+				return cacheCheck{entry: entry}
+			}
+			return cacheCheck{entry: entry, changed: true}
+		},
+		func(_ int, node *TreeNode, check cacheCheck) error {
+			if check.entry != nil {
+				c.current[node.Path] = check.entry
+			}
+			c.changed[node.Path] = check.changed
+			return nil
+		},
+	)
+}
+
+// changedFiles returns the files changed since the last run.
+func (c *fileCache) changedFiles(files []*TreeNode) []*TreeNode {
+	return slices.DeleteFunc(slices.Clone(files), func(node *TreeNode) bool { return !c.changed[node.Path] })
+}
+
+// removed returns the files of the last run which are gone, sorted.
+func (c *fileCache) removed() []string {
+	var paths []string
+	for path := range c.previous {
+		if _, ok := c.changed[path]; !ok {
+			paths = append(paths, path)
+		}
+	}
+	slices.Sort(paths)
+	return paths
+}
+
+// output returns the cached rendering of an unchanged file. It is safe for concurrent use.
+func (c *fileCache) output(path string) (renderedFile, bool) {
+	if c == nil || c.changed[path] || c.current[path] == nil || c.current[path].Output == nil {
+		return renderedFile{}, false
+	}
+	out := c.current[path].Output
+	return renderedFile{data: out.Data, notes: out.Notes, lineCount: out.LineCount, secrets: out.Secrets}, true
+}
+
+// store records the rendering of a file: its output if it was rendered in memory,
+// and its estimated token count. It is safe for concurrent use (on different files).
+func (c *fileCache) store(node *TreeNode, f renderedFile) {
+	if c == nil || c.current[node.Path] == nil || f.skip {
+		return
+	}
+	entry := c.current[node.Path]
+	if f.stream {
+		entry.Tokens = int(node.Size / bytesPerToken)
+		return
+	}
+	entry.Tokens = len(f.data) / bytesPerToken
+	entry.Output = &cachedOutput{Data: f.data, Notes: f.notes, LineCount: f.lineCount, Secrets: f.secrets}
+}
+
+// tokens returns the estimated number of tokens of the given files.
+func (c *fileCache) tokens(files []*TreeNode) int {
+	var n int
+	for _, node := range files {
+		if entry := c.current[node.Path]; entry != nil {
+			n += entry.Tokens
+		}
+	}
+	return n
+}
+
+// save writes the entries of this run to the cache file.
+func (c *fileCache) save() error {
+	data, err := json.Marshal(cacheFile{Version: cacheVersion, Options: c.options, Files: c.current})
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), 0o700); err != nil { //nolint:mnd // private directory
+		return err
+	}
+	// Write to a temporary file first, so concurrent runs never read a partial cache.
+	tmp, err := os.CreateTemp(filepath.Dir(c.path), filepath.Base(c.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), c.path)
+}
+
+// hashFile returns the hex-encoded SHA-256 of the file content. It stops when ctx is canceled.
+func hashFile(ctx context.Context, fsys billy.Filesystem, path string) (string, error) {
+	f, err := fsys.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, ctxReader{ctx: ctx, r: f}); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// ctxReader reads from r until ctx is canceled.
+type ctxReader struct {
+	ctx context.Context //nolint:containedctx // bounds a single read loop
+	r   io.Reader
+}
+
+func (r ctxReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
+
+// hashString returns the hex-encoded SHA-256 of s.
+func hashString(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
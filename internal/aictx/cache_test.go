@@ -0,0 +1,99 @@
+package aictx_test
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/amberpixels/aictx/internal/aictx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIncremental(t *testing.T) {
+	dir, cacheDir := t.TempDir(), t.TempDir()
+	files := map[string]string{
+		"a.go":     "package a\n\nfunc A() {}\n",
+		"b.go":     "package b\n",
+		"sub/c.md": "# C\n",
+	}
+	for name, content := range files {
+		require.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0o700))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600))
+	}
+
+	run := func(incremental, onlyChanged bool) string {
+		var out bytes.Buffer
+		app := &aictx.App{
+			InputPath:       dir,
+			Local:           true,
+			TreeEnabled:     true,
+			SourceEnabled:   true,
+			SourceThreshold: 1,
+			LineNumbers:     true,
+			Incremental:     incremental,
+			OnlyChanged:     onlyChanged,
+			CacheDir:        cacheDir,
+			Out:             &out,
+		}
+		require.NoError(t, app.Run(context.Background()))
+		return out.String()
+	}
+
+	// Cached renderings are identical to fresh ones.
+	fresh := run(false, false)
+	assert.Equal(t, fresh, run(true, false))
+	assert.Equal(t, fresh, run(true, false))
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.go"), []byte("package a\n\nfunc A() { B() }\n"), 0o600))
+	require.NoError(t, os.Remove(filepath.Join(dir, "b.go")))
+
+	out := run(false, true)
+	assert.Contains(t, out, "Project Source [1 files changed since the last run,")
+	assert.Contains(t, out, "Removed since the last run: "+filepath.Join(dir, "b.go")+"\n")
+	assert.Contains(t, out, "func A() { B() }")
+	assert.NotContains(t, out, "File: "+filepath.Join(dir, "sub/c.md"))
+
+	// Nothing changed since.
+	out = run(false, true)
+	assert.Contains(t, out, "Project Source [0 files changed since the last run,")
+	assert.NotContains(t, out, "Removed since the last run")
+}
+
+func TestIncrementalTruncatedOutput(t *testing.T) {
+	dir, cacheDir := t.TempDir(), t.TempDir()
+	for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		content := strings.Repeat("line of "+name+"\n", 1000)
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600))
+	}
+
+	run := func(maxOutputSize float64) string {
+		var out bytes.Buffer
+		app := &aictx.App{
+			InputPath:       dir,
+			Local:           true,
+			SourceEnabled:   true,
+			SourceThreshold: 1,
+			OnlyChanged:     true,
+			MaxOutputSize:   maxOutputSize,
+			CacheDir:        cacheDir,
+			Out:             &out,
+		}
+		require.NoError(t, app.Run(context.Background()))
+		return out.String()
+	}
+
+	// The files left out of a truncated output are emitted by the next run.
+	out := run(0.02)
+	assert.Contains(t, out, "output truncated")
+	assert.NotContains(t, out, "line of c.txt")
+	out = run(0)
+	assert.Contains(t, out, "Project Source [3 files changed since the last run,")
+	assert.Contains(t, out, "line of c.txt")
+
+	out = run(0)
+	assert.Contains(t, out, "Project Source [0 files changed since the last run,")
+}
@@ -0,0 +1,182 @@
+package aictx
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/go-git/go-billy/v5"
+	"gopkg.in/yaml.v3"
+)
+
+// ProjectConfigFile is the name of the project configuration file, read from the input root.
+const ProjectConfigFile = ".aictx.yaml"
+
+// Config is the aictx configuration, read from the user configuration file
+// (see UserConfigPath) and the project's ProjectConfigFile.
+type Config struct {
+	// Include are the include patterns used when none is given (see App.Include), relative to
+	// the input directory. `aictx pick` saves the selection here.
+	Include []string `yaml:"include"`
+	// Redact configures the masking of the output.
+	Redact RedactConfig `yaml:"redact"`
+}
+
+// RedactConfig configures the masking applied on top of the built-in secret redaction.
+type RedactConfig struct {
+	// Rules are user-defined masking rules.
+	Rules []RedactRule `yaml:"rules"`
+	// PII configures the built-in PII detectors.
+	PII PIIConfig `yaml:"pii"`
+}
+
+// RedactRule replaces the matches of a regular expression.
+type RedactRule struct {
+	// Name names the rule in placeholders and reports.
+	Name string `yaml:"name"`
+	// Pattern is the regular expression (RE2 syntax) to mask.
+	Pattern string `yaml:"pattern"`
+	// Replacement replaces each match and may refer to submatches ("$1").
+	// If empty, each unique value is replaced by a stable placeholder ("[REDACTED:name-1]").
+	Replacement string `yaml:"replacement"`
+	// Files is a glob pattern (supports comma-separated lists) of the files the rule applies to.
+	// The rule applies to all files if empty.
+	Files string `yaml:"files"`
+}
+
+// PIIConfig configures the built-in PII detectors (PIIDetectors).
+type PIIConfig struct {
+	// Detectors are the enabled detectors.
+	Detectors []string `yaml:"detectors"`
+	// Files is a glob pattern (supports comma-separated lists) of the files masked,
+	// e.g. test fixtures and seed data. PII is masked in all files if empty.
+	Files string `yaml:"files"`
+}
+
+// merge appends the rules of other to c. Other's include patterns and PII settings are used if set.
+func (c *Config) merge(other *Config) {
+	if len(other.Include) > 0 {
+		c.Include = other.Include
+	}
+	c.Redact.Rules = append(c.Redact.Rules, other.Redact.Rules...)
+	if len(other.Redact.PII.Detectors) > 0 {
+		c.Redact.PII.Detectors = other.Redact.PII.Detectors
+	}
+	if other.Redact.PII.Files != "" {
+		c.Redact.PII.Files = other.Redact.PII.Files
+	}
+}
+
+// parseConfig decodes a YAML configuration. Unknown fields are rejected, to catch typos.
+func parseConfig(r io.Reader) (*Config, error) {
+	var cfg Config
+	dec := yaml.NewDecoder(r)
+	dec.KnownFields(true)
+	if err := dec.Decode(&cfg); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// LoadConfig reads the configuration file at path on the local disk.
+// A missing file results in an empty configuration.
+func LoadConfig(path string) (*Config, error) {
+	f, err := os.Open(expandHome(path))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &Config{}, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	cfg, err := parseConfig(f)
+	if err != nil {
+		return nil, fmt.Errorf("invalid config %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// UserConfigPath returns the path of the user configuration file:
+// $XDG_CONFIG_HOME/aictx/config.yaml (~/.config/aictx/config.yaml on Linux).
+func UserConfigPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "aictx", "config.yaml"), nil
+}
+
+// loadProjectConfig reads the ProjectConfigFile from the root directory of fsys.
+// A missing file results in an empty configuration.
+func loadProjectConfig(fsys billy.Filesystem, root string) (*Config, error) {
+	f, err := fsys.Open(filepath.Join(root, ProjectConfigFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &Config{}, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	cfg, err := parseConfig(f)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", ProjectConfigFile, err)
+	}
+	return cfg, nil
+}
+
+// saveProjectInclude sets the include patterns of the ProjectConfigFile in the local directory dir.
+// The rest of the file (comments included) is kept; the file is created if missing.
+func saveProjectInclude(dir string, patterns []string) error {
+	path := filepath.Join(dir, ProjectConfigFile)
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("invalid %s: %w", ProjectConfigFile, err)
+	}
+	if len(doc.Content) == 0 {
+		// Empty or missing file.
+		doc = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode}}}
+	}
+	mapping := doc.Content[0]
+	if mapping.Kind != yaml.MappingNode {
+		return fmt.Errorf("invalid %s: not a mapping", ProjectConfigFile)
+	}
+	if len(mapping.Content) == 0 {
+		mapping.Style = 0 // "{}" becomes a block mapping.
+	}
+
+	var value yaml.Node
+	if err := value.Encode(patterns); err != nil {
+		return err
+	}
+	found := false
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == "include" {
+			mapping.Content[i+1], found = &value, true
+		}
+	}
+	if !found {
+		key := &yaml.Node{Kind: yaml.ScalarNode, Value: "include"}
+		mapping.Content = append(mapping.Content, key, &value)
+	}
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2) //nolint:mnd // the usual YAML indentation
+	if err := enc.Encode(&doc); err != nil {
+		return err
+	}
+	if err := enc.Close(); err != nil {
+		return err
+	}
+	return os.WriteFile(path, buf.Bytes(), 0o644) //nolint:gosec,mnd // the project config is shared with the project
+}
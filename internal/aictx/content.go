@@ -0,0 +1,239 @@
+package aictx
+
+import (
+	"bytes"
+	"errors"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sourceLine is a line of the rendered content, without its newline.
+// Num is the 1-based number of the line in the original file, which lets
+// annotations (blame, ...) keep working after lines were removed.
+type sourceLine struct {
+	Num  int
+	Text []byte
+}
+
+// toLines splits data into numbered lines.
+func toLines(data []byte) []sourceLine {
+	raw := splitLines(data)
+	lines := make([]sourceLine, len(raw))
+	for i, l := range raw {
+		lines[i] = sourceLine{Num: i + 1, Text: bytes.TrimSuffix(l, []byte("\n"))}
+	}
+	return lines
+}
+
+// joinLines joins lines back into content. A final newline is added if trailingNewline is set.
+func joinLines(lines []sourceLine, trailingNewline bool) []byte {
+	var buf bytes.Buffer
+	for i, l := range lines {
+		buf.Write(l.Text)
+		if i < len(lines)-1 || trailingNewline {
+			buf.WriteByte('\n')
+		}
+	}
+	return buf.Bytes()
+}
+
+// collapseBlankLines replaces runs of blank lines with a single empty line
+// and drops the blank lines at the beginning and the end of the content.
+func collapseBlankLines(lines []sourceLine) []sourceLine {
+	result := make([]sourceLine, 0, len(lines))
+	pendingBlank := false
+	for _, l := range lines {
+		if len(bytes.TrimSpace(l.Text)) == 0 {
+			pendingBlank = len(result) > 0
+			continue
+		}
+		if pendingBlank {
+			result = append(result, sourceLine{Num: l.Num - 1})
+			pendingBlank = false
+		}
+		result = append(result, l)
+	}
+	return result
+}
+
+// lineNumberSeparator separates line numbers from the line content.
+const lineNumberSeparator = " │ "
+
+// numberLines prefixes each line with its right-aligned number in the original file.
+// The width is based on lineCount, the number of lines of the original file.
+func numberLines(lines []sourceLine, lineCount int) []sourceLine {
+	width := len(strconv.Itoa(lineCount))
+	result := make([]sourceLine, len(lines))
+	for i, l := range lines {
+		result[i] = numberLine(l, width)
+	}
+	return result
+}
+
+// numberLine prefixes the line with its number, right-aligned to width.
+func numberLine(l sourceLine, width int) sourceLine {
+	var buf bytes.Buffer
+	num := strconv.Itoa(l.Num)
+	for range width - len(num) {
+		buf.WriteByte(' ')
+	}
+	buf.WriteString(num)
+	if len(l.Text) == 0 {
+		buf.WriteString(strings.TrimRight(lineNumberSeparator, " "))
+	} else {
+		buf.WriteString(lineNumberSeparator)
+		buf.Write(l.Text)
+	}
+	return sourceLine{Num: l.Num, Text: buf.Bytes()}
+}
+
+// outlinerFor returns the outliner to apply to the file, or nil if it is emitted in full.
+func (a *App) outlinerFor(path string) Outliner {
+	if matchAnyPattern(a.Full, path) {
+		return nil
+	}
+	if a.Skeleton && isGoFile(path) || a.Outline != "" && matchAnyPattern(a.Outline, path) {
+		return OutlinerFor(path)
+	}
+	return nil
+}
+
+// transformsContent returns true if any of the enabled options changes the file content.
+func (a *App) transformsContent() bool {
+	return a.Skeleton || a.Outline != "" || a.StripComments || a.KeepDocComments || a.CollapseBlankLines ||
+		a.LineNumbers || len(a.targets) > 0 || !a.NoRedactSecrets ||
+		!(a.Oversize == "" || a.Oversize == OversizeSkip) || (a.Blame && a.git != nil)
+}
+
+// renderContent applies the enabled content transforms and annotations to the file data.
+// It returns the data to output, header notes describing how it was processed and the
+// secrets redacted. It is safe for concurrent use.
+func (a *App) renderContent(node *TreeNode, data []byte) ([]byte, []string, []secretFinding) {
+	if !a.transformsContent() {
+		return data, nil, nil
+	}
+
+	var notes []string
+
+	// Secrets are redacted from the whole original file first, so that private keys are
+	// recognized whatever part of them is emitted. content keeps the lines of data.
+	content := data
+	var dropped map[int]int
+	var secrets []secretFinding
+	if !a.NoRedactSecrets {
+		content, dropped, secrets = redactSecrets(node.Path, data)
+	}
+
+	// Targets select slices of the original file, which are never outlined.
+	// Oversized files are outlined or truncated unless targets select what to emit.
+	var ranges []lineRange
+	gap := selectionGap
+	targets := a.targetsFor(node.Path)
+	if len(targets) > 0 {
+		var note string
+		ranges, note = resolveTargets(targets, node.Path, data)
+		notes = append(notes, note)
+	}
+	oversized := node.Oversized && len(targets) == 0
+
+	// src is the content the line transforms work on. Line based annotations
+	// (blame) need it to be the original file.
+	src, original := content, true
+	var outliner Outliner
+	switch {
+	case len(targets) > 0:
+	case oversized && a.Oversize == OversizeOutline:
+		outliner = OutlinerFor(node.Path)
+	default:
+		outliner = a.outlinerFor(node.Path)
+	}
+	if outliner != nil {
+		outline, err := outliner.Outline(content)
+		switch {
+		case err != nil:
+			notes = append(notes, "Outline: skipped (parse error)")
+			a.logger().Debugf("Failed to outline '%s': %s", node.Path, err)
+		case len(outline) == 0:
+			notes = append(notes, "Outline: skipped (no declarations found)")
+		default:
+			src, original = outline, false
+			notes = append(notes, "Outline: declarations only, bodies elided")
+		}
+	}
+
+	if oversized {
+		lineCount := countLines(data)
+		if !original {
+			notes = append(notes, "Oversized: exceeds the source threshold, outlined")
+		} else {
+			// Files that can't be outlined are truncated.
+			ranges, gap = truncateRanges(lineCount, a.OversizeHead, a.OversizeTail)
+			notes = append(notes, oversizeTruncateNote(ranges, a.OversizeHead, a.OversizeTail, lineCount))
+			oversized = ranges != nil
+		}
+	}
+	selecting := len(targets) > 0 || oversized && original
+
+	lines := toLines(src)
+	if a.StripComments || a.KeepDocComments {
+		if syntax := commentSyntaxFor(node.Path); syntax != nil {
+			lines = stripComments(syntax, src, a.KeepDocComments)
+		}
+	}
+	if selecting {
+		lines = selectLines(lines, ranges)
+		secrets = selectedSecrets(secrets, lines, dropped)
+	}
+	if original && len(dropped) > 0 {
+		lines = slices.DeleteFunc(lines, func(l sourceLine) bool {
+			_, ok := dropped[l.Num]
+			return ok
+		})
+	}
+	if a.CollapseBlankLines {
+		lines = collapseBlankLines(lines)
+	}
+
+	if len(secrets) > 0 {
+		notes = append(notes, secretsNote(secrets))
+	}
+
+	if a.Blame && a.git != nil {
+		repoPath, ok := a.git.repoPath(node.Path)
+		switch {
+		case !ok:
+		case !original:
+			notes = append(notes, "Blame: skipped (content is not the original)")
+		case a.BlameThreshold > 0 && exceedsThreshold(node.Size, a.BlameThreshold):
+			notes = append(notes, "Blame: skipped (file too large)")
+		default:
+			blamed, err := a.git.blame(repoPath, data)
+			switch {
+			case errors.Is(err, errBlameOutdated):
+				notes = append(notes, "Blame: skipped (uncommitted changes)")
+			case err != nil:
+				notes = append(notes, "Blame: skipped (not committed)")
+				a.logger().Debugf("Failed to blame '%s': %s", node.Path, err)
+			default:
+				lines = annotateBlame(lines, blamed, time.Now())
+			}
+		}
+	}
+
+	// Line numbers are added last, so they come before the blame annotation.
+	if a.LineNumbers {
+		if original {
+			lines = numberLines(lines, countLines(data))
+		} else {
+			notes = append(notes, "Line numbers: skipped (content is not the original)")
+		}
+	}
+
+	if len(ranges) > 1 {
+		lines = separateRanges(lines, ranges, gap)
+	}
+
+	return joinLines(lines, bytes.HasSuffix(src, []byte("\n"))), notes, secrets
+}
@@ -0,0 +1,103 @@
+package aictx_test
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/amberpixels/aictx/internal/aictx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLineNumbers(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "main.go")
+	src := "package main\n\n\n\n// Comment.\nfunc main() {\n\tprintln(1)\n\tprintln(2)\n\tprintln(3)\n}\n"
+	require.NoError(t, os.WriteFile(path, []byte(src), 0o600))
+
+	var out bytes.Buffer
+	app := &aictx.App{
+		InputPath:          path,
+		Local:              true,
+		SourceEnabled:      true,
+		SourceThreshold:    1,
+		StripComments:      true,
+		CollapseBlankLines: true,
+		LineNumbers:        true,
+		Out:                &out,
+	}
+	require.NoError(t, app.Run(context.Background()))
+
+	assert.Contains(t, out.String(), "Lines: 10\n")
+	// Numbers are right-aligned to the file's line count and survive removed lines.
+	assert.Contains(t, out.String(), " 1 │ package main\n"+
+		" 5 │\n"+
+		" 6 │ func main() {\n"+
+		" 7 │ \tprintln(1)\n"+
+		" 8 │ \tprintln(2)\n"+
+		" 9 │ \tprintln(3)\n"+
+		"10 │ }\n")
+}
+
+func TestOversizeTruncate(t *testing.T) {
+	dir := t.TempDir()
+	var src bytes.Buffer
+	for i := 1; i <= 100; i++ {
+		src.WriteString(strings.Repeat("x", 20) + strconv.Itoa(i) + "\n")
+	}
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "big.txt"), src.Bytes(), 0o600))
+
+	var out bytes.Buffer
+	app := &aictx.App{
+		InputPath:       dir,
+		Local:           true,
+		SourceEnabled:   true,
+		SourceThreshold: 0.001,
+		Oversize:        aictx.OversizeTruncate,
+		OversizeHead:    2,
+		OversizeTail:    1,
+		Out:             &out,
+	}
+	require.NoError(t, app.Run(context.Background()))
+
+	x := strings.Repeat("x", 20)
+	assert.Contains(t, out.String(), "Oversized: exceeds the source threshold, truncated to first 2 and last 1 of 100 lines\n")
+	assert.Contains(t, out.String(), "-\n"+x+"1\n"+x+"2\n… [97 lines elided] …\n"+x+"100\n")
+}
+
+func TestJobsKeepOrder(t *testing.T) {
+	dir := t.TempDir()
+	for i := range 30 {
+		path := filepath.Join(dir, "pkg"+strconv.Itoa(i%3), "file"+strconv.Itoa(i)+".txt")
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o700))
+		content := strings.Repeat("line of file "+strconv.Itoa(i)+"\n", i+1) +
+			"contact: user" + strconv.Itoa(i%4) + "@example.com\n"
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	}
+
+	run := func(jobs int) string {
+		var out bytes.Buffer
+		app := &aictx.App{
+			InputPath:       dir,
+			Local:           true,
+			SourceEnabled:   true,
+			SourceThreshold: 1,
+			MaskPII:         true,
+			Jobs:            jobs,
+			Out:             &out,
+		}
+		require.NoError(t, app.Run(context.Background()))
+		return out.String()
+	}
+
+	// Files are written in tree order, and masked values numbered the same, whatever the number of workers.
+	sequential := run(1)
+	assert.Contains(t, sequential, "[REDACTED:email-4]")
+	for _, jobs := range []int{2, 8} {
+		assert.Equal(t, sequential, run(jobs), "jobs=%d", jobs)
+	}
+}
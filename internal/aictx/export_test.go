@@ -0,0 +1,84 @@
+package aictx
+
+import (
+	"bytes"
+	"context"
+	"os"
+
+	"github.com/go-git/go-billy/v5/util"
+)
+
+// WalkFiles walks the input like Run, and returns the files allowed in tree and source mode.
+func (a *App) WalkFiles(ctx context.Context) ([]string, []string, error) {
+	fsys, info, err := a.prepare(ctx, newSpinner())
+	if err != nil {
+		return nil, nil, err
+	}
+	root, err := a.walk(ctx, fsys, a.InputPath, info)
+	if err != nil {
+		return nil, nil, err
+	}
+	var tree, source []string
+	for _, node := range root.files(false) {
+		tree = append(tree, node.path)
+	}
+	for _, node := range root.files(true) {
+		source = append(source, node.path)
+	}
+	return tree, source, nil
+}
+
+// WalkFilesOneByOne returns the same files as WalkFiles, deciding every file of the input one
+// by one like aictx did before the single walk: it is the reference of WalkFiles.
+func (a *App) WalkFilesOneByOne(ctx context.Context) ([]string, []string, error) {
+	fsys, _, err := a.prepare(ctx, newSpinner())
+	if err != nil {
+		return nil, nil, err
+	}
+	var tree, source []string
+	err = util.Walk(fsys, a.InputPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		if a.isAllowed(path, false) {
+			tree = append(tree, path)
+		}
+		if a.isAllowed(path, true) && !a.skipOversized(info.Size()) {
+			source = append(source, path)
+		}
+		return nil
+	})
+	return tree, source, err
+}
+
+// RenderSources renders the source files of the input like Run, once streamed (whatever their
+// size) and once in memory, and returns both outputs.
+func (a *App) RenderSources(ctx context.Context) (string, string, error) {
+	fsys, info, err := a.prepare(ctx, newSpinner())
+	if err != nil {
+		return "", "", err
+	}
+	root, err := a.walk(ctx, fsys, a.InputPath, info)
+	if err != nil {
+		return "", "", err
+	}
+	var files []*TreeNode
+	root.tree(true).walkFiles(func(node *TreeNode) { files = append(files, node) })
+
+	var streamed, inMemory bytes.Buffer
+	for i, node := range files {
+		if err := a.writeStreamedFile(&streamed, fsys, node, i+1, len(files), false); err != nil {
+			return "", "", err
+		}
+		data, err := util.ReadFile(fsys, node.Path)
+		if err != nil {
+			return "", "", err
+		}
+		f := renderedFile{lineCount: countLines(data)}
+		f.data, f.notes, f.secrets = a.renderContent(node, data)
+		if err := a.writeFile(&inMemory, fsys, node, f, i+1, len(files), false); err != nil {
+			return "", "", err
+		}
+	}
+	return streamed.String(), inMemory.String(), nil
+}
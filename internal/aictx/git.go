@@ -1,88 +1,487 @@
 package aictx
 
 import (
+	"cmp"
+	"context"
 	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
 	"strings"
 
 	"github.com/go-git/go-billy/v5"
 	"github.com/go-git/go-billy/v5/memfs"
 	git "github.com/go-git/go-git/v5"
 	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/transport"
 	"github.com/go-git/go-git/v5/storage/memory"
 )
 
-// ReadGit clones the given Git repository URL into an in-memory FS.
-// If branch is non-empty, it will clone only that branch.
-func ReadGit(repoURL, branch string) (billy.Filesystem, error) {
+// ReadGitOptions configures how a repository is read by ReadGit.
+type ReadGitOptions struct {
+	// Auth is the auth method used for the repository itself.
+	// It may be nil for anonymous access (see ResolveGitAuth).
+	Auth transport.AuthMethod
+
+	// Submodules, when true, recursively checks out the repository's submodules.
+	Submodules bool
+
+	// SubmoduleAuth resolves the credentials of every submodule from its own URL,
+	// so the repository's credentials are never sent to the hosts its submodules name.
+	SubmoduleAuth GitAuthOptions
+}
+
+// ReadGit clones the given Git repository into an in-memory FS.
+// If repo.Branch is non-empty, it will clone only that branch.
+// If repo.Subdir is non-empty, only that path is checked out (sparse checkout).
+func ReadGit(ctx context.Context, repo *GitRepo, opts ReadGitOptions) (billy.Filesystem, error) {
+	_, billyFS, err := cloneGit(ctx, repo, opts)
+	return billyFS, err
+}
+
+// cloneGit clones the given Git repository into in-memory storage and FS.
+func cloneGit(ctx context.Context, repo *GitRepo, opts ReadGitOptions) (*git.Repository, billy.Filesystem, error) {
 	storer := memory.NewStorage()
 	billyFS := memfs.New()
 
 	cloneOpts := &git.CloneOptions{
-		URL: repoURL,
+		URL:        repo.URL,
+		Auth:       opts.Auth,
+		NoCheckout: repo.Subdir != "",
 	}
-	if branch != "" {
-		cloneOpts.ReferenceName = plumbing.NewBranchReferenceName(branch)
+	if repo.Branch != "" {
+		cloneOpts.ReferenceName = plumbing.NewBranchReferenceName(repo.Branch)
 		cloneOpts.SingleBranch = true
 	}
 
-	_, err := git.Clone(storer, billyFS, cloneOpts)
+	r, err := git.CloneContext(ctx, storer, billyFS, cloneOpts)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to clone git repository: %w", err)
+	}
+
+	if repo.Subdir != "" {
+		if err := sparseCheckout(r, repo.Subdir); err != nil {
+			return nil, nil, fmt.Errorf("failed to check out %s: %w", repo.Subdir, err)
+		}
+	}
+	if opts.Submodules {
+		err := updateSubmodules(ctx, r, repo.Subdir, opts.SubmoduleAuth, git.DefaultSubmoduleRecursionDepth)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return r, billyFS, nil
+}
+
+// openLocalRepo opens the git repository containing path and returns it
+// together with the absolute path of its worktree.
+func openLocalRepo(path string) (*git.Repository, string, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, "", err
+	}
+	r, err := git.PlainOpenWithOptions(absPath, &git.PlainOpenOptions{DetectDotGit: true})
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to open git repository at %s: %w", path, err)
+	}
+	wt, err := r.Worktree()
+	if err != nil {
+		return nil, "", err
+	}
+	return r, wt.Filesystem.Root(), nil
+}
+
+// sparseCheckout checks out only the given path of the repository's HEAD.
+func sparseCheckout(r *git.Repository, subdir string) error {
+	head, err := r.Head()
+	if err != nil {
+		return err
+	}
+	wt, err := r.Worktree()
 	if err != nil {
-		return nil, fmt.Errorf("failed to clone git repository: %w", err)
+		return err
 	}
 
-	return billyFS, nil
+	checkoutOpts := &git.CheckoutOptions{SparseCheckoutDirectories: []string{subdir}}
+	if head.Name().IsBranch() {
+		checkoutOpts.Branch = head.Name()
+	} else {
+		checkoutOpts.Hash = head.Hash()
+	}
+	return wt.Checkout(checkoutOpts)
 }
 
-// ValidateGitRepoName parses the repository shorthand and optional branch information.
-// It supports both HTTPS and SSH URLs. The logic is as follows:
-//   - If the input starts with "git@", it is treated as an SSH URL. The branch is extracted
-//     from the last '@' (if present).
-//   - Otherwise, if the input contains an '@', the part after the last '@' is the branch.
-//   - For HTTPS URLs, if the input does not contain a slash, it is considered invalid.
-//   - If the input does not start with "github.com/", it is assumed to be from GitHub and
-//     "github.com/" is prepended.
-//   - Finally, the URL is built as "https://<repo>.git" if not already ending with ".git".
+// updateSubmodules checks out the submodules located under subdir (all of them when
+// subdir is empty), and their own submodules down to depth levels. go-git's recursion
+// would reuse one auth method for every URL, so each submodule gets the credentials
+// resolved for its own URL instead.
+func updateSubmodules(
+	ctx context.Context, r *git.Repository, subdir string, authOpts GitAuthOptions, depth git.SubmoduleRescursivity,
+) error {
+	if depth == 0 {
+		return nil
+	}
+	wt, err := r.Worktree()
+	if err != nil {
+		return err
+	}
+	submodules, err := wt.Submodules()
+	if err != nil {
+		return fmt.Errorf("failed to read submodules: %w", err)
+	}
+
+	for _, sub := range submodules {
+		subPath := sub.Config().Path
+		if subdir != "" && subPath != subdir &&
+			!strings.HasPrefix(subPath, subdir+"/") && !strings.HasPrefix(subdir, subPath+"/") {
+			continue
+		}
+
+		// Fetch from the very URL the credentials are resolved for.
+		subURL, err := resolveSubmoduleURL(r, sub.Config().URL)
+		if err != nil {
+			return err
+		}
+		sub.Config().URL = subURL
+		auth, err := ResolveGitAuth(ctx, &GitRepo{URL: subURL}, authOpts)
+		if err != nil {
+			return fmt.Errorf("failed to resolve git credentials for %s: %w", subURL, err)
+		}
+
+		if err := sub.UpdateContext(ctx, &git.SubmoduleUpdateOptions{Init: true, Auth: auth}); err != nil {
+			return fmt.Errorf("failed to update submodule %s: %w", subPath, err)
+		}
+		subRepo, err := sub.Repository()
+		if err != nil {
+			return fmt.Errorf("failed to open submodule %s: %w", subPath, err)
+		}
+		if err := updateSubmodules(ctx, subRepo, "", authOpts, depth-1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DefaultGitHost is the host assumed for bare "owner/repo" shorthands.
+const DefaultGitHost = "github.com"
+
+// GitRepo describes a parsed git repository reference.
+type GitRepo struct {
+	// URL is the clone URL (or local path) understood by go-git.
+	URL string
+
+	// Branch is the optional branch to clone. Empty means the remote's default branch.
+	Branch string
+
+	// Host is the repository host (e.g. "gitlab.com"). It is empty for local repositories.
+	Host string
+
+	// Subdir is the optional path inside the repository to process (e.g. "services/api").
+	// Only this path is checked out when cloning.
+	Subdir string
+}
+
+// ValidateGitRepoName parses the repository shorthand and optional branch information
+// using DefaultGitHost for bare "owner/repo" shorthands.
+// It returns the clone URL and the branch (if any).
 func ValidateGitRepoName(repo string) (string, string, error) {
+	r, err := ParseGitRepo(repo, DefaultGitHost)
+	if err != nil {
+		return "", "", err
+	}
+	return r.URL, r.Branch, nil
+}
+
+// ParseGitRepo parses the repository reference and optional branch information.
+// The branch is always given as a trailing "@branch". The logic is as follows:
+//   - SCP-like SSH URLs ("git@host:owner/repo.git") are returned as-is.
+//   - URLs with a scheme (ssh://, git://, file://, http(s)://) are kept as-is, except
+//     that http:// is upgraded to https:// for well-known public hosts and https URLs
+//     get a ".git" suffix.
+//   - Local paths (absolute, "./", "../" or "~/") are treated as local (possibly bare)
+//     repositories and are returned as absolute paths.
+//   - Host-qualified shorthands ("gitlab.com/group/sub/repo") are cloned over HTTPS
+//     from that host, keeping nested groups intact (except on two-level hosts like github.com,
+//     where further segments are a subdirectory).
+//   - Bare "owner/repo" shorthands are resolved against defaultHost. The default host
+//     may carry its own scheme (e.g. "http://gitea.local:3000").
+//
+// Web URLs selecting a branch and a subdirectory ("/tree/<branch>/path") are only recognized
+// with a scheme (see splitRepoPath).
+func ParseGitRepo(repo, defaultHost string) (*GitRepo, error) {
 	repo = strings.TrimSpace(repo)
 	if repo == "." || repo == "" {
-		return "", "", fmt.Errorf("'%s' is not a valid repository name", repo)
+		return nil, fmt.Errorf("'%s' is not a valid repository name", repo)
 	}
 
+	switch {
+	case isLocalRepoPath(repo):
+		return parseLocalRepo(repo)
+	case strings.Contains(repo, "://"):
+		return parseURLRepo(repo)
+	case scpLikeRe.MatchString(repo):
+		return parseSCPRepo(repo), nil
+	default:
+		return parseShorthandRepo(repo, defaultHost)
+	}
+}
+
+// scpLikeRe matches SCP-like SSH URLs such as "git@github.com:owner/repo.git".
+var scpLikeRe = regexp.MustCompile(`^[A-Za-z0-9._-]+@[A-Za-z0-9.-]+:`)
+
+// wellKnownHosts are public hosts that are always served over HTTPS.
+//
+//nolint:gochecknoglobals // Hardcoded hosts.
+var wellKnownHosts = map[string]bool{
+	"github.com":    true,
+	"gitlab.com":    true,
+	"bitbucket.org": true,
+	"codeberg.org":  true,
+}
+
+// splitBranch splits a trailing "@branch" off s. Only an '@' found after position
+// from is considered, so that user info in URLs is not mistaken for a branch.
+func splitBranch(s string, from int) (string, string) {
+	lastAt := strings.LastIndex(s, "@")
+	if lastAt < from || lastAt == len(s)-1 {
+		return s, ""
+	}
+	return strings.TrimSpace(s[:lastAt]), strings.TrimSpace(s[lastAt+1:])
+}
+
+// isLocalRepoPath returns true if the given input looks like a filesystem path.
+func isLocalRepoPath(repo string) bool {
+	return filepath.IsAbs(repo) ||
+		strings.HasPrefix(repo, "./") || strings.HasPrefix(repo, "../") ||
+		strings.HasPrefix(repo, "~/")
+}
+
+// parseLocalRepo resolves a local repository path (bare or not) to an absolute path.
+func parseLocalRepo(repo string) (*GitRepo, error) {
 	var branch string
+	// Paths may legitimately contain '@', so only split the branch off
+	// when the path as given does not exist.
+	if _, err := os.Stat(expandHome(repo)); err != nil {
+		repo, branch = splitBranch(repo, 0)
+	}
 
-	// Check if it's an SSH URL.
-	if strings.HasPrefix(repo, "git@") {
-		// Find the last '@'. The first '@' is part of the SSH URL.
-		firstAt := strings.Index(repo, "@")
-		lastAt := strings.LastIndex(repo, "@")
-		if lastAt > firstAt {
-			branch = strings.TrimSpace(repo[lastAt+1:])
-			repo = strings.TrimSpace(repo[:lastAt])
+	repo, subdir := splitSubdir(repo, 0)
+	absPath, err := filepath.Abs(expandHome(repo))
+	if err != nil {
+		return nil, fmt.Errorf("invalid repository path %s: %w", repo, err)
+	}
+	return &GitRepo{URL: absPath, Branch: branch, Subdir: subdir}, nil
+}
+
+// isBareRepo returns true if the given directory looks like a bare git repository.
+func isBareRepo(path string) bool {
+	for _, name := range []string{"HEAD", "objects", "refs"} {
+		if _, err := os.Stat(filepath.Join(path, name)); err != nil {
+			return false
 		}
-		// Return the SSH URL as-is.
-		return repo, branch, nil
 	}
+	return true
+}
 
-	// For HTTPS style, check for branch information by splitting on the last '@'.
-	if strings.Contains(repo, "@") {
-		lastAt := strings.LastIndex(repo, "@")
-		branch = strings.TrimSpace(repo[lastAt+1:])
-		repo = strings.TrimSpace(repo[:lastAt])
+// parseURLRepo parses repository URLs that carry an explicit scheme.
+func parseURLRepo(repo string) (*GitRepo, error) {
+	schemeEnd := strings.Index(repo, "://") + len("://")
+	scheme := strings.ToLower(repo[:schemeEnd-len("://")])
+
+	// The authority ends at the first slash after the scheme.
+	pathStart := strings.Index(repo[schemeEnd:], "/")
+	if pathStart < 0 {
+		return nil, fmt.Errorf("invalid repository format: %s", repo)
 	}
+	pathStart += schemeEnd
+
+	repo, branch := splitBranch(repo, pathStart)
+	authority := repo[schemeEnd:pathStart]
+	host := hostWithoutPort(authority[strings.LastIndex(authority, "@")+1:])
+
+	switch scheme {
+	case "file":
+		repo, subdir := splitSubdir(repo, pathStart)
+		return &GitRepo{URL: repo, Branch: branch, Subdir: subdir}, nil
+	case "http", "https":
+		if wellKnownHosts[strings.ToLower(host)] {
+			scheme = "https"
+		}
+		nested := hasNestedPaths(host, true)
+		repoPath, pathBranch, subdir := splitRepoPath(strings.Trim(repo[pathStart:], "/"), true, nested)
+		if !strings.Contains(repoPath, "/") {
+			return nil, fmt.Errorf("invalid repository format: %s", repo)
+		}
+		return &GitRepo{
+			URL:    scheme + "://" + authority + "/" + repoPath + ".git",
+			Branch: cmp.Or(branch, pathBranch),
+			Host:   host,
+			Subdir: subdir,
+		}, nil
+	default:
+		repo, subdir := splitSubdir(repo, pathStart)
+		return &GitRepo{URL: repo, Branch: branch, Host: host, Subdir: subdir}, nil
+	}
+}
+
+// parseSCPRepo parses SCP-like SSH URLs ("user@host:path").
+func parseSCPRepo(repo string) *GitRepo {
+	colon := strings.Index(repo, ":")
+	repo, branch := splitBranch(repo, colon)
+	host := repo[strings.Index(repo, "@")+1 : colon]
+
+	repo, subdir := splitSubdir(repo, colon)
+
+	// Return the SSH URL as-is.
+	return &GitRepo{URL: repo, Branch: branch, Host: host, Subdir: subdir}
+}
+
+// parseShorthandRepo parses "owner/repo" and "host/group/.../repo" shorthands.
+func parseShorthandRepo(repo, defaultHost string) (*GitRepo, error) {
+	repo, branch := splitBranch(repo, 0)
 
 	// Validate that the repo has a slash.
 	if !strings.Contains(repo, "/") {
-		return "", "", fmt.Errorf("invalid repository format: %s", repo)
+		return nil, fmt.Errorf("invalid repository format: %s", repo)
+	}
+	repo = strings.Trim(repo, "/")
+
+	base := "https://" + cmp.Or(defaultHost, DefaultGitHost)
+	if strings.Contains(defaultHost, "://") {
+		base = strings.TrimSuffix(defaultHost, "/")
+	}
+
+	firstSegment, _, _ := strings.Cut(repo, "/")
+	explicitHost := looksLikeHost(firstSegment)
+	if explicitHost {
+		base = "https://" + firstSegment
+		repo = strings.TrimPrefix(repo, firstSegment+"/")
+	}
+
+	host := hostWithoutPort(base[strings.Index(base, "://")+len("://"):])
+	repoPath, pathBranch, subdir := splitRepoPath(repo, false, hasNestedPaths(host, explicitHost))
+	if !strings.Contains(repoPath, "/") {
+		return nil, fmt.Errorf("invalid repository format: %s", repo)
 	}
 
-	repo = strings.TrimPrefix(repo, "https://")
-	repo = strings.TrimPrefix(repo, "http://")
-	repo = strings.TrimSuffix(repo, ".git")
+	return &GitRepo{
+		URL:    base + "/" + repoPath + ".git",
+		Branch: cmp.Or(branch, pathBranch),
+		Host:   host,
+		Subdir: subdir,
+	}, nil
+}
+
+// splitRepoPath splits the path part of a repository reference into the repository
+// path, an optional branch and an optional subdirectory. Supported forms are:
+//   - "owner/repo/path/to/pkg" (the first two segments are the repository, unless nested),
+//   - web URLs (only if web is set): "owner/repo/tree/<branch>/path" (GitHub),
+//     "group/repo/-/tree/<branch>/path" (GitLab), "owner/repo/src/branch/<branch>/path" (Gitea)
+//     and "owner/repo/src/<branch>/path" (Bitbucket),
+//   - an explicit "//" separator: "group/sub/repo//path".
+//
+// With nested (GitLab groups, self-hosted instances), the whole path is the repository
+// unless one of the explicit forms is used. Branches containing slashes are not
+// supported in web URLs, as they are ambiguous.
+func splitRepoPath(repoPath string, web, nested bool) (string, string, string) {
+	var branch, subdir string
+
+	switch {
+	case strings.Contains(repoPath, "//"):
+		repoPath, subdir, _ = strings.Cut(repoPath, "//")
+	case strings.Contains(repoPath, "/-/"):
+		var rest string
+		var ok bool
+		repoPath, rest, _ = strings.Cut(repoPath, "/-/")
+		if branch, subdir, ok = splitWebPath(strings.Split(rest, "/")); !ok {
+			subdir = rest
+		}
+	default:
+		segments := strings.Split(repoPath, "/")
+		repoSegments := len(segments)
+		if !nested {
+			repoSegments = min(repoSegments, 2) //nolint:mnd // owner/repo
+		}
+		repoPath, subdir = strings.Join(segments[:repoSegments], "/"), strings.Join(segments[repoSegments:], "/")
 
-	// Prepend "github.com/" if not present.
-	if !strings.HasPrefix(repo, "github.com/") {
-		repo = "github.com/" + repo
+		// Web markers follow the repository: right after "owner/repo", or anywhere after
+		// the first two segments with nested groups.
+		for i := 2; web && i < len(segments) && (nested || i == 2); i++ {
+			if b, path, ok := splitWebPath(segments[i:]); ok {
+				repoPath, branch, subdir = strings.Join(segments[:i], "/"), b, path
+				break
+			}
+		}
 	}
 
-	return "https://" + repo + ".git", branch, nil
+	return strings.TrimSuffix(repoPath, ".git"), branch, strings.Trim(subdir, "/")
+}
+
+// splitSubdir splits an explicit "//" subdirectory separator found after position from.
+func splitSubdir(s string, from int) (string, string) {
+	idx := strings.Index(s[from:], "//")
+	if idx < 0 {
+		return s, ""
+	}
+	return s[:from+idx], strings.Trim(s[from+idx:], "/")
+}
+
+// splitWebPath extracts the branch and path from the segments following the repository
+// in a web URL (e.g. ["tree", "main", "services", "api"]). It returns false if the segments
+// don't start with a known web marker followed by a branch.
+func splitWebPath(segments []string) (string, string, bool) {
+	if len(segments) > 2 && segments[0] == "src" && segments[1] == "branch" {
+		return segments[2], strings.Join(segments[3:], "/"), true
+	}
+	if len(segments) > 1 && segments[1] != "" {
+		switch segments[0] {
+		case "tree", "blob", "src":
+			return segments[1], strings.Join(segments[2:], "/"), true
+		}
+	}
+	return "", "", false
+}
+
+// twoLevelHosts are public hosts whose repositories are always "owner/repo".
+//
+//nolint:gochecknoglobals // Hardcoded hosts.
+var twoLevelHosts = map[string]bool{
+	"github.com":    true,
+	"bitbucket.org": true,
+	"codeberg.org":  true,
+}
+
+// hasNestedPaths reports whether repository paths on the host may have more than two
+// segments (GitLab groups): the case of GitLab hosts, and of hosts not known to be
+// two-level if given explicitly. Bare shorthands on the default host are "owner/repo".
+func hasNestedPaths(host string, explicit bool) bool {
+	host = strings.ToLower(host)
+	return strings.Contains(host, "gitlab") || explicit && !twoLevelHosts[host]
+}
+
+// looksLikeHost returns true if the given path segment is a host name
+// (it contains a dot or a port, or is "localhost").
+func looksLikeHost(segment string) bool {
+	return strings.ContainsAny(segment, ".:") || segment == "localhost"
+}
+
+// hostWithoutPort strips an optional ":port" suffix from the host.
+func hostWithoutPort(host string) string {
+	if h, _, ok := strings.Cut(host, ":"); ok {
+		return h
+	}
+	return host
+}
+
+// expandHome expands a leading "~/" to the current user's home directory.
+func expandHome(path string) string {
+	if !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, path[2:])
 }
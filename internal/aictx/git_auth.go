@@ -0,0 +1,399 @@
+package aictx
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/go-git/go-git/v5/plumbing/transport/ssh"
+	gossh "golang.org/x/crypto/ssh"
+	"golang.org/x/term"
+)
+
+// GitAuthOptions configures how credentials for git remotes are resolved.
+type GitAuthOptions struct {
+	// SSHKeyPath is an explicit private key file to use for SSH remotes.
+	// If empty, the SSH agent and the default keys in ~/.ssh are tried.
+	SSHKeyPath string
+
+	// NoCredentialHelper disables asking `git credential fill` for HTTPS credentials.
+	NoCredentialHelper bool
+
+	// TokenHosts maps extra hosts (e.g. a self-hosted GitLab) to the forge whose token variables
+	// are used for them: "github", "gitlab", "bitbucket" or "gitea".
+	TokenHosts map[string]string
+
+	// GitTokenHost is the only host AICTX_GIT_TOKEN is sent to, normally the input repository's:
+	// other hosts, such as those of its submodules, never get it. Empty disables AICTX_GIT_TOKEN.
+	GitTokenHost string
+
+	// PassphrasePrompt is called to obtain the passphrase of an encrypted SSH key.
+	// If nil, AICTX_SSH_PASSPHRASE is used, falling back to an interactive terminal prompt.
+	PassphrasePrompt func(keyPath string) (string, error)
+}
+
+// forRepo returns the options with AICTX_GIT_TOKEN scoped to the host of the repository URL,
+// unless GitTokenHost is set already.
+func (o GitAuthOptions) forRepo(repoURL string) GitAuthOptions {
+	if o.GitTokenHost != "" {
+		return o
+	}
+	if ep, err := transport.NewEndpoint(repoURL); err == nil {
+		o.GitTokenHost = ep.Host
+	}
+	return o
+}
+
+// gitAuthProvider resolves credentials for a repository endpoint.
+// It returns a nil AuthMethod (and no error) when it has nothing to offer,
+// so that the next provider in the chain can be tried.
+type gitAuthProvider func(ctx context.Context, ep *transport.Endpoint) (transport.AuthMethod, error)
+
+// ResolveGitAuth resolves the auth method for the given repository.
+// Providers are chosen per protocol and host:
+//   - HTTPS: AICTX_GIT_TOKEN (for GitTokenHost only), the host's token variable (GITHUB_TOKEN, GITLAB_TOKEN, ...),
+//     .netrc and finally the git credential helpers.
+//   - SSH: the explicit key file, then the SSH agent, then the default keys in ~/.ssh.
+//
+// Credentials are never sent over plain HTTP.
+//
+// A nil AuthMethod means no credentials were found and the repository is accessed anonymously.
+func ResolveGitAuth(ctx context.Context, repo *GitRepo, opts GitAuthOptions) (transport.AuthMethod, error) {
+	ep, err := transport.NewEndpoint(repo.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid repository URL %s: %w", repo.URL, err)
+	}
+
+	for _, provider := range opts.providers(ep) {
+		auth, err := provider(ctx, ep)
+		if err != nil {
+			return nil, err
+		}
+		if auth != nil {
+			return auth, nil
+		}
+	}
+	return nil, nil //nolint:nilnil // no credentials is a valid outcome
+}
+
+// providers returns the ordered chain of providers for the given endpoint.
+func (o GitAuthOptions) providers(ep *transport.Endpoint) []gitAuthProvider {
+	switch ep.Protocol {
+	case "https":
+		// Credentials embedded into the URL are handled by go-git itself.
+		if ep.User != "" && ep.Password != "" {
+			return nil
+		}
+		providers := []gitAuthProvider{o.tokenAuth, netrcAuth}
+		if !o.NoCredentialHelper {
+			providers = append(providers, credentialHelperAuth)
+		}
+		return providers
+	case "ssh":
+		return []gitAuthProvider{o.sshKeyFileAuth, sshAgentAuth, o.sshDefaultKeysAuth}
+	default:
+		return nil
+	}
+}
+
+// forgeTokens describes the token variables of a forge, by forge name.
+type forgeTokens struct {
+	// domain is the public host of the forge: tokens are sent to it and its subdomains.
+	domain   string
+	envs     []string
+	username string
+}
+
+// forges are the forges with token variables.
+//
+//nolint:gochecknoglobals // Hardcoded mapping.
+var forges = map[string]forgeTokens{
+	"github":    {"github.com", []string{"GITHUB_TOKEN", "GH_TOKEN"}, "x-access-token"},
+	"gitlab":    {"gitlab.com", []string{"GITLAB_TOKEN"}, "oauth2"},
+	"bitbucket": {"bitbucket.org", []string{"BITBUCKET_TOKEN"}, "x-token-auth"},
+	"gitea":     {"gitea.com", []string{"GITEA_TOKEN"}, "oauth2"},
+}
+
+// forgeOf returns the forge of the host: the one of its domain (or a parent domain),
+// or the one configured in TokenHosts.
+func (o GitAuthOptions) forgeOf(host string) (forgeTokens, bool, error) {
+	for h, name := range o.TokenHosts {
+		if strings.EqualFold(h, host) {
+			forge, ok := forges[strings.ToLower(name)]
+			if !ok {
+				return forgeTokens{}, false, fmt.Errorf(
+					"unknown forge %q for host %s (expected github, gitlab, bitbucket or gitea)", name, h)
+			}
+			return forge, true, nil
+		}
+	}
+	for _, forge := range forges {
+		if host == forge.domain || strings.HasSuffix(host, "."+forge.domain) {
+			return forge, true, nil
+		}
+	}
+	return forgeTokens{}, false, nil
+}
+
+// tokenAuth reads an access token from AICTX_GIT_TOKEN (for GitTokenHost)
+// or the variables of the host's forge.
+func (o GitAuthOptions) tokenAuth(_ context.Context, ep *transport.Endpoint) (transport.AuthMethod, error) {
+	username := cmp.Or(os.Getenv("AICTX_GIT_USERNAME"), ep.User)
+	token := os.Getenv("AICTX_GIT_TOKEN")
+	if token != "" && o.GitTokenHost != "" && strings.EqualFold(ep.Host, o.GitTokenHost) {
+		return &http.BasicAuth{Username: cmp.Or(username, "oauth2"), Password: token}, nil
+	}
+
+	forge, ok, err := o.forgeOf(strings.ToLower(ep.Host))
+	if err != nil || !ok {
+		return nil, err
+	}
+	for _, env := range forge.envs {
+		if token := os.Getenv(env); token != "" {
+			return &http.BasicAuth{Username: cmp.Or(username, forge.username), Password: token}, nil
+		}
+	}
+	return nil, nil //nolint:nilnil // no credentials is a valid outcome
+}
+
+// netrcAuth looks up credentials for the host in $NETRC or ~/.netrc.
+func netrcAuth(_ context.Context, ep *transport.Endpoint) (transport.AuthMethod, error) {
+	path := os.Getenv("NETRC")
+	if path == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, nil //nolint:nilnil,nilerr // no home means no .netrc
+		}
+		path = filepath.Join(home, ".netrc")
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil //nolint:nilnil // no .netrc is a valid outcome
+		}
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	login, password, ok := lookupNetrc(data, ep.Host)
+	if !ok {
+		return nil, nil //nolint:nilnil // host is not listed
+	}
+	return &http.BasicAuth{Username: login, Password: password}, nil
+}
+
+// lookupNetrc finds the login and password for host in the contents of a .netrc file.
+// The "default" entry is used when no machine entry matches.
+func lookupNetrc(data []byte, host string) (string, string, bool) {
+	type entry struct{ login, password string }
+	var (
+		current  *entry
+		matched  *entry
+		fallback *entry
+	)
+
+	fields := strings.Fields(string(data))
+	for i := 0; i < len(fields); i++ {
+		next := func() string {
+			if i+1 < len(fields) {
+				i++
+				return fields[i]
+			}
+			return ""
+		}
+
+		switch fields[i] {
+		case "machine":
+			current = &entry{}
+			if next() == host && matched == nil {
+				matched = current
+			}
+		case "default":
+			current = &entry{}
+			fallback = current
+		case "login":
+			if current != nil {
+				current.login = next()
+			}
+		case "password":
+			if current != nil {
+				current.password = next()
+			}
+		case "macdef":
+			// Macro definitions run until an empty line; they never hold credentials we need.
+			current = nil
+		}
+	}
+
+	e := cmp.Or(matched, fallback)
+	if e == nil || e.password == "" {
+		return "", "", false
+	}
+	return e.login, e.password, true
+}
+
+// credentialHelperAuth asks the configured git credential helpers via `git credential fill`.
+func credentialHelperAuth(ctx context.Context, ep *transport.Endpoint) (transport.AuthMethod, error) {
+	gitBin, err := exec.LookPath("git")
+	if err != nil {
+		return nil, nil //nolint:nilnil,nilerr // no git binary means no helpers
+	}
+
+	var input bytes.Buffer
+	fmt.Fprintf(&input, "protocol=%s\nhost=%s\n", ep.Protocol, ep.Host)
+	if p := strings.TrimPrefix(ep.Path, "/"); p != "" {
+		fmt.Fprintf(&input, "path=%s\n", p)
+	}
+	if ep.User != "" {
+		fmt.Fprintf(&input, "username=%s\n", ep.User)
+	}
+	input.WriteString("\n")
+
+	cmd := exec.CommandContext(ctx, gitBin, "credential", "fill")
+	cmd.Stdin = &input
+	// Never let git fall back to an interactive prompt.
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0", "GIT_ASKPASS=", "SSH_ASKPASS=")
+	out, err := cmd.Output()
+	if err != nil {
+		// Helpers fail when they have nothing for this host: that's not an error for us.
+		return nil, nil //nolint:nilnil,nilerr // no credentials is a valid outcome
+	}
+
+	var username, password string
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		key, value, _ := strings.Cut(scanner.Text(), "=")
+		switch key {
+		case "username":
+			username = value
+		case "password":
+			password = value
+		}
+	}
+	if password == "" {
+		return nil, nil //nolint:nilnil // no credentials is a valid outcome
+	}
+	return &http.BasicAuth{Username: username, Password: password}, nil
+}
+
+// sshKeyFileAuth uses the explicitly configured private key file.
+func (o GitAuthOptions) sshKeyFileAuth(_ context.Context, ep *transport.Endpoint) (transport.AuthMethod, error) {
+	if o.SSHKeyPath == "" {
+		return nil, nil //nolint:nilnil // not configured
+	}
+	return o.loadSSHKey(sshUser(ep), expandHome(o.SSHKeyPath))
+}
+
+// sshAgentAuth uses the running SSH agent, if any.
+func sshAgentAuth(_ context.Context, ep *transport.Endpoint) (transport.AuthMethod, error) {
+	if os.Getenv("SSH_AUTH_SOCK") == "" {
+		return nil, nil //nolint:nilnil // no agent
+	}
+	auth, err := ssh.NewSSHAgentAuth(sshUser(ep))
+	if err != nil {
+		return nil, nil //nolint:nilnil,nilerr // unreachable agent: try the default keys
+	}
+	return auth, nil
+}
+
+// sshDefaultKeys are the default private key files in ~/.ssh, in the order ssh tries them.
+//
+//nolint:gochecknoglobals // Hardcoded list.
+var sshDefaultKeys = []string{"id_ed25519", "id_ecdsa", "id_rsa"}
+
+// sshDefaultKeysAuth offers all the default private keys in ~/.ssh, like ssh does,
+// so that the server picks the one it knows.
+func (o GitAuthOptions) sshDefaultKeysAuth(_ context.Context, ep *transport.Endpoint) (transport.AuthMethod, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil, nil //nolint:nilnil,nilerr // no home means no default keys
+	}
+	var signers []gossh.Signer
+	for _, name := range sshDefaultKeys {
+		keyPath := filepath.Join(home, ".ssh", name)
+		if _, err := os.Stat(keyPath); err != nil {
+			continue
+		}
+		signer, err := o.loadSSHSigner(keyPath)
+		if err != nil {
+			return nil, err
+		}
+		signers = append(signers, signer)
+	}
+	if len(signers) == 0 {
+		return nil, nil //nolint:nilnil // no default keys
+	}
+	return &ssh.PublicKeysCallback{
+		User:     sshUser(ep),
+		Callback: func() ([]gossh.Signer, error) { return signers, nil },
+	}, nil
+}
+
+// loadSSHKey loads the private key file, asking for a passphrase if the key is encrypted.
+func (o GitAuthOptions) loadSSHKey(user, keyPath string) (transport.AuthMethod, error) {
+	signer, err := o.loadSSHSigner(keyPath)
+	if err != nil {
+		return nil, err
+	}
+	return &ssh.PublicKeys{User: user, Signer: signer}, nil
+}
+
+// loadSSHSigner parses the private key file, asking for a passphrase if the key is encrypted.
+func (o GitAuthOptions) loadSSHSigner(keyPath string) (gossh.Signer, error) {
+	pemBytes, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read SSH key %s: %w", keyPath, err)
+	}
+
+	signer, err := gossh.ParsePrivateKey(pemBytes)
+	var missingErr *gossh.PassphraseMissingError
+	if errors.As(err, &missingErr) {
+		prompt := o.PassphrasePrompt
+		if prompt == nil {
+			prompt = promptPassphrase
+		}
+		passphrase, promptErr := prompt(keyPath)
+		if promptErr != nil {
+			return nil, fmt.Errorf("failed to get passphrase for SSH key %s: %w", keyPath, promptErr)
+		}
+		signer, err = gossh.ParsePrivateKeyWithPassphrase(pemBytes, []byte(passphrase))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load SSH key %s: %w", keyPath, err)
+	}
+	return signer, nil
+}
+
+// promptPassphrase reads the passphrase from AICTX_SSH_PASSPHRASE or from the terminal.
+func promptPassphrase(keyPath string) (string, error) {
+	if passphrase, ok := os.LookupEnv("AICTX_SSH_PASSPHRASE"); ok {
+		return passphrase, nil
+	}
+
+	fd := int(os.Stdin.Fd()) //nolint:gosec // file descriptors fit into int
+	if !term.IsTerminal(fd) {
+		return "", errors.New("key is encrypted and no terminal is available (set AICTX_SSH_PASSPHRASE)")
+	}
+
+	fmt.Fprintf(os.Stderr, "Enter passphrase for key '%s': ", keyPath)
+	passphrase, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", err
+	}
+	return string(passphrase), nil
+}
+
+// sshUser returns the SSH user of the endpoint, defaulting to "git".
+func sshUser(ep *transport.Endpoint) string {
+	return cmp.Or(ep.User, "git")
+}
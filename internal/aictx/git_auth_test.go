@@ -0,0 +1,209 @@
+package aictx_test
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/amberpixels/aictx/internal/aictx"
+	"github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/go-git/go-git/v5/plumbing/transport/ssh"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+func TestResolveGitAuth(t *testing.T) {
+	netrc := filepath.Join(t.TempDir(), ".netrc")
+	require.NoError(t, os.WriteFile(netrc, []byte(
+		"machine gitea.example.com login bot password netrc-secret\n"+
+			"default login anonymous password default-secret\n",
+	), 0o600))
+
+	tests := []struct {
+		name         string
+		repo         string
+		env          map[string]string
+		expectedAuth *http.BasicAuth
+	}{
+		{
+			name:         "AICTX_GIT_TOKEN wins for the input repository's host",
+			repo:         "https://gitea.example.com/team/repo.git",
+			env:          map[string]string{"AICTX_GIT_TOKEN": "aictx-token", "GITHUB_TOKEN": "gh-token"},
+			expectedAuth: &http.BasicAuth{Username: "oauth2", Password: "aictx-token"},
+		},
+		{
+			name:         "AICTX_GIT_TOKEN is not sent to other hosts",
+			repo:         "https://github.com/owner/repo.git",
+			env:          map[string]string{"AICTX_GIT_TOKEN": "aictx-token", "GITHUB_TOKEN": "gh-token"},
+			expectedAuth: &http.BasicAuth{Username: "x-access-token", Password: "gh-token"},
+		},
+		{
+			name:         "GITHUB_TOKEN for github.com",
+			repo:         "https://github.com/owner/repo.git",
+			env:          map[string]string{"GITHUB_TOKEN": "gh-token", "GITLAB_TOKEN": "gl-token"},
+			expectedAuth: &http.BasicAuth{Username: "x-access-token", Password: "gh-token"},
+		},
+		{
+			name:         "GITLAB_TOKEN for gitlab.com",
+			repo:         "https://gitlab.com/group/sub/repo.git",
+			env:          map[string]string{"GITHUB_TOKEN": "gh-token", "GITLAB_TOKEN": "gl-token"},
+			expectedAuth: &http.BasicAuth{Username: "oauth2", Password: "gl-token"},
+		},
+		{
+			name:         "netrc machine entry",
+			repo:         "https://gitea.example.com/team/repo.git",
+			env:          map[string]string{"GITHUB_TOKEN": "gh-token"},
+			expectedAuth: &http.BasicAuth{Username: "bot", Password: "netrc-secret"},
+		},
+		{
+			name:         "netrc default entry",
+			repo:         "https://git.other.org/team/repo.git",
+			expectedAuth: &http.BasicAuth{Username: "anonymous", Password: "default-secret"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			for _, env := range []string{"AICTX_GIT_TOKEN", "AICTX_GIT_USERNAME", "GITHUB_TOKEN", "GH_TOKEN", "GITLAB_TOKEN"} {
+				t.Setenv(env, tc.env[env])
+			}
+			t.Setenv("NETRC", netrc)
+
+			auth, err := aictx.ResolveGitAuth(t.Context(), &aictx.GitRepo{URL: tc.repo}, aictx.GitAuthOptions{
+				NoCredentialHelper: true,
+				GitTokenHost:       "gitea.example.com",
+			})
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedAuth, auth)
+		})
+	}
+}
+
+func TestResolveGitAuthHosts(t *testing.T) {
+	netrc := filepath.Join(t.TempDir(), ".netrc")
+	require.NoError(t, os.WriteFile(netrc, []byte("machine plain.example.com login bot password netrc-secret\n"), 0o600))
+	t.Setenv("NETRC", netrc)
+	t.Setenv("AICTX_GIT_USERNAME", "")
+	t.Setenv("GH_TOKEN", "")
+	t.Setenv("GITHUB_TOKEN", "gh-token")
+	t.Setenv("GITLAB_TOKEN", "gl-token")
+
+	tests := []struct {
+		name         string
+		repo         string
+		gitToken     string
+		expectedAuth *http.BasicAuth
+	}{
+		{
+			name:         "subdomain of github.com",
+			repo:         "https://api.github.com/owner/repo.git",
+			expectedAuth: &http.BasicAuth{Username: "x-access-token", Password: "gh-token"},
+		},
+		{
+			name: "host containing github",
+			repo: "https://github.evil.com/owner/repo.git",
+		},
+		{
+			name: "host containing gitlab",
+			repo: "https://notgitlab.example/group/repo.git",
+		},
+		{
+			name: "domain ending like github.com",
+			repo: "https://evilgithub.com/owner/repo.git",
+		},
+		{
+			name:         "configured host",
+			repo:         "https://git.corp.com/group/repo.git",
+			expectedAuth: &http.BasicAuth{Username: "oauth2", Password: "gl-token"},
+		},
+		{
+			name: "plain http to a token host",
+			repo: "http://github.com/owner/repo.git",
+		},
+		{
+			name:     "plain http with AICTX_GIT_TOKEN",
+			repo:     "http://git.corp.com/group/repo.git",
+			gitToken: "aictx-token",
+		},
+		{
+			name:     "AICTX_GIT_TOKEN for another host",
+			repo:     "https://other.example.com/group/repo.git",
+			gitToken: "aictx-token",
+		},
+		{
+			name: "plain http with a netrc entry",
+			repo: "http://plain.example.com/team/repo.git",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("AICTX_GIT_TOKEN", tc.gitToken)
+
+			auth, err := aictx.ResolveGitAuth(t.Context(), &aictx.GitRepo{URL: tc.repo}, aictx.GitAuthOptions{
+				NoCredentialHelper: true,
+				TokenHosts:         map[string]string{"git.corp.com": "gitlab"},
+				GitTokenHost:       "git.corp.com",
+			})
+			require.NoError(t, err)
+			if tc.expectedAuth == nil {
+				assert.Nil(t, auth)
+				return
+			}
+			assert.Equal(t, tc.expectedAuth, auth)
+		})
+	}
+
+	_, err := aictx.ResolveGitAuth(t.Context(), &aictx.GitRepo{URL: "https://git.corp.com/group/repo.git"},
+		aictx.GitAuthOptions{TokenHosts: map[string]string{"git.corp.com": "sourcehut"}})
+	require.Error(t, err)
+}
+
+func TestResolveGitAuthLocalRepo(t *testing.T) {
+	auth, err := aictx.ResolveGitAuth(t.Context(), &aictx.GitRepo{URL: t.TempDir()}, aictx.GitAuthOptions{})
+	require.NoError(t, err)
+	assert.Nil(t, auth)
+}
+
+func TestResolveGitAuthDefaultSSHKeys(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("SSH_AUTH_SOCK", "")
+	require.NoError(t, os.Mkdir(filepath.Join(home, ".ssh"), 0o700))
+
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	var expected []string
+	for name, key := range map[string]crypto.PrivateKey{"id_ed25519": edKey, "id_ecdsa": ecKey} {
+		block, err := gossh.MarshalPrivateKey(key, "")
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(filepath.Join(home, ".ssh", name), pem.EncodeToMemory(block), 0o600))
+		signer, err := gossh.NewSignerFromKey(key)
+		require.NoError(t, err)
+		expected = append(expected, string(signer.PublicKey().Marshal()))
+	}
+
+	auth, err := aictx.ResolveGitAuth(t.Context(), &aictx.GitRepo{URL: "git@github.com:owner/repo.git"},
+		aictx.GitAuthOptions{})
+	require.NoError(t, err)
+	callback, ok := auth.(*ssh.PublicKeysCallback)
+	require.True(t, ok, "expected all the default keys, got %T", auth)
+	assert.Equal(t, "git", callback.User)
+
+	signers, err := callback.Callback()
+	require.NoError(t, err)
+	offered := make([]string, 0, len(signers))
+	for _, signer := range signers {
+		offered = append(offered, string(signer.PublicKey().Marshal()))
+	}
+	assert.ElementsMatch(t, expected, offered)
+}
@@ -0,0 +1,120 @@
+package aictx
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// errBlameOutdated is returned when the file content differs from the committed one.
+var errBlameOutdated = errors.New("uncommitted changes")
+
+// blameAuthorWidth is the width the author name is padded (or cut) to in blame prefixes.
+const blameAuthorWidth = 12
+
+// blameSeparator separates blame prefixes from the line content.
+const blameSeparator = "│ "
+
+// blame returns the commit that last changed each line of the committed file at repoPath.
+// It fails with errBlameOutdated if data (the file content) differs from the committed one.
+func (rc *repoContext) blame(repoPath string, data []byte) ([]*git.Line, error) {
+	// Files are rendered concurrently, but the object storage is not safe for concurrent use.
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	commit, err := rc.repo.CommitObject(rc.head)
+	if err != nil {
+		return nil, err
+	}
+	result, err := git.Blame(commit, repoPath)
+	if err != nil {
+		return nil, err
+	}
+
+	lines := splitLines(data)
+	if len(lines) != len(result.Lines) {
+		return nil, errBlameOutdated
+	}
+	for i, line := range lines {
+		if string(bytes.TrimSuffix(line, []byte("\n"))) != result.Lines[i].Text {
+			return nil, errBlameOutdated
+		}
+	}
+	return result.Lines, nil
+}
+
+// annotateBlame prefixes each line with the short hash, author and age of the commit
+// that last changed it. Contiguous lines from the same commit form a hunk: only its
+// first line carries the annotation, the others are indented to keep the code aligned.
+func annotateBlame(lines []sourceLine, blamed []*git.Line, now time.Time) []sourceLine {
+	result := make([]sourceLine, len(lines))
+	var prevHash plumbing.Hash
+	var prefixWidth int
+	for i, line := range lines {
+		var buf bytes.Buffer
+		b := blamed[line.Num-1]
+		if i == 0 || b.Hash != prevHash {
+			prefix := fmt.Sprintf("%s %-*s %4s ",
+				b.Hash.String()[:shortHashLen],
+				blameAuthorWidth, truncateString(b.AuthorName, blameAuthorWidth),
+				formatAge(now.Sub(b.Date)),
+			)
+			prefixWidth = utf8.RuneCountInString(prefix)
+			buf.WriteString(prefix)
+		} else {
+			buf.WriteString(strings.Repeat(" ", prefixWidth))
+		}
+		buf.WriteString(blameSeparator)
+		buf.Write(line.Text)
+		result[i] = sourceLine{Num: line.Num, Text: buf.Bytes()}
+		prevHash = b.Hash
+	}
+	return result
+}
+
+// splitLines splits data into lines, keeping the trailing newlines.
+func splitLines(data []byte) [][]byte {
+	if len(data) == 0 {
+		return nil
+	}
+	return bytes.SplitAfter(bytes.TrimSuffix(data, []byte("\n")), []byte("\n"))
+}
+
+// truncateString cuts s to at most n runes.
+func truncateString(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n])
+}
+
+// formatAge renders a duration as a compact age such as "3d", "5mo" or "2y".
+func formatAge(d time.Duration) string {
+	const (
+		day   = 24 * time.Hour
+		week  = 7 * day
+		month = 30 * day
+		year  = 365 * day
+	)
+	switch {
+	case d < time.Hour:
+		return fmt.Sprintf("%dm", int(d/time.Minute))
+	case d < day:
+		return fmt.Sprintf("%dh", int(d/time.Hour))
+	case d < week:
+		return fmt.Sprintf("%dd", int(d/day))
+	case d < month:
+		return fmt.Sprintf("%dw", int(d/week))
+	case d < year:
+		return fmt.Sprintf("%dmo", int(d/month))
+	default:
+		return fmt.Sprintf("%dy", int(d/year))
+	}
+}
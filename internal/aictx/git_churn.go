@@ -0,0 +1,192 @@
+package aictx
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"slices"
+	"strconv"
+	"time"
+
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+)
+
+// Source file orders.
+const (
+	// OrderPath emits files in tree (path) order.
+	OrderPath = "path"
+	// OrderChurn emits the most frequently changed files first.
+	OrderChurn = "churn"
+	// OrderHotspot emits files ranked by churn weighted by their size first.
+	OrderHotspot = "hotspot"
+)
+
+// FileChurn describes how much a file changed in the analyzed window.
+type FileChurn struct {
+	Path         string
+	Size         int64
+	Commits      int
+	LinesAdded   int
+	LinesDeleted int
+}
+
+// ChurnScore ranks files by commit frequency, weighted by the amount of changed lines.
+func (fc *FileChurn) ChurnScore() float64 {
+	if fc == nil || fc.Commits == 0 {
+		return 0
+	}
+	return float64(fc.Commits) * math.Log2(2+float64(fc.LinesAdded+fc.LinesDeleted))
+}
+
+// HotspotScore combines the churn score with the file size: big files that change a lot
+// are the hotspots of a project.
+func (fc *FileChurn) HotspotScore() float64 {
+	if fc == nil {
+		return 0
+	}
+	return fc.ChurnScore() * math.Log2(2+float64(fc.Size)/KB)
+}
+
+// churn walks the commits since the given time (the whole history if zero) and collects
+// the number of commits and changed lines per repository path. Merge commits are skipped.
+func (rc *repoContext) churn(since time.Time) (map[string]*FileChurn, error) {
+	iter, err := rc.repo.Log(&git.LogOptions{From: rc.head, Order: git.LogOrderCommitterTime})
+	if err != nil {
+		return nil, err
+	}
+	defer iter.Close()
+
+	result := make(map[string]*FileChurn)
+	err = iter.ForEach(func(c *object.Commit) error {
+		if !since.IsZero() && c.Committer.When.Before(since) {
+			return storer.ErrStop
+		}
+		if c.NumParents() > 1 {
+			return nil
+		}
+
+		stats, err := c.Stats()
+		if err != nil {
+			return fmt.Errorf("failed to diff commit %s: %w", c.Hash, err)
+		}
+		for _, st := range stats {
+			fc := result[st.Name]
+			if fc == nil {
+				fc = &FileChurn{Path: st.Name}
+				result[st.Name] = fc
+			}
+			fc.Commits++
+			fc.LinesAdded += st.Addition
+			fc.LinesDeleted += st.Deletion
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read git history: %w", err)
+	}
+	return result, nil
+}
+
+// annotateChurn sets Churn of every file in the tree.
+// Files not changed in the window get an empty FileChurn.
+func (rc *repoContext) annotateChurn(root *TreeNode, since time.Time) error {
+	churn, err := rc.churn(since)
+	if err != nil {
+		return err
+	}
+	root.walkFiles(func(node *TreeNode) {
+		fc := &FileChurn{Path: node.Path}
+		if p, ok := rc.repoPath(node.Path); ok {
+			if found, ok := churn[p]; ok {
+				copied := *found
+				fc = &copied
+				fc.Path = node.Path
+			}
+		}
+		fc.Size = node.Size
+		node.Churn = fc
+	})
+	return nil
+}
+
+// sortFiles orders files in place according to order (see OrderPath and friends).
+// The sort is stable, so files with equal scores keep their path order.
+func sortFiles(files []*TreeNode, order string) {
+	var score func(*TreeNode) float64
+	switch order {
+	case OrderChurn:
+		score = func(n *TreeNode) float64 { return n.Churn.ChurnScore() }
+	case OrderHotspot:
+		score = func(n *TreeNode) float64 { return n.Churn.HotspotScore() }
+	default:
+		return
+	}
+	slices.SortStableFunc(files, func(a, b *TreeNode) int {
+		return cmp.Compare(score(b), score(a))
+	})
+}
+
+// sinceRe matches relative durations with day, week, month or year units ("90d", "2w", "6mo", "1y").
+var sinceRe = regexp.MustCompile(`^(\d+)(d|w|mo|y)$`)
+
+// ParseSince parses a history window: a relative duration ("90d", "2w", "6mo", "1y", "36h")
+// or a date ("2024-01-31"). It returns the start of the window relative to now.
+// An empty string means the whole history (zero time).
+func ParseSince(s string, now time.Time) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if m := sinceRe.FindStringSubmatch(s); m != nil {
+		n, err := strconv.Atoi(m[1])
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid window %q: %w", s, err)
+		}
+		switch m[2] {
+		case "d":
+			return now.AddDate(0, 0, -n), nil
+		case "w":
+			return now.AddDate(0, 0, -7*n), nil
+		case "mo":
+			return now.AddDate(0, -n, 0), nil
+		default:
+			return now.AddDate(-n, 0, 0), nil
+		}
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return now.Add(-d), nil
+	}
+	if t, err := time.ParseInLocation(time.DateOnly, s, now.Location()); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid window %q: expected e.g. 90d, 2w, 6mo, 1y or 2024-01-31", s)
+}
+
+// printHotspots writes the table of the top n changed files (all if n <= 0), ranked by order.
+func printHotspots(w io.Writer, files []*TreeNode, order string, n int, window string) {
+	changed := make([]*TreeNode, 0, len(files))
+	for _, f := range files {
+		if f.Churn != nil && f.Churn.Commits > 0 {
+			changed = append(changed, f)
+		}
+	}
+	sortFiles(changed, order)
+	if n > 0 && len(changed) > n {
+		changed = changed[:n]
+	}
+
+	if window == "" {
+		window = "all history"
+	} else {
+		window = "since " + window
+	}
+	fmt.Fprintf(w, "Project Hotspots [top %d of %d files, %s]\n", len(changed), len(files), window)
+	fmt.Fprintf(w, "%7s %8s %8s %10s  %s\n", "Commits", "+Lines", "-Lines", "Size", "Path")
+	for _, f := range changed {
+		fmt.Fprintf(w, "%7d %8d %8d %10s  %s\n",
+			f.Churn.Commits, f.Churn.LinesAdded, f.Churn.LinesDeleted, formatSize(f.Size), f.Path)
+	}
+}
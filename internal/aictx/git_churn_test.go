@@ -0,0 +1,42 @@
+package aictx_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/amberpixels/aictx/internal/aictx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSince(t *testing.T) {
+	now := time.Date(2025, time.March, 31, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		input       string
+		expected    time.Time
+		expectError bool
+	}{
+		{input: "", expected: time.Time{}},
+		{input: "90d", expected: now.AddDate(0, 0, -90)},
+		{input: "2w", expected: now.AddDate(0, 0, -14)},
+		{input: "6mo", expected: now.AddDate(0, -6, 0)},
+		{input: "1y", expected: now.AddDate(-1, 0, 0)},
+		{input: "36h", expected: now.Add(-36 * time.Hour)},
+		{input: "2024-01-31", expected: time.Date(2024, time.January, 31, 0, 0, 0, 0, time.UTC)},
+		{input: "yesterday", expectError: true},
+		{input: "10m0", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			since, err := aictx.ParseSince(tt.input, now)
+			if tt.expectError {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.True(t, tt.expected.Equal(since), "expected %s, got %s", tt.expected, since)
+		})
+	}
+}
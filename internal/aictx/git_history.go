@@ -0,0 +1,229 @@
+package aictx
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+)
+
+// repoContext holds the git repository backing the processed filesystem.
+type repoContext struct {
+	repo *git.Repository
+
+	// root is the absolute path of the worktree for local (OS) filesystems.
+	// It is empty when the filesystem is rooted at the repository root
+	// (cloned repositories and --rev trees).
+	root string
+
+	// head is the commit the processed filesystem reflects.
+	head plumbing.Hash
+
+	// mu serializes the blames of concurrently rendered files.
+	mu sync.Mutex
+}
+
+// repoPath converts a path of the processed filesystem into a slash-separated path
+// relative to the repository root. It returns false if the path is outside of the repository.
+func (rc *repoContext) repoPath(fsPath string) (string, bool) {
+	if rc.root == "" {
+		return cleanTreePath(fsPath), true
+	}
+
+	absPath, err := filepath.Abs(fsPath)
+	if err != nil {
+		return "", false
+	}
+	rel, err := filepath.Rel(rc.root, absPath)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return "", false
+	}
+	if rel == "." {
+		return "", true
+	}
+	return filepath.ToSlash(rel), true
+}
+
+// newRepoContext resolves the commit for rev (HEAD if empty) in r.
+func newRepoContext(r *git.Repository, root, rev string) (*repoContext, error) {
+	if rev == "" {
+		rev = "HEAD"
+	}
+	hash, err := r.ResolveRevision(plumbing.Revision(rev))
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve revision %s: %w", rev, err)
+	}
+	return &repoContext{repo: r, root: root, head: *hash}, nil
+}
+
+// CommitInfo is a short description of a commit.
+type CommitInfo struct {
+	Hash    string
+	Author  string
+	Date    time.Time
+	Subject string
+}
+
+// shortHashLen is the length of abbreviated commit hashes.
+const shortHashLen = 7
+
+// newCommitInfo builds a CommitInfo from a commit object.
+func newCommitInfo(c *object.Commit) *CommitInfo {
+	subject, _, _ := strings.Cut(strings.TrimSpace(c.Message), "\n")
+	return &CommitInfo{
+		Hash:    c.Hash.String()[:shortHashLen],
+		Author:  c.Author.Name,
+		Date:    c.Author.When,
+		Subject: subject,
+	}
+}
+
+// String renders the commit as "<hash> <date> <author>: <subject>".
+func (ci *CommitInfo) String() string {
+	return fmt.Sprintf("%s %s %s: %s", ci.Hash, ci.Date.Format(time.DateOnly), ci.Author, ci.Subject)
+}
+
+// pathFilter returns a go-git path filter matching prefix (a file or a directory).
+// It returns nil (i.e. no filtering) for the repository root.
+func pathFilter(prefix string) func(string) bool {
+	if prefix == "" {
+		return nil
+	}
+	return func(p string) bool {
+		return p == prefix || strings.HasPrefix(p, prefix+"/")
+	}
+}
+
+// recentCommits returns the last n commits touching the given repository path.
+func (rc *repoContext) recentCommits(repoPath string, n int) ([]*CommitInfo, error) {
+	iter, err := rc.repo.Log(&git.LogOptions{From: rc.head, PathFilter: pathFilter(repoPath)})
+	if err != nil {
+		return nil, err
+	}
+	defer iter.Close()
+
+	var commits []*CommitInfo
+	err = iter.ForEach(func(c *object.Commit) error {
+		if len(commits) >= n {
+			return storer.ErrStop
+		}
+		commits = append(commits, newCommitInfo(c))
+		return nil
+	})
+	return commits, err
+}
+
+// lastCommits walks the history once and finds the last commit modifying each of the
+// given repository paths. Paths that were never committed are missing from the result.
+func (rc *repoContext) lastCommits(repoPaths []string) (map[string]*CommitInfo, error) {
+	pending := make(map[string]bool, len(repoPaths))
+	for _, p := range repoPaths {
+		pending[p] = true
+	}
+	result := make(map[string]*CommitInfo, len(repoPaths))
+
+	iter, err := rc.repo.Log(&git.LogOptions{From: rc.head})
+	if err != nil {
+		return nil, err
+	}
+	defer iter.Close()
+
+	err = iter.ForEach(func(c *object.Commit) error {
+		if len(pending) == 0 {
+			return storer.ErrStop
+		}
+		changed, err := changedPaths(c)
+		if err != nil {
+			return err
+		}
+		for _, p := range changed {
+			if pending[p] {
+				result[p] = newCommitInfo(c)
+				delete(pending, p)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// changedPaths returns the paths modified by the commit compared to its first parent
+// (or all of its paths for a root commit).
+func changedPaths(c *object.Commit) ([]string, error) {
+	tree, err := c.Tree()
+	if err != nil {
+		return nil, err
+	}
+
+	var parentTree *object.Tree
+	if c.NumParents() > 0 {
+		parent, err := c.Parent(0)
+		if err != nil {
+			return nil, err
+		}
+		if parentTree, err = parent.Tree(); err != nil {
+			return nil, err
+		}
+	}
+
+	changes, err := object.DiffTree(parentTree, tree)
+	if err != nil {
+		return nil, err
+	}
+	paths := make([]string, 0, len(changes))
+	for _, change := range changes {
+		paths = append(paths, cmp.Or(change.To.Name, change.From.Name))
+	}
+	return paths, nil
+}
+
+// printHistory writes the history section for the given repository path.
+func (rc *repoContext) printHistory(w io.Writer, repoPath string, n int) error {
+	commits, err := rc.recentCommits(repoPath, n)
+	if err != nil {
+		return fmt.Errorf("failed to read git history: %w", err)
+	}
+
+	fmt.Fprintf(w, "Project History [last %d commits for %s]\n", len(commits), cmp.Or(repoPath, "."))
+	for _, c := range commits {
+		fmt.Fprintln(w, c.String())
+	}
+	return nil
+}
+
+// annotateFileHistory sets LastCommit of every file in the tree.
+func (rc *repoContext) annotateFileHistory(root *TreeNode) error {
+	byRepoPath := make(map[string][]*TreeNode)
+	root.walkFiles(func(node *TreeNode) {
+		if p, ok := rc.repoPath(node.Path); ok {
+			byRepoPath[p] = append(byRepoPath[p], node)
+		}
+	})
+
+	repoPaths := make([]string, 0, len(byRepoPath))
+	for p := range byRepoPath {
+		repoPaths = append(repoPaths, p)
+	}
+
+	commits, err := rc.lastCommits(repoPaths)
+	if err != nil {
+		return fmt.Errorf("failed to read git history: %w", err)
+	}
+	for p, c := range commits {
+		for _, node := range byRepoPath[p] {
+			node.LastCommit = c
+		}
+	}
+	return nil
+}
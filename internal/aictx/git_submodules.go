@@ -0,0 +1,158 @@
+package aictx
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-git/go-billy/v5"
+	"github.com/go-git/go-billy/v5/helper/mount"
+	"github.com/go-git/go-billy/v5/helper/polyfill"
+	git "github.com/go-git/go-git/v5"
+)
+
+// MountLocalSubmodules makes the contents of the submodules of the local repository
+// containing inputPath available in fsys. Initialized submodules are already on disk,
+// while uninitialized ones are cloned into memory at the recorded commit and mounted
+// at their paths, so the worktree itself is never modified.
+// fsRoot is the directory fsys is rooted at. Unless authOpts sets GitTokenHost,
+// AICTX_GIT_TOKEN is only sent to the host of the repository's first remote.
+func MountLocalSubmodules(
+	ctx context.Context, fsys billy.Filesystem, fsRoot, inputPath string, authOpts GitAuthOptions,
+) (billy.Filesystem, error) {
+	r, _, err := openLocalRepo(inputPath)
+	if err != nil {
+		return nil, err
+	}
+	if remotes, err := r.Remotes(); err == nil && len(remotes) > 0 && len(remotes[0].Config().URLs) > 0 {
+		authOpts = authOpts.forRepo(remotes[0].Config().URLs[0])
+	}
+
+	absRoot, err := filepath.Abs(fsRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	return mountSubmodules(ctx, fsys, absRoot, r, authOpts)
+}
+
+// mountSubmodules mounts the uninitialized submodules of r into fsys and recurses
+// into the initialized ones.
+func mountSubmodules(
+	ctx context.Context, fsys billy.Filesystem, absRoot string, r *git.Repository, authOpts GitAuthOptions,
+) (billy.Filesystem, error) {
+	wt, err := r.Worktree()
+	if err != nil {
+		return nil, err
+	}
+	submodules, err := wt.Submodules()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read submodules: %w", err)
+	}
+
+	wtRoot := wt.Filesystem.Root()
+	for _, sub := range submodules {
+		subPath := filepath.Join(wtRoot, filepath.FromSlash(sub.Config().Path))
+
+		// Initialized submodules are on disk already: only look for nested ones.
+		if entries, err := os.ReadDir(subPath); err == nil && len(entries) > 0 {
+			subRepo, err := sub.Repository()
+			if err != nil {
+				continue
+			}
+			if fsys, err = mountSubmodules(ctx, fsys, absRoot, subRepo, authOpts); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		mountpoint, err := filepath.Rel(absRoot, subPath)
+		if err != nil || strings.HasPrefix(mountpoint, "..") {
+			// The submodule is outside the processed filesystem.
+			continue
+		}
+
+		subFS, err := cloneSubmodule(ctx, r, sub, authOpts)
+		if err != nil {
+			return nil, err
+		}
+		fsys = polyfill.New(mount.New(fsys, mountpoint, subFS))
+	}
+
+	return fsys, nil
+}
+
+// cloneSubmodule clones the submodule into memory, checks out the commit
+// recorded in the parent repository and then its own submodules.
+func cloneSubmodule(
+	ctx context.Context, parent *git.Repository, sub *git.Submodule, authOpts GitAuthOptions,
+) (billy.Filesystem, error) {
+	subURL, err := resolveSubmoduleURL(parent, sub.Config().URL)
+	if err != nil {
+		return nil, err
+	}
+
+	repo := &GitRepo{URL: subURL}
+	auth, err := ResolveGitAuth(ctx, repo, authOpts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve git credentials for %s: %w", subURL, err)
+	}
+
+	r, subFS, err := cloneGit(ctx, repo, ReadGitOptions{Auth: auth})
+	if err != nil {
+		return nil, fmt.Errorf("failed to clone submodule %s: %w", sub.Config().Path, err)
+	}
+
+	status, err := sub.Status()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read submodule %s status: %w", sub.Config().Path, err)
+	}
+	if !status.Expected.IsZero() {
+		wt, err := r.Worktree()
+		if err != nil {
+			return nil, err
+		}
+		if err := wt.Checkout(&git.CheckoutOptions{Hash: status.Expected, Force: true}); err != nil {
+			return nil, fmt.Errorf("failed to check out submodule %s at %s: %w",
+				sub.Config().Path, status.Expected, err)
+		}
+	}
+	if err := updateSubmodules(ctx, r, "", authOpts, git.DefaultSubmoduleRecursionDepth); err != nil {
+		return nil, err
+	}
+
+	return subFS, nil
+}
+
+// resolveSubmoduleURL resolves relative submodule URLs ("../shared.git")
+// against the URL of the parent repository's first remote.
+func resolveSubmoduleURL(parent *git.Repository, subURL string) (string, error) {
+	if !strings.HasPrefix(subURL, "./") && !strings.HasPrefix(subURL, "../") {
+		return subURL, nil
+	}
+
+	remotes, err := parent.Remotes()
+	if err != nil || len(remotes) == 0 || len(remotes[0].Config().URLs) == 0 {
+		return "", fmt.Errorf("cannot resolve relative submodule URL %s without a remote", subURL)
+	}
+	base := remotes[0].Config().URLs[0]
+
+	switch {
+	case strings.Contains(base, "://"):
+		u, err := url.Parse(base)
+		if err != nil {
+			return "", fmt.Errorf("invalid remote URL %s: %w", base, err)
+		}
+		u.Path = path.Join(u.Path, subURL)
+		return u.String(), nil
+	case scpLikeRe.MatchString(base):
+		host, repoPath, _ := strings.Cut(base, ":")
+		return host + ":" + path.Join(repoPath, subURL), nil
+	default:
+		return filepath.Join(base, filepath.FromSlash(subURL)), nil
+	}
+}
@@ -1,9 +1,28 @@
 package aictx_test
 
 import (
+	"crypto/tls"
+	"net/http"
+	"net/http/cgi"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/amberpixels/aictx/internal/aictx"
+	"github.com/go-git/go-billy/v5/util"
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/format/index"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/transport/client"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -89,3 +108,324 @@ func TestValidateGitRepoName(t *testing.T) {
 		})
 	}
 }
+
+func TestParseGitRepo(t *testing.T) {
+	bareDir := t.TempDir()
+
+	tests := []struct {
+		name         string
+		input        string
+		defaultHost  string
+		expectedRepo *aictx.GitRepo
+		expectError  bool
+	}{
+		{
+			name:        "GitLab nested groups",
+			input:       "gitlab.com/group/sub/repo",
+			defaultHost: aictx.DefaultGitHost,
+			expectedRepo: &aictx.GitRepo{
+				URL:  "https://gitlab.com/group/sub/repo.git",
+				Host: "gitlab.com",
+			},
+		},
+		{
+			name:        "GitLab HTTPS URL with branch",
+			input:       "https://gitlab.com/group/sub/repo@main",
+			defaultHost: aictx.DefaultGitHost,
+			expectedRepo: &aictx.GitRepo{
+				URL:    "https://gitlab.com/group/sub/repo.git",
+				Branch: "main",
+				Host:   "gitlab.com",
+			},
+		},
+		{
+			name:        "Bitbucket shorthand",
+			input:       "bitbucket.org/team/repo.git",
+			defaultHost: aictx.DefaultGitHost,
+			expectedRepo: &aictx.GitRepo{
+				URL:  "https://bitbucket.org/team/repo.git",
+				Host: "bitbucket.org",
+			},
+		},
+		{
+			name:        "self-hosted Gitea as default host",
+			input:       "owner/repo@dev",
+			defaultHost: "git.example.com",
+			expectedRepo: &aictx.GitRepo{
+				URL:    "https://git.example.com/owner/repo.git",
+				Branch: "dev",
+				Host:   "git.example.com",
+			},
+		},
+		{
+			name:        "default host with scheme and port",
+			input:       "owner/repo",
+			defaultHost: "http://gitea.local:3000",
+			expectedRepo: &aictx.GitRepo{
+				URL:  "http://gitea.local:3000/owner/repo.git",
+				Host: "gitea.local",
+			},
+		},
+		{
+			name:        "self-hosted HTTP URL is kept as HTTP",
+			input:       "http://gitea.local:3000/owner/repo",
+			defaultHost: aictx.DefaultGitHost,
+			expectedRepo: &aictx.GitRepo{
+				URL:  "http://gitea.local:3000/owner/repo.git",
+				Host: "gitea.local",
+			},
+		},
+		{
+			name:        "ssh:// URL with user info and branch",
+			input:       "ssh://git@gitea.local:2222/owner/repo.git@feature",
+			defaultHost: aictx.DefaultGitHost,
+			expectedRepo: &aictx.GitRepo{
+				URL:    "ssh://git@gitea.local:2222/owner/repo.git",
+				Branch: "feature",
+				Host:   "gitea.local",
+			},
+		},
+		{
+			name:        "SCP-like SSH URL for GitLab",
+			input:       "git@gitlab.com:group/sub/repo.git",
+			defaultHost: aictx.DefaultGitHost,
+			expectedRepo: &aictx.GitRepo{
+				URL:  "git@gitlab.com:group/sub/repo.git",
+				Host: "gitlab.com",
+			},
+		},
+		{
+			name:        "file:// URL",
+			input:       "file:///srv/git/repo.git@main",
+			defaultHost: aictx.DefaultGitHost,
+			expectedRepo: &aictx.GitRepo{
+				URL:    "file:///srv/git/repo.git",
+				Branch: "main",
+			},
+		},
+		{
+			name:         "local bare repository path",
+			input:        bareDir,
+			defaultHost:  aictx.DefaultGitHost,
+			expectedRepo: &aictx.GitRepo{URL: bareDir},
+		},
+		{
+			name:        "shorthand with subdirectory and branch",
+			input:       "owner/repo/path/to/pkg@dev",
+			defaultHost: aictx.DefaultGitHost,
+			expectedRepo: &aictx.GitRepo{
+				URL:    "https://github.com/owner/repo.git",
+				Branch: "dev",
+				Host:   "github.com",
+				Subdir: "path/to/pkg",
+			},
+		},
+		{
+			name:        "GitHub tree URL",
+			input:       "https://github.com/o/r/tree/main/services/api",
+			defaultHost: aictx.DefaultGitHost,
+			expectedRepo: &aictx.GitRepo{
+				URL:    "https://github.com/o/r.git",
+				Branch: "main",
+				Host:   "github.com",
+				Subdir: "services/api",
+			},
+		},
+		{
+			name:        "GitLab tree URL with nested groups",
+			input:       "https://gitlab.com/group/sub/repo/-/tree/develop/cmd/app",
+			defaultHost: aictx.DefaultGitHost,
+			expectedRepo: &aictx.GitRepo{
+				URL:    "https://gitlab.com/group/sub/repo.git",
+				Branch: "develop",
+				Host:   "gitlab.com",
+				Subdir: "cmd/app",
+			},
+		},
+		{
+			name:        "Gitea src URL",
+			input:       "https://gitea.example.com/team/repo/src/branch/main/docs",
+			defaultHost: aictx.DefaultGitHost,
+			expectedRepo: &aictx.GitRepo{
+				URL:    "https://gitea.example.com/team/repo.git",
+				Branch: "main",
+				Host:   "gitea.example.com",
+				Subdir: "docs",
+			},
+		},
+		{
+			name:        "explicit subdirectory separator for nested groups",
+			input:       "gitlab.com/group/sub/repo//services/api@main",
+			defaultHost: aictx.DefaultGitHost,
+			expectedRepo: &aictx.GitRepo{
+				URL:    "https://gitlab.com/group/sub/repo.git",
+				Branch: "main",
+				Host:   "gitlab.com",
+				Subdir: "services/api",
+			},
+		},
+		{
+			name:        "self-hosted nested groups",
+			input:       "git.corp.com/group/sub/repo",
+			defaultHost: aictx.DefaultGitHost,
+			expectedRepo: &aictx.GitRepo{
+				URL:  "https://git.corp.com/group/sub/repo.git",
+				Host: "git.corp.com",
+			},
+		},
+		{
+			name:        "self-hosted tree URL with nested groups",
+			input:       "https://git.corp.com/group/sub/repo/tree/main/cmd",
+			defaultHost: aictx.DefaultGitHost,
+			expectedRepo: &aictx.GitRepo{
+				URL:    "https://git.corp.com/group/sub/repo.git",
+				Branch: "main",
+				Host:   "git.corp.com",
+				Subdir: "cmd",
+			},
+		},
+		{
+			name:        "shorthand subdirectory named like a web marker",
+			input:       "owner/repo/src/components@main",
+			defaultHost: aictx.DefaultGitHost,
+			expectedRepo: &aictx.GitRepo{
+				URL:    "https://github.com/owner/repo.git",
+				Branch: "main",
+				Host:   "github.com",
+				Subdir: "src/components",
+			},
+		},
+		{
+			name:        "web marker without a branch",
+			input:       "https://github.com/o/r/tree",
+			defaultHost: aictx.DefaultGitHost,
+			expectedRepo: &aictx.GitRepo{
+				URL:    "https://github.com/o/r.git",
+				Host:   "github.com",
+				Subdir: "tree",
+			},
+		},
+		{
+			name:        "HTTPS URL without repository path",
+			input:       "https://gitlab.com/group",
+			defaultHost: aictx.DefaultGitHost,
+			expectError: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			repo, err := aictx.ParseGitRepo(tc.input, tc.defaultHost)
+			if tc.expectError {
+				require.Error(t, err, "expected error for input: %s", tc.input)
+				return
+			}
+			require.NoError(t, err, "unexpected error for input: %s", tc.input)
+			assert.Equal(t, tc.expectedRepo, repo, "repo mismatch for input: %s", tc.input)
+		})
+	}
+}
+
+func TestReadGitSubmoduleOnOtherHost(t *testing.T) {
+	execPath, err := exec.Command("git", "--exec-path").Output()
+	if err != nil {
+		t.Skip("git is not installed")
+	}
+	backend := filepath.Join(strings.TrimSpace(string(execPath)), "git-http-backend")
+
+	// The parent is served on 127.0.0.1, its submodule on localhost: two hosts.
+	parentRoot, subRoot := t.TempDir(), t.TempDir()
+	parentSrv, parentAuths := serveGit(t, backend, parentRoot)
+	subSrv, subAuths := serveGit(t, backend, subRoot)
+	subURL, err := url.Parse(subSrv.URL)
+	require.NoError(t, err)
+	subURL.Host = "localhost:" + subURL.Port()
+
+	subHead := commitFiles(t, filepath.Join(subRoot, "sub"), map[string]string{"sub.go": "package sub\n"}, nil)
+	commitFiles(t, filepath.Join(parentRoot, "parent"), map[string]string{
+		"main.go":     "package main\n",
+		".gitmodules": "[submodule \"sub\"]\n\tpath = sub\n\turl = " + subURL.String() + "/sub\n",
+	}, map[string]plumbing.Hash{"sub": subHead})
+
+	// Trust the self-signed certificates of the test servers.
+	client.InstallProtocol("https", githttp.NewClient(&http.Client{Transport: &http.Transport{
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true}, //nolint:gosec // test servers
+	}}))
+	t.Cleanup(func() { client.InstallProtocol("https", githttp.DefaultClient) })
+
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("NETRC", filepath.Join(t.TempDir(), ".netrc"))
+	t.Setenv("GITHUB_TOKEN", "gh-token")
+	authOpts := aictx.GitAuthOptions{NoCredentialHelper: true, TokenHosts: map[string]string{"127.0.0.1": "github"}}
+
+	repo := &aictx.GitRepo{URL: parentSrv.URL + "/parent"}
+	auth, err := aictx.ResolveGitAuth(t.Context(), repo, authOpts)
+	require.NoError(t, err)
+	require.NotNil(t, auth)
+
+	fsys, err := aictx.ReadGit(t.Context(), repo, aictx.ReadGitOptions{
+		Auth: auth, Submodules: true, SubmoduleAuth: authOpts,
+	})
+	require.NoError(t, err)
+	data, err := util.ReadFile(fsys, "sub/sub.go")
+	require.NoError(t, err)
+	assert.Equal(t, "package sub\n", string(data))
+
+	assert.Contains(t, parentAuths(), "x-access-token:gh-token")
+	assert.NotEmpty(t, subAuths())
+	for _, user := range subAuths() {
+		assert.Empty(t, user, "the parent's token must not reach the submodule's host")
+	}
+}
+
+// serveGit serves the repositories under root over HTTPS with git-http-backend.
+// The returned function lists the basic auth credentials ("user:password") of every request.
+func serveGit(t *testing.T, backend, root string) (*httptest.Server, func() []string) {
+	t.Helper()
+
+	var mu sync.Mutex
+	var auths []string
+	handler := &cgi.Handler{Path: backend, Env: []string{"GIT_PROJECT_ROOT=" + root, "GIT_HTTP_EXPORT_ALL=1"}}
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, password, _ := r.BasicAuth()
+		mu.Lock()
+		auths = append(auths, strings.TrimSuffix(user+":"+password, ":"))
+		mu.Unlock()
+		handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), auths...)
+	}
+}
+
+// commitFiles creates a repository at dir with a single commit of the files and submodule links.
+func commitFiles(t *testing.T, dir string, files map[string]string, links map[string]plumbing.Hash) plumbing.Hash {
+	t.Helper()
+
+	r, err := git.PlainInit(dir, false)
+	require.NoError(t, err)
+	wt, err := r.Worktree()
+	require.NoError(t, err)
+	for name, content := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600))
+		_, err := wt.Add(name)
+		require.NoError(t, err)
+	}
+
+	idx, err := r.Storer.Index()
+	require.NoError(t, err)
+	for path, hash := range links {
+		idx.Entries = append(idx.Entries, &index.Entry{Name: path, Mode: filemode.Submodule, Hash: hash})
+	}
+	require.NoError(t, r.Storer.SetIndex(idx))
+
+	hash, err := wt.Commit("init", &git.CommitOptions{
+		Author: &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()},
+	})
+	require.NoError(t, err)
+	return hash
+}
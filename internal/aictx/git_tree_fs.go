@@ -0,0 +1,255 @@
+package aictx
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-billy/v5"
+	"github.com/go-git/go-billy/v5/helper/chroot"
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// OpenLocalRevision opens the git repository containing inputPath and returns a read-only
+// filesystem serving the tree of the given revision (branch, tag, commit hash, "HEAD~2", ...),
+// together with inputPath translated to a path inside that filesystem.
+// The worktree is never touched.
+func OpenLocalRevision(inputPath, rev string) (billy.Filesystem, string, error) {
+	r, wtRoot, err := openLocalRepo(inputPath)
+	if err != nil {
+		return nil, "", err
+	}
+	absInput, err := filepath.Abs(inputPath)
+	if err != nil {
+		return nil, "", err
+	}
+	relPath, err := filepath.Rel(wtRoot, absInput)
+	if err != nil {
+		return nil, "", err
+	}
+
+	fsys, err := NewGitTreeFS(r, rev)
+	if err != nil {
+		return nil, "", err
+	}
+	return fsys, filepath.ToSlash(relPath), nil
+}
+
+// NewGitTreeFS returns a read-only filesystem serving the tree of the given revision of r.
+func NewGitTreeFS(r *git.Repository, rev string) (billy.Filesystem, error) {
+	hash, err := r.ResolveRevision(plumbing.Revision(rev))
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve revision %s: %w", rev, err)
+	}
+	commit, err := r.CommitObject(*hash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read commit %s: %w", hash, err)
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tree of commit %s: %w", hash, err)
+	}
+	return &gitTreeFS{tree: tree, modTime: commit.Committer.When}, nil
+}
+
+// gitTreeFS is a read-only billy.Filesystem backed by a git tree object.
+// All files report the commit time as their modification time.
+type gitTreeFS struct {
+	tree    *object.Tree
+	modTime time.Time
+}
+
+// cleanTreePath normalizes a billy path to a git tree path ("" being the root).
+func cleanTreePath(filename string) string {
+	p := path.Clean("/" + filepath.ToSlash(filename))
+	return strings.TrimPrefix(p, "/")
+}
+
+func (g *gitTreeFS) Create(string) (billy.File, error) { return nil, billy.ErrReadOnly }
+
+func (g *gitTreeFS) Open(filename string) (billy.File, error) {
+	return g.OpenFile(filename, os.O_RDONLY, 0)
+}
+
+func (g *gitTreeFS) OpenFile(filename string, flag int, _ os.FileMode) (billy.File, error) {
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_CREATE|os.O_APPEND|os.O_TRUNC) != 0 {
+		return nil, billy.ErrReadOnly
+	}
+
+	p := cleanTreePath(filename)
+	file, err := g.tree.File(p)
+	if err != nil {
+		return nil, g.pathError("open", filename, err)
+	}
+	reader, err := file.Reader()
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: filename, Err: err}
+	}
+	return &gitTreeFile{name: filename, file: file, reader: reader}, nil
+}
+
+func (g *gitTreeFS) Stat(filename string) (os.FileInfo, error) {
+	p := cleanTreePath(filename)
+	if p == "" {
+		return &gitTreeFileInfo{name: ".", mode: os.ModeDir | 0o755, modTime: g.modTime}, nil
+	}
+
+	entry, err := g.tree.FindEntry(p)
+	if err != nil {
+		return nil, g.pathError("stat", filename, err)
+	}
+	return g.entryInfo(path.Dir(p), entry)
+}
+
+func (g *gitTreeFS) Lstat(filename string) (os.FileInfo, error) { return g.Stat(filename) }
+
+func (g *gitTreeFS) ReadDir(dirname string) ([]os.FileInfo, error) {
+	p := cleanTreePath(dirname)
+	tree := g.tree
+	if p != "" {
+		entry, err := g.tree.FindEntry(p)
+		if err != nil {
+			return nil, g.pathError("readdir", dirname, err)
+		}
+		if entry.Mode == filemode.Submodule {
+			return nil, nil
+		}
+		if tree, err = g.tree.Tree(p); err != nil {
+			return nil, g.pathError("readdir", dirname, err)
+		}
+	}
+
+	infos := make([]os.FileInfo, 0, len(tree.Entries))
+	for i := range tree.Entries {
+		info, err := g.entryInfo(p, &tree.Entries[i])
+		if err != nil {
+			return nil, err
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+// entryInfo builds the FileInfo for a tree entry located in the directory dir.
+func (g *gitTreeFS) entryInfo(dir string, entry *object.TreeEntry) (os.FileInfo, error) {
+	info := &gitTreeFileInfo{name: entry.Name, modTime: g.modTime}
+
+	switch entry.Mode {
+	case filemode.Dir, filemode.Submodule:
+		// Submodules are shown as (empty) directories, like in a fresh clone.
+		info.mode = os.ModeDir | 0o755
+	default:
+		file, err := g.tree.TreeEntryFile(entry)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", path.Join(dir, entry.Name), err)
+		}
+		info.size = file.Size
+		info.mode, _ = entry.Mode.ToOSFileMode()
+	}
+	return info, nil
+}
+
+// pathError converts go-git lookup errors into os.ErrNotExist based path errors.
+func (g *gitTreeFS) pathError(op, filename string, err error) error {
+	if errors.Is(err, object.ErrFileNotFound) || errors.Is(err, object.ErrDirectoryNotFound) ||
+		errors.Is(err, object.ErrEntryNotFound) {
+		err = os.ErrNotExist
+	}
+	return &os.PathError{Op: op, Path: filename, Err: err}
+}
+
+func (g *gitTreeFS) Rename(string, string) error                 { return billy.ErrReadOnly }
+func (g *gitTreeFS) Remove(string) error                         { return billy.ErrReadOnly }
+func (g *gitTreeFS) Join(elem ...string) string                  { return path.Join(elem...) }
+func (g *gitTreeFS) TempFile(string, string) (billy.File, error) { return nil, billy.ErrReadOnly }
+func (g *gitTreeFS) MkdirAll(string, os.FileMode) error          { return billy.ErrReadOnly }
+func (g *gitTreeFS) Symlink(string, string) error                { return billy.ErrReadOnly }
+func (g *gitTreeFS) Readlink(string) (string, error)             { return "", billy.ErrNotSupported }
+func (g *gitTreeFS) Root() string                                { return "/" }
+
+func (g *gitTreeFS) Chroot(p string) (billy.Filesystem, error) {
+	return chroot.New(g, p), nil
+}
+
+func (g *gitTreeFS) Capabilities() billy.Capability {
+	return billy.ReadCapability | billy.SeekCapability
+}
+
+// gitTreeFile is a read-only file backed by a git blob.
+// Content is streamed; it is loaded into memory only when random access is needed.
+type gitTreeFile struct {
+	name   string
+	file   *object.File
+	reader io.ReadCloser
+	offset int64
+	loaded *bytes.Reader
+}
+
+func (f *gitTreeFile) Name() string { return f.name }
+
+func (f *gitTreeFile) Read(p []byte) (int, error) {
+	if f.loaded != nil {
+		return f.loaded.Read(p)
+	}
+	n, err := f.reader.Read(p)
+	f.offset += int64(n)
+	return n, err
+}
+
+func (f *gitTreeFile) ReadAt(p []byte, off int64) (int, error) {
+	if err := f.load(); err != nil {
+		return 0, err
+	}
+	return f.loaded.ReadAt(p, off)
+}
+
+func (f *gitTreeFile) Seek(offset int64, whence int) (int64, error) {
+	if err := f.load(); err != nil {
+		return 0, err
+	}
+	return f.loaded.Seek(offset, whence)
+}
+
+// load reads the whole blob into memory for random access.
+func (f *gitTreeFile) load() error {
+	if f.loaded != nil {
+		return nil
+	}
+	contents, err := f.file.Contents()
+	if err != nil {
+		return err
+	}
+	f.loaded = bytes.NewReader([]byte(contents))
+	_, err = f.loaded.Seek(f.offset, io.SeekStart)
+	return err
+}
+
+func (f *gitTreeFile) Close() error              { return f.reader.Close() }
+func (f *gitTreeFile) Write([]byte) (int, error) { return 0, billy.ErrReadOnly }
+func (f *gitTreeFile) Truncate(int64) error      { return billy.ErrReadOnly }
+func (f *gitTreeFile) Lock() error               { return nil }
+func (f *gitTreeFile) Unlock() error             { return nil }
+
+// gitTreeFileInfo implements os.FileInfo for tree entries.
+type gitTreeFileInfo struct {
+	name    string
+	size    int64
+	mode    os.FileMode
+	modTime time.Time
+}
+
+func (i *gitTreeFileInfo) Name() string       { return i.name }
+func (i *gitTreeFileInfo) Size() int64        { return i.size }
+func (i *gitTreeFileInfo) Mode() os.FileMode  { return i.mode }
+func (i *gitTreeFileInfo) ModTime() time.Time { return i.modTime }
+func (i *gitTreeFileInfo) IsDir() bool        { return i.mode.IsDir() }
+func (i *gitTreeFileInfo) Sys() any           { return nil }
@@ -0,0 +1,59 @@
+package aictx_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/amberpixels/aictx/internal/aictx"
+	"github.com/go-git/go-billy/v5"
+	"github.com/go-git/go-billy/v5/util"
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpenLocalRevision(t *testing.T) {
+	dir := t.TempDir()
+	r, err := git.PlainInit(dir, false)
+	require.NoError(t, err)
+	wt, err := r.Worktree()
+	require.NoError(t, err)
+
+	writeAndCommit := func(content string) {
+		require.NoError(t, os.MkdirAll(filepath.Join(dir, "pkg"), 0o755))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "pkg", "main.go"), []byte(content), 0o600))
+		_, err := wt.Add("pkg/main.go")
+		require.NoError(t, err)
+		_, err = wt.Commit(content, &git.CommitOptions{
+			Author: &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()},
+		})
+		require.NoError(t, err)
+	}
+	writeAndCommit("package v1\n")
+	writeAndCommit("package v2\n")
+	// Uncommitted changes must not be visible.
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "pkg", "main.go"), []byte("package dirty\n"), 0o600))
+
+	fsys, inputPath, err := aictx.OpenLocalRevision(filepath.Join(dir, "pkg"), "HEAD~1")
+	require.NoError(t, err)
+	assert.Equal(t, "pkg", inputPath)
+
+	entries, err := fsys.ReadDir(inputPath)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "main.go", entries[0].Name())
+	assert.Equal(t, int64(len("package v1\n")), entries[0].Size())
+
+	data, err := util.ReadFile(fsys, "pkg/main.go")
+	require.NoError(t, err)
+	assert.Equal(t, "package v1\n", string(data))
+
+	_, err = fsys.Stat("pkg/missing.go")
+	require.ErrorIs(t, err, os.ErrNotExist)
+
+	_, err = fsys.Create("pkg/new.go")
+	require.ErrorIs(t, err, billy.ErrReadOnly)
+}
@@ -5,7 +5,6 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
-	"unicode/utf8"
 )
 
 const (
@@ -15,10 +14,11 @@ const (
 	MB = 1024 * KB
 )
 
-// fileHeader renders a header for each file.
 // fileHeader renders a header for each file.
 // It now includes a file counter (e.g. "[1/6]" or "[01/12]") inserted into a 60-char line.
-func fileHeader(node *TreeNode, fileNum, totalFiles int) []byte {
+// The line count of the file is shown if known (> 0).
+// Notes are extra lines describing how the content was processed.
+func fileHeader(node *TreeNode, path string, fileNum, totalFiles, lineCount int, notes ...string) []byte {
 	const totalLen = 60 // total characters (without the newline)
 	var buf bytes.Buffer
 
@@ -34,30 +34,47 @@ func fileHeader(node *TreeNode, fileNum, totalFiles int) []byte {
 	headerLine := strings.Repeat("=", left) + numInfo + strings.Repeat("=", right) + "\n"
 
 	buf.WriteString(headerLine)
-	buf.WriteString(fmt.Sprintf("File: %s\n", node.Path))
+	buf.WriteString(fmt.Sprintf("File: %s\n", path))
 	if node.Size > 0 {
 		buf.WriteString(fmt.Sprintf("Size: %s\n", formatSize(node.Size)))
 	}
+	if lineCount > 0 {
+		buf.WriteString(fmt.Sprintf("Lines: %d\n", lineCount))
+	}
+	if node.LastCommit != nil {
+		buf.WriteString(fmt.Sprintf("Last commit: %s\n", node.LastCommit))
+	}
+	for _, note := range notes {
+		buf.WriteString(note + "\n")
+	}
 	buf.WriteString(strings.Repeat("-", totalLen) + "\n")
 	return buf.Bytes()
 }
 
+// countLines returns the number of lines in data. A final line without newline is counted too.
+func countLines(data []byte) int {
+	n := bytes.Count(data, []byte("\n"))
+	if len(data) > 0 && data[len(data)-1] != '\n' {
+		n++
+	}
+	return n
+}
+
 // isHidden returns true if the provided file or folder name starts with a dot.
 func isHidden(name string) bool {
 	return len(name) > 0 && name[0] == '.'
 }
 
-// isBinary returns true if the provided data appears to be binary.
-func isBinary(data []byte) bool {
-	if len(data) == 0 {
-		return false // empty files are considered text
-	}
-	for _, b := range data {
-		if b == 0 {
-			return true
-		}
-	}
-	return !utf8.Valid(data)
+// lfsPointerPrefix is the first line of every Git LFS pointer file.
+const lfsPointerPrefix = "version https://git-lfs.github.com/spec/v1"
+
+// lfsPointerMaxSize is the maximum size of a Git LFS pointer file.
+const lfsPointerMaxSize = KB
+
+// isLFSPointer returns true if the file of the given size starting with head is a Git LFS pointer file
+// (i.e. the real content is stored in LFS and was not fetched).
+func isLFSPointer(head []byte, size int64) bool {
+	return size < lfsPointerMaxSize && bytes.HasPrefix(head, []byte(lfsPointerPrefix))
 }
 
 // formatSize converts bytes to a human-friendly string.
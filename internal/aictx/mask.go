@@ -0,0 +1,226 @@
+package aictx
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Built-in PII detectors.
+const (
+	PIIEmail = "email"
+	PIIPhone = "phone"
+	PIIIP    = "ip"
+	PIIIBAN  = "iban"
+)
+
+// PIIDetectors lists the built-in PII detectors, in the order they are applied:
+// emails and IBANs first, so their digits are not taken for phone numbers.
+//
+//nolint:gochecknoglobals // Hardcoded list.
+var PIIDetectors = []string{PIIEmail, PIIIBAN, PIIIP, PIIPhone}
+
+// maskRule masks the matches of a pattern: a user-defined RedactRule or a PII detector.
+type maskRule struct {
+	// kind names the masked values in placeholders and reports.
+	kind string
+	re   *regexp.Regexp
+	// group is the submatch that is masked (0 for the whole match).
+	group int
+	// replacement is the regexp template replacing matches. Each unique value
+	// is replaced by a stable placeholder if empty.
+	replacement string
+	// files is the glob pattern of the files the rule applies to (all if empty).
+	files string
+	// valid, when set, filters out matches which are not the expected values.
+	valid func(value []byte) bool
+}
+
+// piiRules returns the masking rules of the PII detectors.
+func piiRules() map[string]maskRule {
+	return map[string]maskRule{
+		PIIEmail: {
+			kind: PIIEmail,
+			re:   regexp.MustCompile(`\b[A-Za-z0-9._%+\-]+@[A-Za-z0-9\-]+(?:\.[A-Za-z0-9\-]+)*\.[A-Za-z]{2,}\b`),
+		},
+		PIIIBAN: {
+			kind:  PIIIBAN,
+			re:    regexp.MustCompile(`\b[A-Z]{2}\d{2}(?: ?[A-Z0-9]{4}){2,7}(?: ?[A-Z0-9]{1,3})?\b`),
+			valid: validIBAN,
+		},
+		PIIIP: {
+			kind: PIIIP,
+			re: regexp.MustCompile(`\b(?:(?:25[0-5]|2[0-4]\d|1?\d?\d)\.){3}(?:25[0-5]|2[0-4]\d|1?\d?\d)\b|` +
+				`(?i)\b(?:[0-9a-f]{1,4}:){7}[0-9a-f]{1,4}\b|\b(?:[0-9a-f]{1,4}:){1,6}:(?:[0-9a-f]{1,4}:){0,5}[0-9a-f]{1,4}\b`),
+			valid: func(v []byte) bool {
+				// Loopback and unspecified addresses do not identify anyone.
+				return !slices.Contains([]string{"127.0.0.1", "0.0.0.0", "::1"}, string(v))
+			},
+		},
+		PIIPhone: {
+			kind: PIIPhone,
+			re: regexp.MustCompile(`(?:^|[^\w.+\-])((?:\+\d{1,3}[ .\-]?)?(?:\(\d{2,4}\)[ .\-]?|\d{2,4}[ .\-])` +
+				`\d{3,4}[ .\-]\d{3,4})\b`),
+			group: 1,
+		},
+	}
+}
+
+// validIBAN reports whether the IBAN has a valid ISO 13616 (mod 97) checksum.
+func validIBAN(value []byte) bool {
+	iban := strings.ReplaceAll(string(value), " ", "")
+	rearranged := iban[4:] + iban[:4]
+	var digits strings.Builder
+	for _, r := range rearranged {
+		if r >= 'A' && r <= 'Z' {
+			digits.WriteString(strconv.Itoa(int(r-'A') + 10)) //nolint:mnd // A=10, ..., Z=35
+		} else {
+			digits.WriteRune(r)
+		}
+	}
+	n, ok := new(big.Int).SetString(digits.String(), 10) //nolint:mnd // decimal
+	return ok && n.Mod(n, big.NewInt(97)).Int64() == 1   //nolint:mnd // ISO 13616 checksum
+}
+
+// buildMaskRules compiles the user-defined rules and the enabled PII detectors of the config.
+// All PII detectors are enabled by maskPII if the config doesn't list any.
+func buildMaskRules(cfg *Config, maskPII bool) ([]maskRule, error) {
+	var rules []maskRule
+	for i, r := range cfg.Redact.Rules {
+		if r.Name == "" || r.Pattern == "" {
+			return nil, fmt.Errorf("redact rule #%d: name and pattern are required", i+1)
+		}
+		re, err := regexp.Compile(r.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("redact rule %q: invalid pattern: %w", r.Name, err)
+		}
+		rules = append(rules, maskRule{kind: r.Name, re: re, replacement: r.Replacement, files: r.Files})
+	}
+
+	detectors := cfg.Redact.PII.Detectors
+	if maskPII && len(detectors) == 0 {
+		detectors = PIIDetectors
+	}
+	for _, name := range detectors {
+		if !slices.Contains(PIIDetectors, name) {
+			return nil, fmt.Errorf("unknown PII detector %q (expected one of %s)", name, strings.Join(PIIDetectors, ", "))
+		}
+	}
+	pii := piiRules()
+	for _, name := range PIIDetectors {
+		if slices.Contains(detectors, name) {
+			rule := pii[name]
+			rule.files = cfg.Redact.PII.Files
+			rules = append(rules, rule)
+		}
+	}
+	return rules, nil
+}
+
+// maskContent applies the masking rules matching the file to the rendered data.
+// It returns the masked data and the kinds of the masked values.
+// Masking runs when files are written, in output order, so placeholders are numbered
+// by first appearance whatever the order files were rendered in.
+func (a *App) maskContent(path string, data []byte) ([]byte, []string) {
+	if len(a.maskRules) == 0 {
+		return data, nil
+	}
+	lines, kinds := a.maskLines(path, toLines(data))
+	if len(kinds) == 0 {
+		return data, nil
+	}
+	return joinLines(lines, bytes.HasSuffix(data, []byte("\n"))), kinds
+}
+
+// maskLines applies the masking rules matching the file to the lines.
+// It returns the masked lines and the kinds of the masked values.
+func (a *App) maskLines(path string, lines []sourceLine) ([]sourceLine, []string) {
+	rules := a.maskRulesFor(path)
+	if len(rules) == 0 {
+		return lines, nil
+	}
+
+	var kinds []string
+	result := make([]sourceLine, len(lines))
+	for i, l := range lines {
+		result[i] = sourceLine{Num: l.Num, Text: maskLine(rules, l.Text, a.maskPlaceholder, &kinds)}
+	}
+	return result, kinds
+}
+
+// maskRulesFor returns the masking rules applying to the file.
+func (a *App) maskRulesFor(path string) []maskRule {
+	var rules []maskRule
+	for _, r := range a.maskRules {
+		if r.files == "" || a.matchInputPattern(r.files, path) {
+			rules = append(rules, r)
+		}
+	}
+	return rules
+}
+
+// maskLine applies the masking rules to a line and appends the kinds of the masked values
+// to kinds. Values masked by rules without replacement are replaced by placeholder(kind, value).
+func maskLine(rules []maskRule, text []byte, placeholder func(kind, value string) string, kinds *[]string) []byte {
+	for _, rule := range rules {
+		var n int
+		text, n = replaceMatches(text, rule.re, rule.group, func(m []int) (string, bool) {
+			value := text[m[2*rule.group]:m[2*rule.group+1]]
+			if rule.valid != nil && !rule.valid(value) {
+				return "", false
+			}
+			if rule.replacement != "" {
+				return string(rule.re.Expand(nil, []byte(rule.replacement), text, m)), true
+			}
+			return placeholder(rule.kind, string(value)), true
+		})
+		for range n {
+			*kinds = append(*kinds, rule.kind)
+		}
+	}
+	return text
+}
+
+// matchInputPattern reports whether the path, or the path relative to the input directory,
+// matches any of the comma-separated patterns. Patterns like "testdata/**" then work
+// whatever the input path is.
+func (a *App) matchInputPattern(patterns, path string) bool {
+	if matchAnyPattern(patterns, path) {
+		return true
+	}
+	rel, err := filepath.Rel(a.InputPath, path)
+	return err == nil && !strings.HasPrefix(rel, "..") && matchAnyPattern(patterns, rel)
+}
+
+// maskPlaceholder returns the placeholder of a masked value. Each unique value of a kind
+// gets its own numbered placeholder ("[REDACTED:email-2]"), the same in the whole output.
+func (a *App) maskPlaceholder(kind, value string) string {
+	key := kind + "\x00" + value
+	if p, ok := a.maskPlaceholders[key]; ok {
+		return p
+	}
+	if a.maskPlaceholders == nil {
+		a.maskPlaceholders = make(map[string]string)
+		a.maskCounts = make(map[string]int)
+	}
+	a.maskCounts[kind]++
+	p := redactPlaceholder(fmt.Sprintf("%s-%d", kind, a.maskCounts[kind]))
+	a.maskPlaceholders[key] = p
+	return p
+}
+
+// maskNote returns the header note summarizing the values masked in a file.
+func maskNote(kinds []string) string {
+	var unique []string
+	for _, k := range kinds {
+		if !slices.Contains(unique, k) {
+			unique = append(unique, k)
+		}
+	}
+	return fmt.Sprintf("Masked: %d value(s) (%s)", len(kinds), strings.Join(unique, ", "))
+}
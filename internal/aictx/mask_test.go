@@ -0,0 +1,59 @@
+package aictx_test
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/amberpixels/aictx/internal/aictx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMaskRules(t *testing.T) {
+	dir := t.TempDir()
+	config := `redact:
+  rules:
+    - name: customer-id
+      pattern: 'CUST-\d{6}'
+    - name: card
+      pattern: '(\d{4})-\d{4}-\d{4}-(\d{4})'
+      replacement: '$1-XXXX-XXXX-$2'
+  pii:
+    detectors: [email, ip, iban]
+    files: "fixtures/**"
+`
+	fixture := `id,email,ip,iban,card
+CUST-123456,jane@example.com,10.1.2.3,DE89 3704 0044 0532 0130 00,4111-1111-1111-1234
+CUST-654321,john@example.com,127.0.0.1,DE00 1234 5678 9012 3456 78,
+CUST-123456,jane@example.com,10.1.2.3,,
+`
+	require.NoError(t, os.WriteFile(filepath.Join(dir, aictx.ProjectConfigFile), []byte(config), 0o600))
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "fixtures"), 0o700))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "fixtures", "users.csv"), []byte(fixture), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "main.go"), []byte("// jane@example.com CUST-654321\n"), 0o600))
+
+	var out bytes.Buffer
+	app := &aictx.App{
+		InputPath:       dir,
+		Local:           true,
+		SourceEnabled:   true,
+		SourceThreshold: 1,
+		Raw:             true,
+		Out:             &out,
+	}
+	require.NoError(t, app.Run(context.Background()))
+
+	// Placeholders are stable per value across files. PII is only masked in fixtures,
+	// loopback IPs and IBANs with an invalid checksum are kept.
+	assert.Equal(t, `id,email,ip,iban,card
+[REDACTED:customer-id-1],[REDACTED:email-1],[REDACTED:ip-1],[REDACTED:iban-1],4111-XXXX-XXXX-1234
+[REDACTED:customer-id-2],[REDACTED:email-2],127.0.0.1,DE00 1234 5678 9012 3456 78,
+[REDACTED:customer-id-1],[REDACTED:email-1],[REDACTED:ip-1],,
+
+// jane@example.com [REDACTED:customer-id-2]
+
+`, out.String())
+}
@@ -0,0 +1,360 @@
+package aictx
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"runtime/debug"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/go-git/go-billy/v5"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// defaultMaxTokens is the default token budget of read_files.
+const defaultMaxTokens = 20000
+
+// defaultMaxResults is the default maximum number of search results.
+const defaultMaxResults = 100
+
+// maxResultLine is the maximum length of the lines shown in search results.
+const maxResultLine = 300
+
+// listTreeInput is the input of the list_tree tool.
+type listTreeInput struct {
+	Path    string `json:"path,omitempty"    jsonschema:"directory to list, relative to the project root (the root if empty)"` //nolint:lll
+	Include string `json:"include,omitempty" jsonschema:"comma-separated glob patterns of the files to list"`
+	Exclude string `json:"exclude,omitempty" jsonschema:"comma-separated glob patterns of the files to leave out"`
+}
+
+// readFilesInput is the input of the read_files tool.
+type readFilesInput struct {
+	Path        string   `json:"path,omitempty"         jsonschema:"directory to read, relative to the project root (the root if empty)"`                                        //nolint:lll
+	Files       []string `json:"files,omitempty"        jsonschema:"files to read: glob patterns, line ranges (path:120-240) or declarations (path#Symbol); all files if empty"` //nolint:lll
+	Exclude     string   `json:"exclude,omitempty"      jsonschema:"comma-separated glob patterns of the files to leave out"`                                                    //nolint:lll
+	LineNumbers bool     `json:"line_numbers,omitempty" jsonschema:"prefix lines with their line numbers"`
+	MaxTokens   int      `json:"max_tokens,omitempty"   jsonschema:"approximate token budget: the output is cut at a line boundary beyond it (default 20000)"` //nolint:lll
+}
+
+// searchInput is the input of the search tool.
+type searchInput struct {
+	Query      string `json:"query"                 jsonschema:"text to search for in the project files"`
+	Regexp     bool   `json:"regexp,omitempty"      jsonschema:"treat the query as a regular expression (RE2 syntax)"`
+	IgnoreCase bool   `json:"ignore_case,omitempty" jsonschema:"search case insensitively"`
+	Path       string `json:"path,omitempty"        jsonschema:"directory to search, relative to the project root (the root if empty)"` //nolint:lll
+	Include    string `json:"include,omitempty"     jsonschema:"comma-separated glob patterns of the files to search"`
+	Exclude    string `json:"exclude,omitempty"     jsonschema:"comma-separated glob patterns of the files to leave out"`
+	MaxResults int    `json:"max_results,omitempty" jsonschema:"maximum number of matching lines (default 100)"`
+}
+
+// explainIgnoreInput is the input of the explain_ignore tool.
+type explainIgnoreInput struct {
+	Path string `json:"path" jsonschema:"file or directory to explain, relative to the project root"`
+}
+
+// ServeMCP serves the Model Context Protocol over the transport (stdio for "aictx mcp"), until
+// the client disconnects or ctx is canceled. Its tools list, read and search the files of the
+// (local) input directory, with the options of the app: ignore files, redaction and masking apply.
+func (a *App) ServeMCP(ctx context.Context, transport mcp.Transport) error {
+	s, err := a.newServer()
+	if err != nil {
+		return err
+	}
+	return s.mcpServer().Run(ctx, transport)
+}
+
+// mcpServer returns the MCP server with the tools of the server.
+func (s *server) mcpServer() *mcp.Server {
+	srv := mcp.NewServer(&mcp.Implementation{Name: "aictx", Version: buildVersion()}, nil)
+	mcp.AddTool(srv, &mcp.Tool{
+		Name:        "list_tree",
+		Description: "List the files of the project as a tree, with their sizes. Ignored files are left out.",
+	}, s.listTree)
+	mcp.AddTool(srv, &mcp.Tool{
+		Name: "read_files",
+		Description: "Read project files, each with a header (path, size, line count). Files can be selected " +
+			"by globs, line ranges or declarations. Secrets are redacted.",
+	}, s.readFiles)
+	mcp.AddTool(srv, &mcp.Tool{
+		Name:        "search",
+		Description: "Search the project files for a text or regular expression, returning path:line: text matches.",
+	}, s.search)
+	mcp.AddTool(srv, &mcp.Tool{
+		Name:        "explain_ignore",
+		Description: "Explain why a file or directory is (or is not) included in the tree and source listings.",
+	}, s.explainIgnore)
+	return srv
+}
+
+// buildVersion returns the version of the aictx module, as recorded in the binary.
+func buildVersion() string {
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" {
+		return info.Main.Version
+	}
+	return "(devel)"
+}
+
+// textResult returns the result of a tool call returning text.
+func textResult(text string) *mcp.CallToolResult {
+	return &mcp.CallToolResult{Content: []mcp.Content{&mcp.TextContent{Text: text}}}
+}
+
+func (s *server) listTree(ctx context.Context, _ *mcp.CallToolRequest, in listTreeInput,
+) (*mcp.CallToolResult, any, error) {
+	app, err := s.newApp(in.Path)
+	if err != nil {
+		return nil, nil, err
+	}
+	app.TreeEnabled, app.SourceEnabled = true, false
+	app.narrow(false, in.Include, in.Exclude)
+
+	out, err := app.render(ctx)
+	return textResult(out), nil, err
+}
+
+func (s *server) readFiles(ctx context.Context, _ *mcp.CallToolRequest, in readFilesInput,
+) (*mcp.CallToolResult, any, error) {
+	app, err := s.newApp(in.Path)
+	if err != nil {
+		return nil, nil, err
+	}
+	app.TreeEnabled, app.SourceEnabled = false, true
+	app.narrow(true, strings.Join(in.Files, ","), in.Exclude)
+	app.LineNumbers = app.LineNumbers || in.LineNumbers
+	tokens := cmp.Or(in.MaxTokens, defaultMaxTokens)
+	app.MaxOutputSize = float64(tokens*bytesPerToken) / MB
+
+	out, err := app.render(ctx)
+	return textResult(out), nil, err
+}
+
+func (s *server) search(ctx context.Context, _ *mcp.CallToolRequest, in searchInput,
+) (*mcp.CallToolResult, any, error) {
+	query := in.Query
+	if !in.Regexp {
+		query = regexp.QuoteMeta(query)
+	}
+	if in.IgnoreCase {
+		query = "(?i)" + query
+	}
+	re, err := regexp.Compile(query)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid query: %w", err)
+	}
+
+	app, err := s.newApp(in.Path)
+	if err != nil {
+		return nil, nil, err
+	}
+	app.SourceEnabled = true
+	app.narrow(true, in.Include, in.Exclude)
+
+	var out bytes.Buffer
+	if err := app.search(ctx, re, cmp.Or(in.MaxResults, defaultMaxResults), &out); err != nil {
+		return nil, nil, err
+	}
+	return textResult(out.String()), nil, nil
+}
+
+func (s *server) explainIgnore(ctx context.Context, _ *mcp.CallToolRequest, in explainIgnoreInput,
+) (*mcp.CallToolResult, any, error) {
+	// The ignore files are those of the root.
+	app, err := s.newApp("")
+	if err != nil {
+		return nil, nil, err
+	}
+	path, err := s.resolve(in.Path)
+	if err != nil {
+		return nil, nil, err
+	}
+	fsys, _, err := app.prepare(ctx, newSpinner())
+	if err != nil {
+		return nil, nil, err
+	}
+	explanation, err := app.explain(fsys, path)
+	return textResult(explanation), nil, err
+}
+
+// narrow sets the patterns of a mode for a tool call: the include patterns, if set, replace
+// those of the server, and the exclude patterns are added to them.
+func (a *App) narrow(sourceMode bool, include, exclude string) {
+	modeInclude, modeExclude := &a.TreeInclude, &a.TreeExclude
+	if sourceMode {
+		modeInclude, modeExclude = &a.SourceInclude, &a.SourceExclude
+	}
+	if include != "" {
+		*modeInclude = include
+	}
+	*modeExclude = strings.Trim(cmp.Or(*modeExclude, a.Exclude)+","+exclude, ",")
+}
+
+// render runs the app and returns its output.
+func (a *App) render(ctx context.Context) (string, error) {
+	if err := a.validate(); err != nil {
+		return "", err
+	}
+	var out bytes.Buffer
+	a.Out = &out
+	if err := a.Run(ctx); err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
+
+// search writes the lines of the files allowed in source mode matching re, as path:line: text,
+// up to maxResults. Binary files are skipped, and secrets are redacted (and values masked)
+// as in the output.
+func (a *App) search(ctx context.Context, re *regexp.Regexp, maxResults int, w io.Writer) error {
+	if err := a.validate(); err != nil {
+		return err
+	}
+	fsys, info, err := a.prepare(ctx, newSpinner())
+	if err != nil {
+		return err
+	}
+	root, err := a.walk(ctx, fsys, a.InputPath, info)
+	if err != nil {
+		return err
+	}
+
+	var results int
+	for _, node := range root.files(true) {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		n, err := a.searchFile(fsys, node, re, maxResults-results, w)
+		if err != nil {
+			a.logger().Warnf("Failed to search %s: %s", node.path, err)
+		}
+		if results += n; results >= maxResults {
+			fmt.Fprintf(w, "… [results truncated at %d matches] …\n", maxResults)
+			return nil
+		}
+	}
+	if results == 0 {
+		fmt.Fprintln(w, "No matches.")
+	}
+	return nil
+}
+
+// searchFile writes up to maxResults lines of the file matching re. It returns the number of lines written.
+func (a *App) searchFile(fsys billy.Filesystem, node *walkNode, re *regexp.Regexp, maxResults int,
+	w io.Writer,
+) (int, error) {
+	ct, err := sniffFile(fsys, node.path, node.size)
+	if err != nil || ct.binary || ct.lfs {
+		return 0, err
+	}
+	f, err := fsys.Open(node.path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	var results int
+	var secrets []secretFinding
+	var masked []string
+	lr := lineReader{r: bufio.NewReaderSize(f, streamBufferSize)}
+	redactor := secretRedactor{path: node.path}
+	maskRules := a.maskRulesFor(node.path)
+	for results < maxResults {
+		l, _, _, err := lr.next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return results, err
+		}
+		if !a.NoRedactSecrets {
+			var ok bool
+			if l, ok = redactor.redact(l, &secrets); !ok {
+				continue
+			}
+		}
+		if len(maskRules) > 0 {
+			l.Text = maskLine(maskRules, l.Text, a.maskPlaceholder, &masked)
+		}
+		if re.Match(l.Text) {
+			fmt.Fprintf(w, "%s:%d: %s\n", a.outputPath(node.path), l.Num, shortenLine(l.Text, maxResultLine))
+			results++
+		}
+	}
+	return results, nil
+}
+
+// shortenLine returns the line, cut after about n bytes (at a character boundary).
+func shortenLine(line []byte, n int) []byte {
+	if len(line) <= n {
+		return line
+	}
+	for n > 0 && !utf8.RuneStart(line[n]) {
+		n--
+	}
+	return append(line[:n:n], " …"...)
+}
+
+// explain returns why the file or directory at path is included or not in tree and source mode.
+func (a *App) explain(fsys billy.Filesystem, path string) (string, error) {
+	info, err := fsys.Stat(path)
+	if err != nil {
+		return "", err
+	}
+
+	var sb strings.Builder
+	if info.IsDir() {
+		fmt.Fprintf(&sb, "%s (directory)\n", a.outputPath(path))
+	} else {
+		fmt.Fprintf(&sb, "%s (file, %s)\n", a.outputPath(path), formatSize(info.Size()))
+	}
+	for _, mode := range []struct {
+		name       string
+		sourceMode bool
+		enabled    bool
+	}{
+		{"tree", false, a.TreeEnabled},
+		{"source", true, a.SourceEnabled},
+	} {
+		fmt.Fprintf(&sb, "%s mode: %s\n", mode.name, a.explainMode(fsys, path, info, mode.sourceMode, mode.enabled))
+	}
+	return sb.String(), nil
+}
+
+// explainMode returns why the file or directory at path is included or not in a mode.
+func (a *App) explainMode(fsys billy.Filesystem, path string, info os.FileInfo, sourceMode, enabled bool) string {
+	switch {
+	case !enabled:
+		return "disabled"
+	case path == a.InputPath:
+		return "included (it is the root)"
+	}
+	if rule := a.exclusion(path, sourceMode); rule != "" {
+		return "excluded by " + rule
+	}
+	if info.IsDir() {
+		return "included (its files follow the include and exclude patterns)"
+	}
+	if !a.isIncluded(path, sourceMode) {
+		return "excluded: it matches no include pattern"
+	}
+	if !sourceMode {
+		return "included"
+	}
+
+	switch {
+	case a.skipOversized(info.Size()):
+		return fmt.Sprintf("excluded: it exceeds the source threshold (%s)", formatSize(int64(a.SourceThreshold*MB)))
+	case exceedsThreshold(info.Size(), a.SourceThreshold):
+		return fmt.Sprintf("included, shortened (%s) as it exceeds the source threshold", a.Oversize)
+	}
+	if ct, err := sniffFile(fsys, path, info.Size()); err == nil && (ct.binary || ct.lfs) {
+		return "included, without content (binary file or LFS pointer)"
+	}
+	return "included"
+}
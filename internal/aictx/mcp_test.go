@@ -0,0 +1,85 @@
+package aictx_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/amberpixels/aictx/internal/aictx"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMCP(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		".gitignore":        "generated\n",
+		"main.go":           "package main\n\nfunc main() {\n\tprintln(\"hello\")\n}\n",
+		"config.env":        "API_TOKEN=Zx81kQpL0vT7mW3nB5cR\n",
+		"generated/code.go": "package generated\n",
+	}
+	for name, content := range files {
+		require.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(root, name)), 0o700))
+		require.NoError(t, os.WriteFile(filepath.Join(root, name), []byte(content), 0o600))
+	}
+
+	outside := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(outside, "secret.txt"), []byte("top secret\n"), 0o600))
+	require.NoError(t, os.Symlink(filepath.Join(outside, "secret.txt"), filepath.Join(root, "leak.txt")))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	app := &aictx.App{InputPath: root, TreeEnabled: true, SourceEnabled: true, SourceThreshold: 1}
+	serverTransport, clientTransport := mcp.NewInMemoryTransports()
+	go func() { _ = app.ServeMCP(ctx, serverTransport) }()
+
+	client := mcp.NewClient(&mcp.Implementation{Name: "test", Version: "v1"}, nil)
+	session, err := client.Connect(ctx, clientTransport, nil)
+	require.NoError(t, err)
+	defer session.Close()
+
+	call := func(tool string, args map[string]any) (string, bool) {
+		res, err := session.CallTool(ctx, &mcp.CallToolParams{Name: tool, Arguments: args})
+		require.NoError(t, err)
+		require.Len(t, res.Content, 1)
+		return res.Content[0].(*mcp.TextContent).Text, res.IsError
+	}
+
+	tools, err := session.ListTools(ctx, nil)
+	require.NoError(t, err)
+	var names []string
+	for _, tool := range tools.Tools {
+		names = append(names, tool.Name)
+	}
+	assert.ElementsMatch(t, []string{"list_tree", "read_files", "search", "explain_ignore"}, names)
+
+	tree, _ := call("list_tree", nil)
+	assert.Contains(t, tree, "main.go")
+	assert.NotContains(t, tree, "generated")
+
+	source, _ := call("read_files", map[string]any{"files": []string{"main.go:3-5"}, "line_numbers": true})
+	assert.Contains(t, source, "4 │ \tprintln(\"hello\")")
+	assert.NotContains(t, source, "package main")
+
+	// Search results are redacted like the output.
+	results, _ := call("search", map[string]any{"query": "token", "ignore_case": true})
+	assert.Equal(t, "config.env:1: API_TOKEN=[REDACTED:env-secret]\n", results)
+	results, _ = call("search", map[string]any{"query": "package \\w+$", "regexp": true})
+	assert.Contains(t, results, "main.go:1: package main\n")
+	assert.NotContains(t, results, "generated")
+
+	// Symlinks out of the root are not followed.
+	source, _ = call("read_files", map[string]any{"files": []string{"leak.txt"}})
+	assert.NotContains(t, source, "top secret")
+	results, _ = call("search", map[string]any{"query": "top secret"})
+	assert.Equal(t, "No matches.\n", results)
+
+	explanation, _ := call("explain_ignore", map[string]any{"path": "generated/code.go"})
+	assert.Contains(t, explanation, "generated/code.go (file, 18 B)\n")
+	assert.Contains(t, explanation, `tree mode: excluded by .aictxignore/.gitignore pattern "generated"`)
+
+	_, isError := call("explain_ignore", map[string]any{"path": "../outside"})
+	assert.True(t, isError)
+}
@@ -0,0 +1,815 @@
+package aictx
+
+import (
+	"bytes"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Symbol is a declaration found in a source file.
+type Symbol struct {
+	// Name is the name of the symbol, qualified by its container ("Circle.Area").
+	Name string
+	// Kind is the kind of declaration ("func", "method", "class", "interface", ...).
+	Kind string
+	// StartLine and EndLine are the 1-based lines the declaration spans (including doc comments
+	// when the outliner knows about them).
+	StartLine int
+	EndLine   int
+	// Signature is the declaration without its body, on a single line.
+	Signature string
+}
+
+// Outliner extracts the outline of the source files of a language.
+type Outliner interface {
+	// Outline returns a condensed version of src: declarations and signatures, with bodies elided.
+	// It returns an empty outline if no declaration is found.
+	Outline(src []byte) ([]byte, error)
+
+	// Symbols returns the declarations found in src.
+	Symbols(src []byte) ([]Symbol, error)
+}
+
+// outliners maps file extensions to their outliners.
+//
+//nolint:gochecknoglobals // Registry of outliners, filled with the built-in ones.
+var outliners = newOutliners()
+
+// RegisterOutliner registers the outliner for the given file extensions (".ts", ".py", ...),
+// replacing the existing ones. It must not be called concurrently with outlining.
+func RegisterOutliner(o Outliner, exts ...string) {
+	for _, ext := range exts {
+		outliners[strings.ToLower(ext)] = o
+	}
+}
+
+// OutlinerFor returns the outliner for the file. Languages without a dedicated outliner
+// get a regex-based fallback matching common declaration keywords.
+func OutlinerFor(path string) Outliner {
+	if o, ok := outliners[strings.ToLower(filepath.Ext(path))]; ok {
+		return o
+	}
+	return fallbackOutliner{}
+}
+
+// Symbol kinds.
+const (
+	kindFunc      = "func"
+	kindMethod    = "method"
+	kindClass     = "class"
+	kindInterface = "interface"
+	kindStruct    = "struct"
+	kindType      = "type"
+)
+
+// outlineBody replaces the elided bodies in outlines.
+const outlineBody = " { ... }"
+
+// goOutliner outlines Go files with go/parser (see goSkeleton).
+type goOutliner struct{}
+
+func (goOutliner) Outline(src []byte) ([]byte, error) { return goSkeleton(src) }
+
+func (goOutliner) Symbols(src []byte) ([]Symbol, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", src, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+
+	// span returns the lines of a node, starting at its doc comment if any.
+	span := func(doc *ast.CommentGroup, node ast.Node) (int, int) {
+		start := node.Pos()
+		if doc != nil {
+			start = doc.Pos()
+		}
+		return fset.Position(start).Line, fset.Position(node.End()).Line
+	}
+	// signature renders the node on a single line.
+	signature := func(node any) string {
+		var buf bytes.Buffer
+		if err := format.Node(&buf, fset, node); err != nil {
+			return ""
+		}
+		return strings.Join(strings.Fields(buf.String()), " ")
+	}
+
+	var symbols []Symbol
+	for _, decl := range file.Decls {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			sym := Symbol{Name: d.Name.Name, Kind: kindFunc}
+			if d.Recv != nil && len(d.Recv.List) > 0 {
+				sym.Name = receiverName(d.Recv.List[0].Type) + "." + d.Name.Name
+				sym.Kind = kindMethod
+			}
+			sym.StartLine, sym.EndLine = span(d.Doc, d)
+			header := *d
+			header.Body, header.Doc = nil, nil
+			sym.Signature = signature(&header)
+			symbols = append(symbols, sym)
+		case *ast.GenDecl:
+			grouped := d.Lparen.IsValid()
+			for _, spec := range d.Specs {
+				doc, node := d.Doc, ast.Node(d)
+				var names []*ast.Ident
+				kind := d.Tok.String()
+				switch s := spec.(type) {
+				case *ast.TypeSpec:
+					names = []*ast.Ident{s.Name}
+					switch s.Type.(type) {
+					case *ast.StructType:
+						kind = kindStruct
+					case *ast.InterfaceType:
+						kind = kindInterface
+					}
+					if grouped {
+						doc, node = s.Doc, s
+					}
+				case *ast.ValueSpec:
+					names = s.Names
+					if grouped {
+						doc, node = s.Doc, s
+					}
+				default:
+					continue
+				}
+				start, end := span(doc, node)
+				for _, name := range names {
+					symbols = append(symbols, Symbol{
+						Name:      name.Name,
+						Kind:      kind,
+						StartLine: start,
+						EndLine:   end,
+						Signature: d.Tok.String() + " " + name.Name,
+					})
+				}
+			}
+		}
+	}
+	return symbols, nil
+}
+
+// receiverName returns the base type name of a method receiver.
+func receiverName(expr ast.Expr) string {
+	for {
+		switch t := expr.(type) {
+		case *ast.StarExpr:
+			expr = t.X
+		case *ast.IndexExpr:
+			expr = t.X
+		case *ast.IndexListExpr:
+			expr = t.X
+		case *ast.Ident:
+			return t.Name
+		default:
+			return ""
+		}
+	}
+}
+
+// declPattern recognizes a declaration from the first line of a statement.
+type declPattern struct {
+	// re is matched against the trimmed line, with comments and string contents masked.
+	// The "name" group is the symbol name; the optional "kind" group overrides kind.
+	re   *regexp.Regexp
+	kind string
+	// container declarations have members which are outlined too (classes, namespaces, ...).
+	container bool
+	// member declarations are only recognized inside containers (methods).
+	member bool
+}
+
+// braceOutliner outlines languages with C-like blocks, by recognizing declarations
+// line by line and matching braces on the masked source.
+type braceOutliner struct {
+	syntax *commentSyntax
+	// verbatim matches lines kept as they are at any level (imports, annotations, attributes).
+	verbatim *regexp.Regexp
+	decls    []declPattern
+	// keywords can't be member names: they are statements looking like method declarations.
+	keywords []string
+}
+
+func (o *braceOutliner) Outline(src []byte) ([]byte, error) {
+	p := o.parse(src)
+	if len(p.symbols) == 0 {
+		return nil, nil
+	}
+	return p.out.Bytes(), nil
+}
+
+func (o *braceOutliner) Symbols(src []byte) ([]Symbol, error) {
+	return o.parse(src).symbols, nil
+}
+
+// parse outlines src and collects its symbols.
+func (o *braceOutliner) parse(src []byte) *braceParser {
+	p := &braceParser{
+		outliner: o,
+		src:      src,
+		masked:   maskLiterals(o.syntax, src),
+		lines:    lineStarts(src),
+	}
+	p.block(0, len(src), "", false)
+	return p
+}
+
+// match returns the declaration pattern matching the (masked, trimmed) line.
+func (o *braceOutliner) match(line []byte, inContainer bool) (declPattern, string, string, bool) {
+	for _, d := range o.decls {
+		if d.member && !inContainer {
+			continue
+		}
+		m := d.re.FindSubmatch(line)
+		if m == nil {
+			continue
+		}
+		name := string(m[d.re.SubexpIndex("name")])
+		if d.member && slices.Contains(o.keywords, name) {
+			continue
+		}
+		kind := d.kind
+		if i := d.re.SubexpIndex("kind"); i >= 0 && len(m[i]) > 0 {
+			kind = strings.Fields(string(m[i]))[0]
+		}
+		if inContainer && kind == kindFunc {
+			kind = kindMethod
+		}
+		return d, strings.TrimSpace(name), kind, true
+	}
+	return declPattern{}, "", "", false
+}
+
+// braceParser is the state of a braceOutliner run.
+type braceParser struct {
+	outliner *braceOutliner
+	src      []byte
+	masked   []byte
+	lines    []int // offsets of the line starts
+
+	out      bytes.Buffer
+	separate bool // blank lines were skipped since the last write
+	symbols  []Symbol
+}
+
+// block outlines the statements in src[start:end].
+func (p *braceParser) block(start, end int, prefix string, inContainer bool) {
+	o := p.outliner
+	for i := start; i < end; {
+		le := p.lineEnd(i, end)
+		line := bytes.TrimSpace(p.masked[i:le])
+		if len(line) == 0 || line[0] == '}' {
+			p.separate = p.separate || len(bytes.TrimSpace(p.src[i:le])) == 0
+			i = le + 1
+			continue
+		}
+
+		if o.verbatim != nil && o.verbatim.Match(line) {
+			i = p.verbatim(i, end)
+			continue
+		}
+
+		if d, name, kind, ok := o.match(line, inContainer); ok {
+			i = p.decl(i, end, d, name, kind, prefix)
+			continue
+		}
+
+		// Other statements: kept in containers (fields, properties, enum members),
+		// skipped at the top level.
+		if brace := p.openBrace(i, le); brace >= 0 {
+			if inContainer {
+				p.writeHeader(i, brace)
+			}
+			i = p.lineEnd(p.matchBrace(brace), end) + 1
+			continue
+		}
+		if inContainer {
+			i = p.verbatim(i, end)
+			continue
+		}
+		i = le + 1
+	}
+}
+
+// decl outlines the declaration starting at i and returns the offset following it.
+func (p *braceParser) decl(i, end int, d declPattern, name, kind, prefix string) int {
+	sym := Symbol{Name: prefix + name, Kind: kind, StartLine: p.lineOf(i)}
+
+	body := p.findBody(i, end)
+	if body < 0 || p.masked[body] != '{' {
+		// A declaration without body (abstract method, type alias, expression body, ...).
+		stmtEnd := p.lineEnd(max(body, i), end)
+		sym.EndLine = p.lineOf(stmtEnd)
+		sym.Signature = collapseSpaces(p.src[i:stmtEnd])
+		p.symbols = append(p.symbols, sym)
+		p.write(p.src[i:stmtEnd])
+		return stmtEnd + 1
+	}
+
+	closing := p.matchBrace(body)
+	sym.EndLine = p.lineOf(closing)
+	sym.Signature = collapseSpaces(p.src[i:body])
+	p.symbols = append(p.symbols, sym)
+
+	switch {
+	case d.container && p.lineOf(closing) == p.lineOf(body):
+		// Single line containers (enum Color { RED, GREEN }) are kept as they are.
+		p.write(p.src[i:p.lineEnd(closing, end)])
+	case d.container:
+		p.write(p.src[i : body+1])
+		memberPrefix := name
+		if kind == "impl" {
+			// impl Trait for Type: members belong to Type.
+			if _, typ, ok := strings.Cut(name, " for "); ok {
+				memberPrefix = typ
+			}
+			memberPrefix, _, _ = strings.Cut(memberPrefix, "<")
+		}
+		p.block(body+1, closing, prefix+strings.TrimSpace(memberPrefix)+".", true)
+		p.write([]byte(indentString(p.src[i:]) + "}"))
+	default:
+		p.writeHeader(i, body)
+	}
+	return p.lineEnd(closing, end) + 1
+}
+
+// verbatim writes the statement starting at i as is and returns the offset following it.
+// The statement ends at the end of the line where all brackets are closed.
+func (p *braceParser) verbatim(i, end int) int {
+	depth := 0
+	for j := i; j < end; j++ {
+		switch p.masked[j] {
+		case '(', '[', '{':
+			depth++
+		case ')', ']', '}':
+			depth--
+		case '\n':
+			if depth <= 0 {
+				p.write(p.src[i:j])
+				return j + 1
+			}
+		}
+	}
+	p.write(p.src[i:end])
+	return end
+}
+
+// writeHeader writes src[start:brace] followed by an elided body.
+func (p *braceParser) writeHeader(start, brace int) {
+	header := bytes.TrimRight(p.src[start:brace], " \t\r\n")
+	// Copy the header: appending to it would overwrite the source.
+	p.write(append(slices.Clip(header), outlineBody...))
+}
+
+// write writes b as one or more lines.
+func (p *braceParser) write(b []byte) {
+	writeOutline(&p.out, &p.separate, b)
+}
+
+// writeOutline writes b as one or more lines to the outline. A blank line is written first
+// if separate is set (blank lines were found in the source since the last write), unless
+// the outline is empty or b is the first line of a block.
+func writeOutline(out *bytes.Buffer, separate *bool, b []byte) {
+	if *separate && out.Len() > 0 {
+		last := bytes.TrimRight(out.Bytes(), " \t\r\n")
+		if !bytes.HasSuffix(last, []byte("{")) && !bytes.HasSuffix(last, []byte(":")) {
+			out.WriteByte('\n')
+		}
+	}
+	*separate = false
+	out.Write(bytes.TrimRight(b, " \t\r\n"))
+	out.WriteByte('\n')
+}
+
+// findBody returns the offset of the first "{" or ";" outside of parentheses, or -1.
+func (p *braceParser) findBody(i, end int) int {
+	depth := 0
+	for j := i; j < end; j++ {
+		switch p.masked[j] {
+		case '(', '[':
+			depth++
+		case ')', ']':
+			depth--
+		case '{', ';':
+			if depth <= 0 {
+				return j
+			}
+		}
+	}
+	return -1
+}
+
+// openBrace returns the offset of the first "{" in masked[start:le] closed after le, or -1.
+func (p *braceParser) openBrace(start, le int) int {
+	for j := start; j < le; j++ {
+		if p.masked[j] == '{' && p.matchBrace(j) >= le {
+			return j
+		}
+	}
+	return -1
+}
+
+// matchBrace returns the offset of the "}" closing the "{" at open (the end of the source if unclosed).
+func (p *braceParser) matchBrace(open int) int {
+	depth := 0
+	for j := open; j < len(p.masked); j++ {
+		switch p.masked[j] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return j
+			}
+		}
+	}
+	return len(p.masked) - 1
+}
+
+// lineEnd returns the offset of the newline ending the line containing i (or end).
+func (p *braceParser) lineEnd(i, end int) int {
+	if j := bytes.IndexByte(p.src[i:end], '\n'); j >= 0 {
+		return i + j
+	}
+	return end
+}
+
+// lineOf returns the 1-based line of the offset.
+func (p *braceParser) lineOf(offset int) int {
+	return sort.SearchInts(p.lines, offset+1)
+}
+
+// lineStarts returns the offsets of the line starts of src.
+func lineStarts(src []byte) []int {
+	starts := []int{0}
+	for i, c := range src {
+		if c == '\n' && i+1 < len(src) {
+			starts = append(starts, i+1)
+		}
+	}
+	return starts
+}
+
+// collapseSpaces trims b and replaces runs of whitespace with single spaces.
+func collapseSpaces(b []byte) string {
+	return strings.Join(strings.Fields(string(b)), " ")
+}
+
+// indentString returns the leading whitespace of b.
+func indentString(b []byte) string {
+	return string(b[:indentOf(b)])
+}
+
+// Modifier and type fragments of the brace languages patterns.
+const (
+	jsExport    = `^(?:export\s+)?(?:default\s+)?(?:declare\s+)?`
+	javaMods    = `^(?:(?:public|protected|private|static|final|abstract|sealed|non-sealed|strictfp|synchronized|native|default|transient|volatile)\s+)*`             //nolint:lll
+	csharpMods  = `^(?:(?:public|protected|private|internal|static|virtual|override|abstract|sealed|async|extern|unsafe|new|partial|readonly|ref|file|required)\s+)*` //nolint:lll
+	rustVis     = `^(?:pub(?:\([^)]*\))?\s+)?`
+	typedMember = `(?:<[^>]+>\s+)?(?:[\w.$]+(?:<[^()]*>)?\??(?:\[\])*\s+)?(?P<name>[\w$]+)\s*(?:<[^()]*>)?\s*\(`
+)
+
+// newOutliners builds the table of built-in outliners.
+func newOutliners() map[string]Outliner {
+	syntax := func(ext string) *commentSyntax { return commentSyntaxes[ext] }
+	controlKeywords := []string{
+		"if", "for", "foreach", "while", "switch", "catch", "return", "new", "throw", "else",
+		"function", "using", "lock", "fixed", "synchronized", "do", "try", "await", "yield",
+	}
+
+	ts := &braceOutliner{
+		syntax:   syntax(".ts"),
+		verbatim: regexp.MustCompile(`^(?:import\b|export\s+(?:\*|\{[^}]*\}?)\s*(?:from\b|$)|@)`),
+		decls: []declPattern{
+			{re: regexp.MustCompile(jsExport + `(?:abstract\s+)?(?P<kind>class)\s+(?P<name>[\w$]+)`), kind: kindClass, container: true},
+			{re: regexp.MustCompile(jsExport + `(?P<kind>interface)\s+(?P<name>[\w$]+)`), kind: kindInterface, container: true},
+			{re: regexp.MustCompile(jsExport + `(?:const\s+)?(?P<kind>enum)\s+(?P<name>[\w$]+)`), kind: "enum", container: true},
+			{re: regexp.MustCompile(jsExport + `(?P<kind>namespace|module)\s+(?P<name>[\w$.]+)`), kind: "namespace", container: true},
+			{re: regexp.MustCompile(jsExport + `type\s+(?P<name>[\w$]+)`), kind: kindType},
+			{re: regexp.MustCompile(jsExport + `(?:async\s+)?function\s*\*?\s*(?P<name>[\w$]+)`), kind: kindFunc},
+			{
+				re: regexp.MustCompile(jsExport + `(?:const|let|var)\s+(?P<name>[\w$]+)\s*(?::[^=]+)?=\s*(?:async\s+)?` +
+					`(?:function\b|(?:\([^)]*\)|[\w$]+)\s*(?::[^=]+)?=>)`),
+				kind: kindFunc,
+			},
+			{
+				re: regexp.MustCompile(`^(?:(?:public|private|protected|static|readonly|async|abstract|override|declare|get|set)\s+)*` +
+					`\*?(?P<name>#?[\w$]+)\s*\??\s*(?:<[^>]*>)?\s*\(`),
+				kind:   kindMethod,
+				member: true,
+			},
+		},
+		keywords: controlKeywords,
+	}
+	js := *ts
+	js.syntax = syntax(".js")
+
+	java := &braceOutliner{
+		syntax:   syntax(".java"),
+		verbatim: regexp.MustCompile(`^(?:import|package)\s|^@\w+(?:\(.*\))?$`),
+		decls: []declPattern{
+			{
+				re:        regexp.MustCompile(javaMods + `(?P<kind>class|interface|enum|record|@interface)\s+(?P<name>\w+)`),
+				kind:      kindClass,
+				container: true,
+			},
+			{re: regexp.MustCompile(javaMods + typedMember), kind: kindMethod, member: true},
+		},
+		keywords: controlKeywords,
+	}
+
+	csharp := &braceOutliner{
+		syntax:   syntax(".cs"),
+		verbatim: regexp.MustCompile(`^(?:using\s|global\s+using\s|\[)`),
+		decls: []declPattern{
+			{re: regexp.MustCompile(`^(?P<kind>namespace)\s+(?P<name>[\w.]+)`), kind: "namespace", container: true},
+			{
+				re: regexp.MustCompile(csharpMods +
+					`(?P<kind>record\s+struct|record\s+class|class|interface|struct|record|enum)\s+(?P<name>\w+)`),
+				kind:      kindClass,
+				container: true,
+			},
+			{re: regexp.MustCompile(csharpMods + typedMember), kind: kindMethod, member: true},
+		},
+		keywords: controlKeywords,
+	}
+
+	rust := &braceOutliner{
+		syntax:   syntax(".rs"),
+		verbatim: regexp.MustCompile(`^(?:(?:pub(?:\([^)]*\))?\s+)?use\s|extern\s+crate\s|#!?\[)`),
+		decls: []declPattern{
+			{
+				re: regexp.MustCompile(rustVis + `(?:default\s+)?(?:const\s+)?(?:async\s+)?(?:unsafe\s+)?` +
+					`(?:extern\s+(?:"[^"]*"\s+)?)?fn\s+(?P<name>\w+)`),
+				kind: kindFunc,
+			},
+			{re: regexp.MustCompile(rustVis + `(?P<kind>struct|enum|union)\s+(?P<name>\w+)`), kind: kindStruct, container: true},
+			{re: regexp.MustCompile(rustVis + `(?:unsafe\s+)?(?P<kind>trait)\s+(?P<name>\w+)`), kind: "trait", container: true},
+			{
+				re:        regexp.MustCompile(`^(?:unsafe\s+)?(?P<kind>impl)\b(?:\s*<[^{]*?>)?\s+(?P<name>[^{]+?)\s*(?:\bwhere\b[^{]*)?\{?$`),
+				kind:      "impl",
+				container: true,
+			},
+			{re: regexp.MustCompile(rustVis + `(?P<kind>mod)\s+(?P<name>\w+)`), kind: "module", container: true},
+			{re: regexp.MustCompile(rustVis + `type\s+(?P<name>\w+)`), kind: kindType},
+			{re: regexp.MustCompile(`^macro_rules!\s*(?P<name>\w+)`), kind: "macro"},
+		},
+	}
+
+	result := map[string]Outliner{
+		".go": goOutliner{},
+		".rs": rust,
+		".py": pythonOutliner{}, ".pyi": pythonOutliner{},
+		".java": java,
+		".cs":   csharp,
+	}
+	for _, ext := range []string{".ts", ".tsx", ".mts", ".cts"} {
+		result[ext] = ts
+	}
+	for _, ext := range []string{".js", ".jsx", ".mjs", ".cjs"} {
+		result[ext] = &js
+	}
+	return result
+}
+
+//nolint:gochecknoglobals // Hardcoded patterns.
+var (
+	pyDeclRe   = regexp.MustCompile(`^(?:async\s+)?(?P<kind>def|class)\s+(?P<name>\w+)`)
+	pyImportRe = regexp.MustCompile(`^(?:import|from)\s`)
+	pyFieldRe  = regexp.MustCompile(`^\w+\s*(?::[^=]+)?=|^\w+\s*:\s*\S`)
+)
+
+// pythonOutliner outlines Python files based on indentation.
+type pythonOutliner struct{}
+
+func (o pythonOutliner) Outline(src []byte) ([]byte, error) {
+	p := o.parse(src)
+	if len(p.symbols) == 0 {
+		return nil, nil
+	}
+	return p.out.Bytes(), nil
+}
+
+func (o pythonOutliner) Symbols(src []byte) ([]Symbol, error) {
+	return o.parse(src).symbols, nil
+}
+
+func (pythonOutliner) parse(src []byte) *pythonParser {
+	masked := maskLiterals(commentSyntaxes[".py"], src)
+	p := &pythonParser{
+		src:    bytes.Split(src, []byte("\n")),
+		masked: bytes.Split(masked, []byte("\n")),
+	}
+	p.block(0, len(p.src), "", false)
+	return p
+}
+
+// pythonParser is the state of a pythonOutliner run, working on lines.
+type pythonParser struct {
+	src    [][]byte
+	masked [][]byte
+
+	out      bytes.Buffer
+	separate bool // blank lines were skipped since the last write
+	symbols  []Symbol
+}
+
+// block outlines the lines [from, to).
+func (p *pythonParser) block(from, to int, prefix string, inClass bool) {
+	decorators := -1
+	bodyIndent := -1
+	for i := from; i < to; {
+		line := bytes.TrimSpace(p.masked[i])
+		if len(line) == 0 {
+			p.separate = p.separate || len(bytes.TrimSpace(p.src[i])) == 0
+			i++
+			continue
+		}
+		indent := indentOf(p.masked[i])
+		if bodyIndent < 0 {
+			bodyIndent = indent
+		}
+
+		if line[0] == '@' {
+			if decorators < 0 {
+				decorators = i
+			}
+			i++
+			continue
+		}
+
+		if m := pyDeclRe.FindSubmatch(line); m != nil {
+			i = p.decl(i, to, decorators, string(m[pyDeclRe.SubexpIndex("kind")]),
+				string(m[pyDeclRe.SubexpIndex("name")]), prefix, inClass)
+			decorators = -1
+			continue
+		}
+		decorators = -1
+
+		end := p.statementEnd(i, to)
+		switch {
+		case !inClass && indent == 0 && pyImportRe.Match(line),
+			inClass && indent == bodyIndent && pyFieldRe.Match(line):
+			for j := i; j <= end; j++ {
+				p.writeLine(p.src[j])
+			}
+		}
+		i = end + 1
+	}
+}
+
+// decl outlines the def or class at line i and returns the line following its body.
+func (p *pythonParser) decl(i, to, decorators int, kind, name, prefix string, inClass bool) int {
+	start := i
+	if decorators >= 0 {
+		start = decorators
+	}
+	indent := indentOf(p.masked[i])
+
+	// The header ends at the ":" closing the signature.
+	headerEnd, colon := i, -1
+	depth := 0
+scan:
+	for j := i; j < to; j++ {
+		for k, c := range p.masked[j] {
+			switch c {
+			case '(', '[', '{':
+				depth++
+			case ')', ']', '}':
+				depth--
+			case ':':
+				if depth == 0 {
+					headerEnd, colon = j, k
+					break scan
+				}
+			}
+		}
+	}
+
+	// The body runs until the first line indented like the declaration (or less).
+	end, last := headerEnd+1, headerEnd
+	for ; end < to; end++ {
+		if len(bytes.TrimSpace(p.masked[end])) == 0 {
+			continue
+		}
+		if indentOf(p.masked[end]) <= indent {
+			break
+		}
+		last = end
+	}
+
+	var header bytes.Buffer
+	for j := i; j < headerEnd; j++ {
+		header.Write(p.src[j])
+		header.WriteByte('\n')
+	}
+	if colon >= 0 {
+		header.Write(p.src[headerEnd][:colon+1])
+	} else {
+		header.Write(p.src[headerEnd])
+	}
+
+	symKind := kindFunc
+	switch {
+	case kind == "class":
+		symKind = kindClass
+	case inClass:
+		symKind = kindMethod
+	}
+	p.symbols = append(p.symbols, Symbol{
+		Name:      prefix + name,
+		Kind:      symKind,
+		StartLine: start + 1,
+		EndLine:   last + 1,
+		Signature: collapseSpaces(header.Bytes()),
+	})
+
+	for j := start; j < i; j++ {
+		p.writeLine(p.src[j])
+	}
+	if kind == "class" {
+		p.writeLine(header.Bytes())
+		size := p.out.Len()
+		p.block(headerEnd+1, end, prefix+name+".", true)
+		if p.out.Len() == size {
+			p.writeLine([]byte(strings.Repeat(" ", indent+4) + "..."))
+		}
+	} else {
+		p.writeLine(append(header.Bytes(), " ..."...))
+	}
+
+	// Blank lines after the body separate it from the next declaration.
+	p.separate = end > last+1
+	return end
+}
+
+// statementEnd returns the last line of the statement starting at line i (brackets may span lines).
+func (p *pythonParser) statementEnd(i, to int) int {
+	depth := 0
+	for j := i; j < to; j++ {
+		for _, c := range p.masked[j] {
+			switch c {
+			case '(', '[', '{':
+				depth++
+			case ')', ']', '}':
+				depth--
+			}
+		}
+		if depth <= 0 && !bytes.HasSuffix(bytes.TrimRight(p.masked[j], " \t\r"), []byte("\\")) {
+			return j
+		}
+	}
+	return to - 1
+}
+
+func (p *pythonParser) writeLine(b []byte) {
+	writeOutline(&p.out, &p.separate, b)
+}
+
+// fallbackDeclRe matches common declaration keywords of languages without a dedicated outliner.
+//
+//nolint:gochecknoglobals // Hardcoded pattern.
+var fallbackDeclRe = regexp.MustCompile(`^\s*(?:(?:export|public|private|protected|internal|static|async|pub|abstract|` +
+	`final|override|open|inline|local|data|sealed)\s+)*` +
+	`(?P<kind>function|func|fun|fn|def|class|interface|struct|enum|trait|module|object|protocol|extension|sub|proc)\s+` +
+	`(?P<name>[\w$.:]+)`)
+
+// fallbackOutliner keeps the lines starting with a declaration keyword.
+type fallbackOutliner struct{}
+
+func (o fallbackOutliner) Outline(src []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	for _, line := range bytes.Split(src, []byte("\n")) {
+		if fallbackDeclRe.Match(line) {
+			buf.Write(bytes.TrimRight(line, " \t\r"))
+			buf.WriteByte('\n')
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+func (o fallbackOutliner) Symbols(src []byte) ([]Symbol, error) {
+	var symbols []Symbol
+	for i, line := range bytes.Split(src, []byte("\n")) {
+		m := fallbackDeclRe.FindSubmatch(line)
+		if m == nil {
+			continue
+		}
+		symbols = append(symbols, Symbol{
+			Name:      string(m[fallbackDeclRe.SubexpIndex("name")]),
+			Kind:      string(m[fallbackDeclRe.SubexpIndex("kind")]),
+			StartLine: i + 1,
+			EndLine:   i + 1,
+			Signature: collapseSpaces(line),
+		})
+	}
+	return symbols, nil
+}
@@ -0,0 +1,166 @@
+package aictx_test
+
+import (
+	"testing"
+
+	"github.com/amberpixels/aictx/internal/aictx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOutliners(t *testing.T) {
+	type symbol struct {
+		name       string
+		kind       string
+		start, end int
+	}
+
+	tests := []struct {
+		name     string
+		file     string
+		src      string
+		outline  string
+		expected []symbol
+	}{
+		{
+			name: "typescript",
+			file: "shape.ts",
+			src: `import { x } from "./x";
+
+export class Circle {
+  private r = 1;
+
+  area(): number {
+    if (this.r > 0) { return "}"; }
+    return 0;
+  }
+}
+
+export function helper(a: string) {
+  return a;
+}
+`,
+			outline: `import { x } from "./x";
+
+export class Circle {
+  private r = 1;
+
+  area(): number { ... }
+}
+
+export function helper(a: string) { ... }
+`,
+			expected: []symbol{
+				{"Circle", "class", 3, 10},
+				{"Circle.area", "method", 6, 9},
+				{"helper", "func", 12, 14},
+			},
+		},
+		{
+			name: "python",
+			file: "point.py",
+			src: `import os
+
+class Point:
+    x: int = 0
+
+    def dist(self, other):
+        """Distance."""
+        return 0.0
+
+def top(a, b={"k": 1}):
+    return a
+`,
+			outline: `import os
+
+class Point:
+    x: int = 0
+
+    def dist(self, other): ...
+
+def top(a, b={"k": 1}): ...
+`,
+			expected: []symbol{
+				{"Point", "class", 3, 8},
+				{"Point.dist", "method", 6, 8},
+				{"top", "func", 10, 11},
+			},
+		},
+		{
+			name: "rust",
+			file: "lib.rs",
+			src: `pub struct Point { x: i32 }
+
+impl fmt::Display for Point {
+    fn fmt(&self, f: &mut fmt::Formatter) -> fmt::Result {
+        write!(f, "{}", self.x)
+    }
+}
+`,
+			outline: `pub struct Point { x: i32 }
+
+impl fmt::Display for Point {
+    fn fmt(&self, f: &mut fmt::Formatter) -> fmt::Result { ... }
+}
+`,
+			expected: []symbol{
+				{"Point", "struct", 1, 1},
+				{"fmt::Display for Point", "impl", 3, 7},
+				{"Point.fmt", "method", 4, 6},
+			},
+		},
+		{
+			name: "go",
+			file: "main.go",
+			src: `package main
+
+// Circle is round.
+type Circle struct{ R float64 }
+
+// Area returns the area.
+func (c *Circle) Area() float64 {
+	return c.R * c.R
+}
+`,
+			expected: []symbol{
+				{"Circle", "struct", 3, 4},
+				{"Circle.Area", "method", 6, 9},
+			},
+		},
+		{
+			name: "fallback",
+			file: "bar.rb",
+			src: `class Bar
+  def baz(x)
+    x
+  end
+end
+`,
+			outline: "class Bar\n  def baz(x)\n",
+			expected: []symbol{
+				{"Bar", "class", 1, 1},
+				{"baz", "def", 2, 2},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outliner := aictx.OutlinerFor(tt.file)
+
+			if tt.outline != "" {
+				outline, err := outliner.Outline([]byte(tt.src))
+				require.NoError(t, err)
+				assert.Equal(t, tt.outline, string(outline))
+			}
+
+			symbols, err := outliner.Symbols([]byte(tt.src))
+			require.NoError(t, err)
+			actual := make([]symbol, 0, len(symbols))
+			for _, s := range symbols {
+				actual = append(actual, symbol{s.Name, s.Kind, s.StartLine, s.EndLine})
+			}
+			assert.Equal(t, tt.expected, actual)
+		})
+	}
+}
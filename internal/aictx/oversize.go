@@ -0,0 +1,47 @@
+package aictx
+
+import "fmt"
+
+// Oversized file handling modes.
+const (
+	// OversizeSkip leaves files exceeding the source threshold out of the source output.
+	OversizeSkip = "skip"
+	// OversizeTruncate emits the first and last lines of files exceeding the source threshold.
+	OversizeTruncate = "truncate"
+	// OversizeOutline emits the outline of files exceeding the source threshold
+	// (or truncates them if they can't be outlined).
+	OversizeOutline = "outline"
+)
+
+// skipOversized returns true if a file of the given size is left out of the source output.
+func (a *App) skipOversized(size int64) bool {
+	return (a.Oversize == "" || a.Oversize == OversizeSkip) && exceedsThreshold(size, a.SourceThreshold)
+}
+
+// truncateRanges returns the ranges of the first head and last tail lines of a file,
+// and the marker emitted between them. It returns nil if no line would be elided.
+func truncateRanges(lineCount, head, tail int) ([]lineRange, string) {
+	head, tail = max(head, 0), max(tail, 0)
+	elided := lineCount - head - tail
+	if elided <= 0 {
+		return nil, ""
+	}
+	var ranges []lineRange
+	if head > 0 {
+		ranges = append(ranges, lineRange{1, head})
+	}
+	if tail > 0 {
+		ranges = append(ranges, lineRange{lineCount - tail + 1, lineCount})
+	}
+	return ranges, fmt.Sprintf("… [%d lines elided] …", elided)
+}
+
+// oversizeTruncateNote returns the header note of an oversized file truncated to the given ranges
+// (see truncateRanges), or emitted in full if ranges is nil.
+func oversizeTruncateNote(ranges []lineRange, head, tail, lineCount int) string {
+	if ranges == nil {
+		return "Oversized: exceeds the source threshold, emitted in full"
+	}
+	return fmt.Sprintf("Oversized: exceeds the source threshold, truncated to first %d and last %d of %d lines",
+		head, tail, lineCount)
+}
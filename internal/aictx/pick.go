@@ -0,0 +1,440 @@
+package aictx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// pickHelp lists the keys of the picker.
+const pickHelp = "↑/↓ move · ←/→ fold · space toggle · / search · enter write · s write and save · q quit"
+
+// pickChrome is the number of lines of the picker besides the rows (header, search, status, help).
+const pickChrome = 5
+
+//nolint:gochecknoglobals // Hardcoded styles.
+var (
+	pickCursorStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("5")).Bold(true)
+	pickFaintStyle  = lipgloss.NewStyle().Faint(true)
+)
+
+// Pick lets the user select the source files in a terminal UI, reading keys from in and drawing to out.
+// The files offered are those of source mode (see Run). On confirmation, the selection replaces the include
+// patterns of the app, and is saved to the ProjectConfigFile if the user asked to. It returns false if
+// the user canceled.
+func (a *App) Pick(ctx context.Context, in io.Reader, out io.Writer) (bool, error) {
+	// The walk changes the app (input path, patterns, state): only the selection is kept.
+	config := *a
+	config.Verbose = false
+
+	fsys, info, err := config.prepare(ctx, newSpinner())
+	if err != nil {
+		return false, err
+	}
+	if !config.Local || config.Rev != "" || !info.IsDir() {
+		return false, errors.New("pick needs a local directory (without --rev)")
+	}
+
+	// The files excluded by the saved selection are offered too: the saved selection is preselected.
+	saved := config.projectInclude
+	config.projectInclude = ""
+	root, err := config.walk(ctx, fsys, config.InputPath, info)
+	if err != nil {
+		return false, fmt.Errorf("error filtering files: %w", err)
+	}
+	tree := root.tree(true)
+	if tree == nil {
+		return false, errors.New("no source files to pick")
+	}
+	config.projectInclude = saved
+
+	m := newPickModel(newPickItem(tree, config.InputPath, nil, config.matchesProjectInclude))
+	p := tea.NewProgram(m, tea.WithContext(ctx), tea.WithInput(in), tea.WithOutput(out))
+	if _, err := p.Run(); err != nil {
+		return false, err
+	}
+	if !m.confirmed {
+		return false, nil
+	}
+
+	// Whole directories are only selected with "dir/**" if no include pattern hid some of their files.
+	compact := config.Include == "" && config.SourceInclude == ""
+	patterns := m.root.patterns(compact)
+	if m.save {
+		if err := saveProjectInclude(config.InputPath, patterns); err != nil {
+			return false, fmt.Errorf("error saving the selection: %w", err)
+		}
+		a.logger().Infof("Saved the selection to %s", filepath.Join(config.InputPath, ProjectConfigFile))
+	}
+	a.Include, a.SourceInclude, a.TreeInclude, a.Targets = "", "", "", nil
+	a.picked = strings.Join(patterns, ",")
+	return true, nil
+}
+
+// pickItem is an entry of the picker: a file or a directory of the source tree.
+type pickItem struct {
+	node     *TreeNode
+	rel      string // Path relative to the input directory (slash-separated)
+	depth    int
+	parent   *pickItem
+	children []*pickItem
+
+	selected bool // Files only
+	expanded bool // Directories only
+}
+
+// newPickItem creates the item of the node and its children. Files matching the saved
+// include patterns (reported by saved, given their relative path) are selected.
+func newPickItem(node *TreeNode, root string, parent *pickItem, saved func(rel string) bool) *pickItem {
+	it := &pickItem{node: node, parent: parent}
+	if parent != nil {
+		rel, _ := filepath.Rel(root, node.Path)
+		it.rel, it.depth = filepath.ToSlash(rel), parent.depth+1
+	}
+	if !node.IsDir {
+		it.selected = saved(it.rel)
+		return it
+	}
+	it.expanded = parent == nil
+	for _, child := range node.Children {
+		it.children = append(it.children, newPickItem(child, root, it, saved))
+	}
+	return it
+}
+
+// eachFile calls fn for the files of the item matching the query.
+func (it *pickItem) eachFile(query string, fn func(*pickItem)) {
+	if !it.node.IsDir {
+		if fuzzyMatch(query, it.rel) {
+			fn(it)
+		}
+		return
+	}
+	for _, child := range it.children {
+		child.eachFile(query, fn)
+	}
+}
+
+// count returns the number of selected files of the item, and its number of files.
+func (it *pickItem) count() (int, int) {
+	var selected, total int
+	it.eachFile("", func(f *pickItem) {
+		total++
+		if f.selected {
+			selected++
+		}
+	})
+	return selected, total
+}
+
+// toggle selects the files of the item matching the query, or deselects them if all are selected.
+func (it *pickItem) toggle(query string) {
+	all := true
+	it.eachFile(query, func(f *pickItem) { all = all && f.selected })
+	it.eachFile(query, func(f *pickItem) { f.selected = !all })
+}
+
+// matches reports whether the item is a file matching the query, or a directory with such a file.
+func (it *pickItem) matches(query string) bool {
+	found := false
+	it.eachFile(query, func(*pickItem) { found = true })
+	return found
+}
+
+// rows appends the item and its visible children to rows. While searching, the files matching
+// the query are shown with their directories, folded or not.
+func (it *pickItem) rows(query string, rows []*pickItem) []*pickItem {
+	if query != "" && !it.matches(query) {
+		return rows
+	}
+	rows = append(rows, it)
+	if it.expanded || query != "" {
+		for _, child := range it.children {
+			rows = child.rows(query, rows)
+		}
+	}
+	return rows
+}
+
+// patterns returns the include patterns selecting the selected files of the item: their paths
+// (anchored with "/" at the root), or "dir/**" for the directories whose files are all selected
+// if compact is set.
+func (it *pickItem) patterns(compact bool) []string {
+	selected, total := it.count()
+	switch {
+	case selected == 0:
+		return nil
+	case !it.node.IsDir:
+		if !strings.Contains(it.rel, "/") {
+			return []string{"/" + it.rel}
+		}
+		return []string{it.rel}
+	case compact && selected == total:
+		if it.parent == nil {
+			return []string{"**"}
+		}
+		return []string{it.rel + "/**"}
+	}
+
+	var patterns []string
+	for _, child := range it.children {
+		patterns = append(patterns, child.patterns(compact)...)
+	}
+	return patterns
+}
+
+// fuzzyMatch reports whether the characters of the query appear in s in order, ignoring case.
+func fuzzyMatch(query, s string) bool {
+	s = strings.ToLower(s)
+	for _, r := range strings.ToLower(query) {
+		i := strings.IndexRune(s, r)
+		if i < 0 {
+			return false
+		}
+		s = s[i+utf8.RuneLen(r):]
+	}
+	return true
+}
+
+// pickModel is the bubbletea model of the picker.
+type pickModel struct {
+	root *pickItem
+	rows []*pickItem // Visible rows
+
+	cursor, offset int // Row under the cursor, and first row shown
+	height         int // Height of the terminal (0 if unknown)
+
+	query     string
+	searching bool
+	status    string
+
+	confirmed, save bool
+}
+
+// newPickModel creates the model of the picker over the tree of root.
+func newPickModel(root *pickItem) *pickModel {
+	m := &pickModel{root: root}
+	m.refresh()
+	return m
+}
+
+// Init implements tea.Model.
+func (m *pickModel) Init() tea.Cmd {
+	return nil
+}
+
+// Update implements tea.Model.
+func (m *pickModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.height = msg.Height
+		m.scroll()
+	case tea.KeyMsg:
+		if msg.Type == tea.KeyRunes && len(msg.Runes) > 1 && !msg.Paste {
+			// Keys typed quickly can be read at once: they are handled one by one.
+			for _, r := range msg.Runes {
+				if _, cmd := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{r}}); cmd != nil {
+					return m, cmd
+				}
+			}
+			return m, nil
+		}
+		m.status = ""
+		var cmd tea.Cmd
+		if m.searching {
+			cmd = m.updateSearch(msg)
+		} else {
+			cmd = m.updateKey(msg)
+		}
+		m.refresh()
+		return m, cmd
+	}
+	return m, nil
+}
+
+// updateKey handles a key outside of the search input.
+func (m *pickModel) updateKey(msg tea.KeyMsg) tea.Cmd {
+	current := m.rows[m.cursor]
+	switch msg.String() {
+	case "ctrl+c", "q":
+		return tea.Quit
+	case "esc":
+		if m.query == "" {
+			return tea.Quit
+		}
+		m.query = ""
+	case "up", "k":
+		m.cursor--
+	case "down", "j":
+		m.cursor++
+	case "pgup":
+		m.cursor -= m.pageSize()
+	case "pgdown":
+		m.cursor += m.pageSize()
+	case "home", "g":
+		m.cursor = 0
+	case "end", "G":
+		m.cursor = len(m.rows) - 1
+	case "right", "l":
+		current.expanded = current.node.IsDir
+	case "left", "h":
+		if current.expanded && current.parent != nil {
+			current.expanded = false
+		} else if current.parent != nil {
+			m.cursor = m.index(current.parent)
+		}
+	case " ", "x":
+		current.toggle(m.query)
+	case "/":
+		m.query, m.searching = "", true
+	case "enter", "s":
+		if selected, _ := m.root.count(); selected == 0 {
+			m.status = "Select at least one file."
+			return nil
+		}
+		m.confirmed, m.save = true, msg.String() == "s"
+		return tea.Quit
+	}
+	return nil
+}
+
+// updateSearch handles a key of the search input.
+func (m *pickModel) updateSearch(msg tea.KeyMsg) tea.Cmd {
+	switch msg.Type { //nolint:exhaustive // other keys are ignored
+	case tea.KeyCtrlC:
+		return tea.Quit
+	case tea.KeyEnter:
+		m.searching = false
+	case tea.KeyEsc:
+		m.query, m.searching = "", false
+	case tea.KeyBackspace:
+		if _, size := utf8.DecodeLastRuneInString(m.query); size > 0 {
+			m.query = m.query[:len(m.query)-size]
+		}
+	case tea.KeyUp:
+		m.cursor--
+	case tea.KeyDown:
+		m.cursor++
+	case tea.KeySpace:
+		m.query += " "
+	case tea.KeyRunes:
+		m.query += string(msg.Runes)
+	}
+	return nil
+}
+
+// refresh computes the visible rows, keeping the cursor on the same item if it is still shown.
+func (m *pickModel) refresh() {
+	var current *pickItem
+	if m.cursor >= 0 && m.cursor < len(m.rows) {
+		current = m.rows[m.cursor]
+	}
+	m.rows = m.root.rows(m.query, m.rows[:0])
+	if len(m.rows) == 0 {
+		// Nothing matches: the root is kept, for the cursor to be somewhere.
+		m.rows = append(m.rows, m.root)
+	}
+	if i := m.index(current); i >= 0 {
+		m.cursor = i
+	}
+	m.cursor = max(min(m.cursor, len(m.rows)-1), 0)
+	m.scroll()
+}
+
+// index returns the row of the item, or -1 if it is not shown.
+func (m *pickModel) index(it *pickItem) int {
+	for i, row := range m.rows {
+		if row == it {
+			return i
+		}
+	}
+	return -1
+}
+
+// pageSize returns the number of rows shown.
+func (m *pickModel) pageSize() int {
+	if m.height == 0 {
+		return len(m.rows)
+	}
+	return max(m.height-pickChrome, 1)
+}
+
+// scroll moves the rows shown to keep the cursor visible.
+func (m *pickModel) scroll() {
+	page := m.pageSize()
+	if m.cursor < m.offset {
+		m.offset = m.cursor
+	} else if m.cursor >= m.offset+page {
+		m.offset = m.cursor - page + 1
+	}
+	m.offset = max(min(m.offset, len(m.rows)-page), 0)
+}
+
+// View implements tea.Model.
+func (m *pickModel) View() string {
+	var files, total int
+	var size int64
+	m.root.eachFile("", func(f *pickItem) {
+		total++
+		if f.selected {
+			files++
+			size += f.node.Size
+		}
+	})
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Selected %d of %d files (%s, ~%d tokens)\n\n",
+		files, total, formatSize(size), size/bytesPerToken)
+	for i := m.offset; i < min(m.offset+m.pageSize(), len(m.rows)); i++ {
+		line := m.row(m.rows[i])
+		if i == m.cursor {
+			line = pickCursorStyle.Render("> " + line)
+		} else {
+			line = "  " + line
+		}
+		b.WriteString(line + "\n")
+	}
+
+	switch {
+	case m.searching:
+		b.WriteString("/" + m.query + "█\n")
+	case m.query != "":
+		b.WriteString(pickFaintStyle.Render("/"+m.query+" (esc to clear)") + "\n")
+	default:
+		b.WriteString("\n")
+	}
+	b.WriteString(m.status + "\n")
+	b.WriteString(pickFaintStyle.Render(pickHelp))
+	return b.String()
+}
+
+// row renders the checkbox, name and size of the item.
+func (m *pickModel) row(it *pickItem) string {
+	selected, total := it.count()
+	box := "[ ]"
+	switch {
+	case selected == total:
+		box = "[x]"
+	case selected > 0:
+		box = "[-]"
+	}
+
+	indent := strings.Repeat("  ", it.depth)
+	if !it.node.IsDir {
+		return fmt.Sprintf("%s %s  %s", box, indent+"  "+it.node.Name,
+			pickFaintStyle.Render(formatSize(it.node.Size)))
+	}
+	fold := "▸ "
+	if it.expanded || m.query != "" {
+		fold = "▾ "
+	}
+	return fmt.Sprintf("%s %s/  %s", box, indent+fold+it.node.Name,
+		pickFaintStyle.Render(fmt.Sprintf("%d/%d files", selected, total)))
+}
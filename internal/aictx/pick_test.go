@@ -0,0 +1,152 @@
+package aictx_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/amberpixels/aictx/internal/aictx"
+	"github.com/charmbracelet/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPick(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		aictx.ProjectConfigFile: "# Project settings.\nredact:\n  pii:\n    detectors: [email]\n",
+		"a.go":                  "package a\n",
+		"pkg/b.go":              "package b\n",
+		"pkg/c.go":              "package c\n",
+		"docs/readme.md":        "# Docs\n",
+	}
+	for name, content := range files {
+		require.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0o700))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600))
+	}
+	newApp := func() *aictx.App {
+		return &aictx.App{
+			Lgr:             log.New(io.Discard),
+			InputPath:       dir,
+			SourceEnabled:   true,
+			SourceThreshold: 1,
+		}
+	}
+
+	// Keys are read one at a time, as typed.
+	keys := func(s string) io.Reader { return iotest.OneByteReader(strings.NewReader(s)) }
+
+	// Search "pkg" and toggle the matches from the root, clear the search, select a.go
+	// (below the root), then write and save.
+	app := newApp()
+	picked, err := app.Pick(context.Background(), keys("/pkg\r /\rj s"), io.Discard)
+	require.NoError(t, err)
+	require.True(t, picked)
+	assert.Empty(t, app.Include)
+
+	config, err := os.ReadFile(filepath.Join(dir, aictx.ProjectConfigFile))
+	require.NoError(t, err)
+	assert.Equal(t, "# Project settings.\nredact:\n  pii:\n    detectors: [email]\ninclude:\n  - /a.go\n  - pkg/**\n",
+		string(config))
+
+	// The saved selection applies when no include pattern is given.
+	for _, app := range []*aictx.App{app, newApp()} {
+		var out bytes.Buffer
+		app.Out = &out
+		require.NoError(t, app.Run(context.Background()))
+		assert.Contains(t, out.String(), "package a")
+		assert.Contains(t, out.String(), "package c")
+		assert.NotContains(t, out.String(), "# Docs")
+	}
+
+	// Canceling keeps the app as is.
+	app = newApp()
+	picked, err = app.Pick(context.Background(), keys(" q"), io.Discard)
+	require.NoError(t, err)
+	assert.False(t, picked)
+	assert.Empty(t, app.Include)
+}
+
+func TestPickPartOfDirectory(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"a.go":     "package a\n",
+		"pkg/b.go": "package b\n",
+		"pkg/c.go": "package c\n",
+	} {
+		require.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0o700))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600))
+	}
+	newApp := func() *aictx.App {
+		return &aictx.App{Lgr: log.New(io.Discard), InputPath: dir, SourceEnabled: true, SourceThreshold: 1}
+	}
+	keys := func(s string) io.Reader { return iotest.OneByteReader(strings.NewReader(s)) }
+	config := filepath.Join(dir, aictx.ProjectConfigFile)
+
+	// Pick pkg/c.go only, and save.
+	picked, err := newApp().Pick(context.Background(), keys("/c.go\r sq"), io.Discard)
+	require.NoError(t, err)
+	require.True(t, picked)
+	data, err := os.ReadFile(config)
+	require.NoError(t, err)
+	assert.Equal(t, "include:\n  - pkg/c.go\n", string(data))
+
+	// The saved selection is preselected by the next pick, which saves it as is.
+	picked, err = newApp().Pick(context.Background(), keys("sq"), io.Discard)
+	require.NoError(t, err)
+	require.True(t, picked)
+	data, err = os.ReadFile(config)
+	require.NoError(t, err)
+	assert.Equal(t, "include:\n  - pkg/c.go\n", string(data))
+
+	var out bytes.Buffer
+	app := newApp()
+	app.Out = &out
+	require.NoError(t, app.Run(context.Background()))
+	assert.Contains(t, out.String(), "package c")
+	assert.NotContains(t, out.String(), "package b")
+	assert.NotContains(t, out.String(), "package a")
+}
+
+func TestProjectIncludePrecedence(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		aictx.ProjectConfigFile: "include:\n  - pkg/**\n",
+		"a.go":                  "package a\n",
+		"pkg/b.go":              "package b\n",
+	}
+	for name, content := range files {
+		require.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0o700))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600))
+	}
+	run := func(app *aictx.App) (string, string) {
+		var out, logs bytes.Buffer
+		app.InputPath, app.Out, app.Lgr = dir, &out, log.New(&logs)
+		app.SourceEnabled, app.SourceThreshold = true, 1
+		require.NoError(t, app.Run(context.Background()))
+		return out.String(), logs.String()
+	}
+
+	// Without include patterns, the saved ones apply, with a notice.
+	out, logs := run(&aictx.App{})
+	assert.Contains(t, out, "package b")
+	assert.NotContains(t, out, "package a")
+	assert.Contains(t, logs, "Including only pkg/**, as selected in "+aictx.ProjectConfigFile)
+
+	// Include patterns and targets replace them.
+	for _, app := range []*aictx.App{
+		{Include: "a.go"},
+		{SourceInclude: "a.go"},
+		{Targets: []string{"a.go:1"}},
+	} {
+		out, logs := run(app)
+		assert.Contains(t, out, "package a")
+		assert.NotContains(t, out, "package b")
+		assert.Empty(t, logs)
+	}
+}
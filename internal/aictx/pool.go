@@ -0,0 +1,87 @@
+package aictx
+
+import (
+	"context"
+	"runtime"
+	"sync"
+)
+
+// jobs returns the number of files processed concurrently.
+// Files of --rev trees are read one by one, as the git object storage
+// is not safe for concurrent use.
+func (a *App) jobs() int {
+	if a.Rev != "" {
+		return 1
+	}
+	if a.Jobs <= 0 {
+		return runtime.NumCPU()
+	}
+	return a.Jobs
+}
+
+// forEachOrdered calls work on the items with up to jobs concurrent workers, and emit
+// with each result in the order of the items. Workers run at most 2*jobs items ahead
+// of emit, which bounds the results held in memory.
+// It stops at the first error returned by emit, or when ctx is canceled: work gets
+// the context canceled then, and isn't called for the remaining items.
+func forEachOrdered[T, R any](ctx context.Context, jobs int, items []T,
+	work func(ctx context.Context, item T) R, emit func(i int, item T, result R) error,
+) error {
+	jobs = max(jobs, 1)
+	ctx, cancel := context.WithCancel(ctx)
+
+	results := make([]chan R, len(items))
+	for i := range results {
+		results[i] = make(chan R, 1)
+	}
+
+	// A window slot is taken for each dispatched item and released when it is emitted.
+	window := make(chan struct{}, 2*jobs) //nolint:mnd // 2 items queued per worker
+	next := make(chan int)
+	go func() {
+		defer close(next)
+		for i := range items {
+			select {
+			case window <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			select {
+			case next <- i:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for range min(jobs, len(items)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				if ctx.Err() != nil {
+					return
+				}
+				results[i] <- work(ctx, items[i])
+			}
+		}()
+	}
+	defer func() {
+		cancel()
+		wg.Wait()
+	}()
+
+	for i, item := range items {
+		select {
+		case result := <-results[i]:
+			<-window
+			if err := emit(i, item, result); err != nil {
+				return err
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
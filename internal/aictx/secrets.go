@@ -0,0 +1,322 @@
+package aictx
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// ErrSecretsFound is returned by Run when FailOnSecrets is set and secrets were redacted.
+var ErrSecretsFound = errors.New("secrets found")
+
+// secretRule detects one type of secret in a line.
+type secretRule struct {
+	// kind names the type of secret in placeholders and reports.
+	kind string
+	re   *regexp.Regexp
+	// group is the submatch that is redacted (0 for the whole match).
+	group int
+	// minEntropy, when set, is the minimum Shannon entropy (bits per byte) of the redacted text.
+	minEntropy float64
+	// generic is set for rules matching values by their key: values that are obviously
+	// not secrets (numbers, booleans, placeholders) are kept.
+	generic bool
+	// keywords, when set, are lowercase strings one of which a line must contain to match:
+	// checking them is much cheaper than running the regexp on every line.
+	keywords []string
+}
+
+// highEntropy is the minimum Shannon entropy of strings redacted as high-entropy.
+// Random base64 tokens are above it; hex digests, words and identifiers are below.
+const highEntropy = 4.3
+
+// secretRules are the secret detectors, in priority order: the first rule matching
+// a part of a line redacts it.
+//
+//nolint:gochecknoglobals // Hardcoded rules.
+var secretRules = []secretRule{
+	{kind: "private-key", re: regexp.MustCompile(
+		`-----BEGIN[A-Z ]*PRIVATE KEY( BLOCK)?-----.*?-----END[A-Z ]*PRIVATE KEY( BLOCK)?-----`),
+		keywords: []string{"private key"}},
+	{kind: "aws-access-key", re: regexp.MustCompile(`\b(?:AKIA|ASIA|ABIA|ACCA)[0-9A-Z]{16}\b`),
+		keywords: []string{"akia", "asia", "abia", "acca"}},
+	{kind: "aws-secret-key", re: regexp.MustCompile(
+		`(?i)aws.{0,20}?(?:secret|private).{0,20}?[=:][\s"']*([A-Za-z0-9/+]{40})\b`), group: 1,
+		keywords: []string{"aws"}},
+	{kind: "gcp-api-key", re: regexp.MustCompile(`\bAIza[0-9A-Za-z_\-]{35}\b`),
+		keywords: []string{"aiza"}},
+	{kind: "gcp-service-account", re: regexp.MustCompile(`"private_key_id"\s*:\s*"([0-9a-f]{40})"`), group: 1,
+		keywords: []string{"private_key_id"}},
+	{kind: "github-token", re: regexp.MustCompile(`\b(?:gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{22,})\b`),
+		keywords: []string{"ghp_", "gho_", "ghu_", "ghs_", "ghr_", "github_pat_"}},
+	{kind: "gitlab-token", re: regexp.MustCompile(`\bglpat-[A-Za-z0-9_\-]{20,}\b`),
+		keywords: []string{"glpat-"}},
+	{kind: "slack-token", re: regexp.MustCompile(`\bxox[abprs]-[A-Za-z0-9\-]{10,}\b`),
+		keywords: []string{"xox"}},
+	{kind: "stripe-key", re: regexp.MustCompile(`\b[rs]k_(?:live|test)_[A-Za-z0-9]{16,}\b`),
+		keywords: []string{"k_live_", "k_test_"}},
+	{kind: "api-key", re: regexp.MustCompile(`\bsk-(?:ant-|proj-)?[A-Za-z0-9_\-]{32,}\b`),
+		keywords: []string{"sk-"}},
+	{kind: "jwt", re: regexp.MustCompile(`\beyJ[A-Za-z0-9_\-]{8,}\.eyJ[A-Za-z0-9_\-]{8,}\.[A-Za-z0-9_\-]{8,}`),
+		keywords: []string{"eyj"}},
+	// .env style assignments of secret-looking variables: API_TOKEN=..., export DB_PASSWORD="...".
+	{kind: "env-secret", re: regexp.MustCompile(
+		`^\s*(?:export\s+)?[A-Za-z0-9_]*` +
+			`(?i:secret|token|passw(?:or)?d|pwd|api_?key|private_?key|access_?key|credentials?)[A-Za-z0-9_]*` +
+			`\s*[=:]\s*["']?([^\s"'#$<>{}()\[\],;]{6,})["']?\s*(?:#.*)?$`),
+		group: 1, generic: true, keywords: secretKeywords},
+	// Quoted values assigned to secret-looking keys in code and configs: password: "...".
+	{kind: "secret", re: regexp.MustCompile(
+		`(?i)(?:secret|token|passw(?:or)?d|api_?key|private_?key|access_?key)["']?` +
+			`\s*(?::=|[=:])\s*["']([^\s"'$<>{}]{8,})["']`),
+		group: 1, generic: true, keywords: secretKeywords},
+	{kind: "high-entropy", re: regexp.MustCompile(`["'\x60=:]\s*([A-Za-z0-9+/_\-]{24,100}={0,2})(?:["'\x60\s,;]|$)`), group: 1,
+		minEntropy: highEntropy, keywords: []string{`"`, "'", "`", "=", ":"}},
+}
+
+// secretKeywords are the keywords of the rules matching values by their key.
+//
+//nolint:gochecknoglobals // Hardcoded keywords.
+var secretKeywords = []string{
+	"secret", "token", "passw", "pwd", "api_key", "apikey", "private", "access", "credential",
+}
+
+// privateKeyBeginRe and privateKeyEndRe match the lines opening and closing PEM private keys.
+//
+//nolint:gochecknoglobals // Hardcoded patterns.
+var (
+	privateKeyBeginRe = regexp.MustCompile(`-----BEGIN[A-Z ]*PRIVATE KEY( BLOCK)?-----`)
+	privateKeyEndRe   = regexp.MustCompile(`-----END[A-Z ]*PRIVATE KEY( BLOCK)?-----`)
+)
+
+// secretFinding is a secret redacted from the output.
+type secretFinding struct {
+	Path string
+	Line int
+	Kind string
+}
+
+// redactPlaceholder returns the text replacing a secret of the given kind.
+func redactPlaceholder(kind string) string {
+	return "[REDACTED:" + kind + "]"
+}
+
+// redactSecrets replaces the secrets found in the content with [REDACTED:kind] placeholders.
+// Lines keep their numbers: the lines of multi-line private keys, replaced by a single
+// placeholder on their first line, are blanked and returned in dropped, mapped to that first line.
+// It returns the redacted content, the dropped lines and the secrets found, with their line numbers.
+func redactSecrets(path string, data []byte) ([]byte, map[int]int, []secretFinding) {
+	var findings []secretFinding
+	var dropped map[int]int
+	lines := toLines(data)
+	r := secretRedactor{path: path}
+	keyLine := 0
+	for i, l := range lines {
+		redacted, ok := r.redact(l, &findings)
+		switch {
+		case !ok:
+			if dropped == nil {
+				dropped = make(map[int]int)
+			}
+			dropped[l.Num] = keyLine
+			redacted = sourceLine{Num: l.Num}
+		case r.inKey:
+			keyLine = l.Num
+		}
+		lines[i] = redacted
+	}
+	return joinLines(lines, bytes.HasSuffix(data, []byte("\n"))), dropped, findings
+}
+
+// selectedSecrets returns the findings of the selected lines, including the private keys
+// whose dropped lines are selected.
+func selectedSecrets(findings []secretFinding, lines []sourceLine, dropped map[int]int) []secretFinding {
+	selected := make(map[int]bool, len(lines))
+	for _, l := range lines {
+		selected[l.Num] = true
+		if keyLine, ok := dropped[l.Num]; ok {
+			selected[keyLine] = true
+		}
+	}
+	return slices.DeleteFunc(findings, func(f secretFinding) bool { return !selected[f.Line] })
+}
+
+// secretRedactor redacts the secrets of a file line by line.
+type secretRedactor struct {
+	path string
+	// inKey is set between the lines opening and closing a private key,
+	// and keyLine is the line opening the last one.
+	inKey   bool
+	keyLine int
+}
+
+// redact redacts the secrets of the next line of the file and appends them to findings.
+// It returns false for the lines of multi-line private keys, which are dropped.
+func (r *secretRedactor) redact(l sourceLine, findings *[]secretFinding) (sourceLine, bool) {
+	text := l.Text
+	if r.inKey {
+		// Drop the key lines, up to the end marker.
+		loc := privateKeyEndRe.FindIndex(text)
+		if loc == nil {
+			return l, false
+		}
+		text, r.inKey = text[loc[1]:], false
+		if len(bytes.TrimSpace(text)) == 0 {
+			return l, false
+		}
+	}
+
+	text, kinds := redactLine(text)
+	for _, kind := range kinds {
+		*findings = append(*findings, secretFinding{Path: r.path, Line: l.Num, Kind: kind})
+	}
+	if loc := privateKeyBeginRe.FindIndex(text); loc != nil {
+		text = append(slices.Clip(text[:loc[0]]), redactPlaceholder("private-key")...)
+		*findings = append(*findings, secretFinding{Path: r.path, Line: l.Num, Kind: "private-key"})
+		r.inKey, r.keyLine = true, l.Num
+	}
+	return sourceLine{Num: l.Num, Text: text}, true
+}
+
+// skip follows the private keys through a line left out of the output.
+func (r *secretRedactor) skip(l sourceLine) {
+	// Only the lines opening or closing private keys change the state.
+	if bytes.Contains(l.Text, []byte("PRIVATE KEY")) {
+		var findings []secretFinding
+		r.redact(l, &findings)
+	}
+}
+
+// redactLine applies the secret rules to a line. It returns the redacted line
+// and the kinds of the secrets found.
+func redactLine(line []byte) ([]byte, []string) {
+	var kinds []string
+	lower := bytes.ToLower(line)
+	for _, rule := range secretRules {
+		if len(rule.keywords) > 0 && !slices.ContainsFunc(rule.keywords, func(k string) bool {
+			return bytes.Contains(lower, []byte(k))
+		}) {
+			continue
+		}
+		var n int
+		line, n = replaceMatches(line, rule.re, rule.group, func(m []int) (string, bool) {
+			secret := line[m[2*rule.group]:m[2*rule.group+1]]
+			if rule.minEntropy > 0 && !looksRandom(secret, rule.minEntropy) || rule.generic && isPlaceholder(secret) {
+				return "", false
+			}
+			return redactPlaceholder(rule.kind), true
+		})
+		for range n {
+			kinds = append(kinds, rule.kind)
+		}
+	}
+	return line, kinds
+}
+
+// replaceMatches replaces the given group of each match of re in line by the text returned
+// by replace (called with the submatch indices), unless it returns false. Placeholders of
+// earlier redactions are left alone. It returns the line and the number of replacements.
+func replaceMatches(line []byte, re *regexp.Regexp, group int, replace func(m []int) (string, bool)) ([]byte, int) {
+	matches := re.FindAllSubmatchIndex(line, -1)
+	if matches == nil {
+		return line, 0
+	}
+
+	var buf bytes.Buffer
+	last, n := 0, 0
+	for _, m := range matches {
+		start, end := m[2*group], m[2*group+1]
+		if start < 0 || start < last || bytes.HasPrefix(line[start:end], []byte("[REDACTED:")) {
+			continue
+		}
+		text, ok := replace(m)
+		if !ok {
+			continue
+		}
+		buf.Write(line[last:start])
+		buf.WriteString(text)
+		last = end
+		n++
+	}
+	if n == 0 {
+		return line, 0
+	}
+	buf.Write(line[last:])
+	return buf.Bytes(), n
+}
+
+// placeholderValues are values of secret-looking keys which are not secrets, compared whole.
+//
+//nolint:gochecknoglobals // Hardcoded values.
+var placeholderValues = []string{
+	"true", "false", "null", "nil", "none", "undefined", "changeme", "change_me", "changeit", "example",
+	"placeholder", "redacted", "dummy", "fake", "sample", "test", "todo", "password", "passwd", "secret", "token",
+}
+
+// placeholderRe matches the forms of placeholders: masks (xxxxxx, ******), templates
+// (<api-key>, ${API_KEY}, {{ .Token }}, %(token)s, $API_KEY) and your_token_here.
+var placeholderRe = regexp.MustCompile(`^(?:[xX*.\-_]+|<[^<>]*>|\$\{[^{}]*\}|\{\{.*\}\}|%\([^()]*\)s|` +
+	`\$[A-Za-z_][A-Za-z0-9_]*|(?i:your[_\-][a-z0-9_\-]*))$`)
+
+// secretNameRe matches names of secrets, like "ssh-password": lowercase words separated by dashes
+// or underscores.
+var secretNameRe = regexp.MustCompile(
+	`^[a-z]+(?:[_\-][a-z]+)*[_\-](?:password|passwd|secret|token|key)(?:[_\-][a-z]+)*$`)
+
+// isPlaceholder reports whether the value of a secret-looking key is obviously not a secret:
+// a number, a placeholder like "changeme", "xxxxxx" or "${TOKEN}", or a name like "ssh-password".
+// The whole value is matched, so real secrets containing such words are still redacted.
+func isPlaceholder(value []byte) bool {
+	if len(bytes.Trim(value, "0123456789.")) == 0 {
+		return true
+	}
+	return slices.Contains(placeholderValues, strings.ToLower(string(value))) ||
+		placeholderRe.Match(value) || secretNameRe.Match(value)
+}
+
+// looksRandom reports whether s has at least the given Shannon entropy and mixes
+// letters and digits, as generated tokens do.
+func looksRandom(s []byte, minEntropy float64) bool {
+	hasDigit := bytes.ContainsAny(s, "0123456789")
+	hasLetter := bytes.ContainsFunc(s, func(r rune) bool { return r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' })
+	return hasDigit && hasLetter && shannonEntropy(s) >= minEntropy
+}
+
+// shannonEntropy returns the Shannon entropy of s in bits per byte.
+func shannonEntropy(s []byte) float64 {
+	var counts [256]int
+	for _, b := range s {
+		counts[b]++
+	}
+	var entropy float64
+	for _, c := range counts {
+		if c > 0 {
+			p := float64(c) / float64(len(s))
+			entropy -= p * math.Log2(p)
+		}
+	}
+	return entropy
+}
+
+// reportSecrets logs the secrets redacted from a file and records them for FailOnSecrets.
+func (a *App) reportSecrets(findings []secretFinding) {
+	for _, f := range findings {
+		a.logger().Warnf("Redacted secret (%s) at %s:%d", f.Kind, f.Path, f.Line)
+	}
+	a.secrets = append(a.secrets, findings...)
+}
+
+// secretsNote returns the header note summarizing the secrets redacted from a file.
+func secretsNote(findings []secretFinding) string {
+	var kinds []string
+	for _, f := range findings {
+		if !slices.Contains(kinds, f.Kind) {
+			kinds = append(kinds, f.Kind)
+		}
+	}
+	return fmt.Sprintf("Redacted: %d secret(s) (%s)", len(findings), strings.Join(kinds, ", "))
+}
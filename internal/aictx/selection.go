@@ -0,0 +1,262 @@
+package aictx
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// selectionGap is the line emitted between non-adjacent slices of a file.
+const selectionGap = "..."
+
+// target selects a slice of a file: a line range ("app.go:120-240") or a symbol ("app.go#App.Run").
+type target struct {
+	// pattern matches the files the target applies to.
+	pattern string
+	// start and end are the 1-based, inclusive line range (zero for symbol targets).
+	start, end int
+	// symbol is the name of the selected declaration, as reported by the file's Outliner.
+	symbol string
+}
+
+// String returns the target as it appears in file headers.
+func (t target) String() string {
+	if t.symbol != "" {
+		return t.symbol
+	}
+	if t.start == t.end {
+		return fmt.Sprintf("line %d", t.start)
+	}
+	return fmt.Sprintf("lines %d-%d", t.start, t.end)
+}
+
+// lineRangeTargetRe matches line range targets: "path:120-240" or "path:120".
+var lineRangeTargetRe = regexp.MustCompile(`^(.+):(\d+)(?:-(\d+))?$`)
+
+// symbolTargetRe matches symbol targets: "path#Symbol" or "path#Type.Method".
+var symbolTargetRe = regexp.MustCompile(`^(.+)#([\pL_$][\pL\pN_$.]*)$`)
+
+// parseTarget parses a target. It returns false if s is a plain pattern.
+func parseTarget(s string) (target, bool, error) {
+	if m := symbolTargetRe.FindStringSubmatch(s); m != nil {
+		return target{pattern: cleanTargetPath(m[1]), symbol: m[2]}, true, nil
+	}
+	m := lineRangeTargetRe.FindStringSubmatch(s)
+	if m == nil {
+		return target{}, false, nil
+	}
+
+	t := target{pattern: cleanTargetPath(m[1])}
+	var err error
+	if t.start, err = strconv.Atoi(m[2]); err != nil {
+		return target{}, false, fmt.Errorf("invalid target %q: %w", s, err)
+	}
+	t.end = t.start
+	if m[3] != "" {
+		if t.end, err = strconv.Atoi(m[3]); err != nil {
+			return target{}, false, fmt.Errorf("invalid target %q: %w", s, err)
+		}
+	}
+	if t.start < 1 || t.end < t.start {
+		return target{}, false, fmt.Errorf("invalid target %q: expected a line range like 120-240", s)
+	}
+	return t, true, nil
+}
+
+// cleanTargetPath normalizes the path of a target, so "./app.go" matches "app.go".
+func cleanTargetPath(p string) string {
+	if strings.ContainsAny(p, "*?[") {
+		return p
+	}
+	return path.Clean(strings.ReplaceAll(p, "\\", "/"))
+}
+
+// splitTargets extracts the targets from a comma-separated list of patterns.
+// It returns the patterns with each target replaced by the path it applies to.
+func splitTargets(patterns string) (string, []target, error) {
+	if patterns == "" {
+		return "", nil, nil
+	}
+	parts := strings.Split(patterns, ",")
+	var targets []target
+	for i, p := range parts {
+		t, ok, err := parseTarget(strings.TrimSpace(p))
+		if err != nil {
+			return "", nil, err
+		}
+		if ok {
+			parts[i] = t.pattern
+			targets = append(targets, t)
+		}
+	}
+	return strings.Join(parts, ","), targets, nil
+}
+
+// prepareTargets moves the Targets into the global include and extracts the targets
+// from the include patterns, so the files they point to are processed as usual.
+func (a *App) prepareTargets() error {
+	if len(a.Targets) > 0 {
+		a.Include = strings.Trim(a.Include+","+strings.Join(a.Targets, ","), ",")
+	}
+
+	a.targets, a.targetPaths = nil, nil
+	for _, include := range []*string{&a.Include, &a.SourceInclude, &a.TreeInclude} {
+		patterns, targets, err := splitTargets(*include)
+		if err != nil {
+			return err
+		}
+		*include = patterns
+		if include != &a.TreeInclude {
+			a.targets = append(a.targets, targets...)
+		}
+		a.addTargetPaths(targets)
+	}
+	return nil
+}
+
+// addTargetPaths records the patterns of the targets, standing for their files in the include patterns.
+func (a *App) addTargetPaths(targets []target) {
+	for _, t := range targets {
+		if a.targetPaths == nil {
+			a.targetPaths = make(map[string]bool)
+		}
+		a.targetPaths[t.pattern] = true
+	}
+}
+
+// matchInclude reports whether an include pattern matches the path. Patterns standing for
+// the files of targets match as in targetsFor.
+func (a *App) matchInclude(pattern, pathStr string) bool {
+	if a.targetPaths[pattern] {
+		return matchTargetPattern(pattern, pathStr)
+	}
+	return matchPattern(pattern, pathStr)
+}
+
+// targetsFor returns the targets applying to the file.
+func (a *App) targetsFor(filePath string) []target {
+	normalizedPath := strings.TrimPrefix(path.Clean(strings.ReplaceAll(filePath, "\\", "/")), "./")
+	var targets []target
+	for _, t := range a.targets {
+		if matchTargetPattern(t.pattern, normalizedPath) {
+			targets = append(targets, t)
+		}
+	}
+	return targets
+}
+
+// matchTargetPattern reports whether the pattern of a target matches the path. Unlike other
+// patterns, paths like "aictx/app.go" also match the file itself or its trailing segments.
+func matchTargetPattern(pattern, pathStr string) bool {
+	if !strings.Contains(pattern, "/") || strings.ContainsAny(pattern, "*?[") {
+		return matchPattern(pattern, pathStr)
+	}
+	return pathStr == pattern || strings.HasSuffix(pathStr, "/"+pattern) || matchPattern(pattern, pathStr)
+}
+
+// lineRange is a 1-based, inclusive range of lines.
+type lineRange struct {
+	start, end int
+}
+
+// resolveTargets returns the sorted, merged line ranges selected by the targets in src,
+// and a header note describing them. Symbols are looked up with the file's Outliner:
+// a name matches the full symbol name ("App.Run") or its last part ("Run").
+func resolveTargets(targets []target, filePath string, src []byte) ([]lineRange, string) {
+	lineCount := countLines(src)
+	var symbols []Symbol
+	var symbolsErr error
+	var ranges []lineRange
+	var selected, missing []string
+	for _, t := range targets {
+		if t.symbol == "" {
+			if t.start > lineCount {
+				missing = append(missing, t.String())
+				continue
+			}
+			ranges = append(ranges, lineRange{t.start, min(t.end, lineCount)})
+			selected = append(selected, t.String())
+			continue
+		}
+
+		if symbols == nil && symbolsErr == nil {
+			symbols, symbolsErr = OutlinerFor(filePath).Symbols(src)
+		}
+		found := false
+		for _, s := range symbols {
+			if s.Name == t.symbol || strings.HasSuffix(s.Name, "."+t.symbol) {
+				ranges = append(ranges, lineRange{s.StartLine, s.EndLine})
+				selected = append(selected, fmt.Sprintf("%s (lines %d-%d)", s.Name, s.StartLine, s.EndLine))
+				found = true
+			}
+		}
+		if !found {
+			missing = append(missing, t.String())
+		}
+	}
+
+	note := "Selection: " + strings.Join(selected, ", ")
+	if len(missing) > 0 {
+		if len(selected) == 0 {
+			note = "Selection: "
+		} else {
+			note += "; "
+		}
+		note += "not found: " + strings.Join(missing, ", ")
+	}
+	return mergeRanges(ranges), note
+}
+
+// mergeRanges sorts the ranges and merges the overlapping and adjacent ones.
+func mergeRanges(ranges []lineRange) []lineRange {
+	slices.SortFunc(ranges, func(a, b lineRange) int { return a.start - b.start })
+	var merged []lineRange
+	for _, r := range ranges {
+		if n := len(merged); n > 0 && r.start <= merged[n-1].end+1 {
+			merged[n-1].end = max(merged[n-1].end, r.end)
+			continue
+		}
+		merged = append(merged, r)
+	}
+	return merged
+}
+
+// selectLines keeps the lines within the ranges.
+func selectLines(lines []sourceLine, ranges []lineRange) []sourceLine {
+	result := make([]sourceLine, 0, len(lines))
+	for _, l := range lines {
+		if rangeIndex(ranges, l.Num) >= 0 {
+			result = append(result, l)
+		}
+	}
+	return result
+}
+
+// separateRanges inserts the gap line between lines of different ranges.
+// It runs after all other transforms, as the gap lines do not belong to the file.
+func separateRanges(lines []sourceLine, ranges []lineRange, gap string) []sourceLine {
+	result := make([]sourceLine, 0, len(lines))
+	prev := -1
+	for _, l := range lines {
+		idx := rangeIndex(ranges, l.Num)
+		if prev >= 0 && idx != prev {
+			result = append(result, sourceLine{Text: []byte(gap)})
+		}
+		result = append(result, l)
+		prev = idx
+	}
+	return result
+}
+
+// rangeIndex returns the index of the range containing the line, or -1.
+func rangeIndex(ranges []lineRange, num int) int {
+	for i, r := range ranges {
+		if num >= r.start && num <= r.end {
+			return i
+		}
+	}
+	return -1
+}
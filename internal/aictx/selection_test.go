@@ -0,0 +1,103 @@
+package aictx_test
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/amberpixels/aictx/internal/aictx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTargets(t *testing.T) {
+	dir := t.TempDir()
+	goSrc := "package main\n\n// T is a type.\ntype T struct{}\n\n// Run runs.\nfunc (t *T) Run() {\n\tprintln(1)\n}\n\nfunc main() {}\n"
+	tsSrc := "export class Shape {\n  area(): number {\n    return 0;\n  }\n}\n"
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "main.go"), []byte(goSrc), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "shape.ts"), []byte(tsSrc), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "other.go"), []byte("package main\n"), 0o600))
+
+	tests := []struct {
+		name     string
+		include  string
+		targets  []string
+		expected string
+	}{
+		{
+			name:     "line range",
+			targets:  []string{"main.go:3-4"},
+			expected: "// T is a type.\ntype T struct{}\n",
+		},
+		{
+			name:     "go method with receiver",
+			targets:  []string{"main.go#T.Run"},
+			expected: "// Run runs.\nfunc (t *T) Run() {\n\tprintln(1)\n}\n",
+		},
+		{
+			name:     "outlined symbol by short name and a line, via include",
+			include:  "shape.ts#area,main.go:11",
+			expected: "func main() {}\n  area(): number {\n    return 0;\n  }\n",
+		},
+		{
+			name:     "separated slices",
+			targets:  []string{"main.go:1", "main.go#main"},
+			expected: "package main\n...\nfunc main() {}\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			app := &aictx.App{
+				InputPath:       dir,
+				Local:           true,
+				SourceEnabled:   true,
+				SourceThreshold: 1,
+				Raw:             true,
+				Include:         tt.include,
+				Targets:         tt.targets,
+				Out:             &out,
+			}
+			require.NoError(t, app.Run(context.Background()))
+			// Raw mode separates files with a blank line.
+			assert.Equal(t, tt.expected, string(bytes.ReplaceAll(out.Bytes(), []byte("\n\n"), []byte("\n"))))
+		})
+	}
+}
+
+func TestTargetPathsOnlyMatchTargets(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a/b.go", "vendor/a/b.go"} {
+		require.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0o700))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte("package a\n"), 0o600))
+	}
+
+	// Paths like "a/b.go" match trailing segments in targets only: the exclude keeps vendor/a/b.go.
+	var out bytes.Buffer
+	app := &aictx.App{
+		InputPath:     dir,
+		Local:         true,
+		TreeEnabled:   true,
+		Exclude:       "a/b.go",
+		NoCoreIgnores: true,
+		Out:           &out,
+	}
+	require.NoError(t, app.Run(context.Background()))
+	assert.Contains(t, out.String(), "vendor\n    └── a\n        └── b.go")
+
+	// The target selects both.
+	out.Reset()
+	app = &aictx.App{
+		InputPath:     dir,
+		Local:         true,
+		TreeEnabled:   true,
+		Targets:       []string{"a/b.go:1"},
+		NoCoreIgnores: true,
+		Out:           &out,
+	}
+	require.NoError(t, app.Run(context.Background()))
+	assert.Contains(t, out.String(), "Project Tree [2 files")
+}
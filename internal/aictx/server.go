@@ -0,0 +1,401 @@
+package aictx
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Timeouts of the HTTP server. There is no write timeout, as large contexts take a while to stream.
+const (
+	serverReadHeaderTimeout = 10 * time.Second
+	serverShutdownTimeout   = 5 * time.Second
+)
+
+// maxRequestBody is the maximum size of the JSON body of POST /context.
+const maxRequestBody = MB
+
+// errOutsideRoot is returned for request paths escaping the served root.
+var errOutsideRoot = errors.New("path is outside the served root")
+
+// server serves the contexts of a local directory, over HTTP (see App.Handler) or MCP (see App.ServeMCP).
+type server struct {
+	// app holds the options of every request, which may override some of them.
+	app App
+	// root is the served directory, and realRoot its path with symlinks resolved.
+	root     string
+	realRoot string
+}
+
+// contextRequest is the body of POST /context. Its fields mirror the options of App;
+// omitted fields keep the options the server was started with. Options weakening the
+// protection of the served files (secret redaction, ignore files, hidden files) can't be changed.
+type contextRequest struct {
+	Path    string   `json:"path"`
+	Targets []string `json:"targets"`
+	Include string   `json:"include"`
+	Exclude string   `json:"exclude"`
+
+	TreeEnabled bool   `json:"treeEnabled"`
+	TreeInclude string `json:"treeInclude"`
+	TreeExclude string `json:"treeExclude"`
+
+	SourceEnabled   bool    `json:"sourceEnabled"`
+	SourceInclude   string  `json:"sourceInclude"`
+	SourceExclude   string  `json:"sourceExclude"`
+	SourceThreshold float64 `json:"sourceThreshold"`
+
+	Oversize     string `json:"oversize"`
+	OversizeHead int    `json:"oversizeHead"`
+	OversizeTail int    `json:"oversizeTail"`
+
+	StripComments      bool `json:"stripComments"`
+	KeepDocComments    bool `json:"keepDocComments"`
+	CollapseBlankLines bool `json:"collapseBlankLines"`
+	LineNumbers        bool `json:"lineNumbers"`
+	MaskPII            bool `json:"maskPII"`
+
+	Skeleton bool   `json:"skeleton"`
+	Outline  string `json:"outline"`
+	Full     string `json:"full"`
+
+	History        int     `json:"history"`
+	FileHistory    bool    `json:"fileHistory"`
+	Blame          bool    `json:"blame"`
+	BlameThreshold float64 `json:"blameThreshold"`
+	Order          string  `json:"order"`
+	Since          string  `json:"since"`
+
+	Raw           bool    `json:"raw"`
+	MaxOutputSize float64 `json:"maxOutputSize"`
+}
+
+// Handler returns the HTTP handler serving the contexts of the (local) input directory:
+//
+//   - GET /tree?path=&include=&exclude= streams the tree.
+//   - GET /source?path=&include=&exclude=&format=text|raw streams the sources.
+//   - POST /context streams the tree and sources for the options of a JSON body (see contextRequest).
+//
+// Request paths are relative to the input directory, and can't escape it. Hidden files
+// are shown as the app options say, whatever the request.
+func (a *App) Handler() (http.Handler, error) {
+	s, err := a.newServer()
+	if err != nil {
+		return nil, err
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /tree", s.handleTree)
+	mux.HandleFunc("GET /source", s.handleSource)
+	mux.HandleFunc("POST /context", s.handleContext)
+	return mux, nil
+}
+
+// newServer returns the server of the (local) input directory.
+func (a *App) newServer() (*server, error) {
+	root := expandHome(a.InputPath)
+	if info, err := os.Stat(root); err != nil || !info.IsDir() {
+		return nil, fmt.Errorf("serving needs a local directory, got %q", a.InputPath)
+	}
+	realRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return nil, err
+	}
+	if realRoot, err = filepath.Abs(realRoot); err != nil {
+		return nil, err
+	}
+
+	s := &server{app: *a, root: root, realRoot: realRoot}
+	// Requests don't write files (a previous dump to OutFilename is still excluded), nor report progress.
+	// Nor do they use the incremental cache, whose file concurrent requests would share.
+	s.app.Out = nil
+	s.app.Verbose, s.app.FailOnSecrets = false, false
+	s.app.Incremental, s.app.OnlyChanged = false, false
+	// Files are read from the root only, and shown with paths relative to it.
+	s.app.realRoot, s.app.pathBase = realRoot, root
+	return s, nil
+}
+
+// Serve serves the contexts of the input directory over HTTP on addr (see Handler)
+// until ctx is canceled.
+func (a *App) Serve(ctx context.Context, addr string) error {
+	handler, err := a.Handler()
+	if err != nil {
+		return err
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	srv := &http.Server{
+		Handler:           handler,
+		ReadHeaderTimeout: serverReadHeaderTimeout,
+		BaseContext:       func(net.Listener) context.Context { return ctx },
+	}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), serverShutdownTimeout)
+		defer cancel()
+		srv.Shutdown(shutdownCtx) //nolint:errcheck,contextcheck // The server is going away anyway.
+	}()
+
+	a.logger().Infof("Serving %s on http://%s", a.InputPath, ln.Addr())
+	if err := srv.Serve(ln); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+func (s *server) handleTree(w http.ResponseWriter, r *http.Request) {
+	app, ok := s.queryApp(w, r)
+	if !ok {
+		return
+	}
+	app.SourceEnabled = false
+	app.TreeEnabled = true
+	s.run(w, r, app)
+}
+
+func (s *server) handleSource(w http.ResponseWriter, r *http.Request) {
+	app, ok := s.queryApp(w, r)
+	if !ok {
+		return
+	}
+	app.TreeEnabled = false
+	app.SourceEnabled = true
+	switch format := r.URL.Query().Get("format"); format {
+	case "", "text":
+	case "raw":
+		app.Raw = true
+	default:
+		http.Error(w, fmt.Sprintf("unknown format %q (expected text or raw)", format), http.StatusBadRequest)
+		return
+	}
+	s.run(w, r, app)
+}
+
+func (s *server) handleContext(w http.ResponseWriter, r *http.Request) {
+	// Omitted fields keep the server options.
+	req := s.app.contextRequest()
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBody))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		http.Error(w, "invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	app, err := s.newApp(req.Path)
+	if err != nil {
+		s.pathError(w, err)
+		return
+	}
+	req.apply(app)
+	s.run(w, r, app)
+}
+
+// queryApp returns the app of a GET request, with the path, include and exclude query parameters.
+// It writes the error response (and returns false) if the path is invalid.
+func (s *server) queryApp(w http.ResponseWriter, r *http.Request) (*App, bool) {
+	query := r.URL.Query()
+	app, err := s.newApp(query.Get("path"))
+	if err != nil {
+		s.pathError(w, err)
+		return nil, false
+	}
+	if query.Has("include") {
+		app.Include = query.Get("include")
+	}
+	if query.Has("exclude") {
+		app.Exclude = query.Get("exclude")
+	}
+	return app, true
+}
+
+// newApp returns a copy of the server app processing the given path (relative to the root).
+func (s *server) newApp(path string) (*App, error) {
+	inputPath, err := s.resolve(path)
+	if err != nil {
+		return nil, err
+	}
+	app := s.app
+	app.InputPath, app.Local = inputPath, true
+	return &app, nil
+}
+
+// resolve returns the input path of a slash-separated path relative to the root (leading
+// slashes are ignored). Paths escaping the root, with ".." or through symlinks, are rejected.
+func (s *server) resolve(path string) (string, error) {
+	rel := filepath.FromSlash(strings.TrimLeft(path, "/"))
+	if rel == "" || rel == "." {
+		return s.root, nil
+	}
+	if !filepath.IsLocal(rel) {
+		return "", errOutsideRoot
+	}
+	inputPath := filepath.Join(s.root, rel)
+	if _, err := os.Stat(inputPath); err != nil {
+		return "", err
+	}
+	if !resolvesWithin(s.realRoot, inputPath) {
+		return "", errOutsideRoot
+	}
+	return inputPath, nil
+}
+
+// resolvesWithin reports whether path, with symlinks resolved, is realRoot or below it.
+// Paths which can't be resolved (e.g. broken symlinks) are not.
+func resolvesWithin(realRoot, path string) bool {
+	realPath, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return false
+	}
+	if realPath, err = filepath.Abs(realPath); err != nil {
+		return false
+	}
+	rel, err := filepath.Rel(realRoot, realPath)
+	return err == nil && (rel == "." || filepath.IsLocal(rel))
+}
+
+// outputPath returns the path of a file as shown in the output: relative to pathBase if set.
+func (a *App) outputPath(path string) string {
+	if a.pathBase == "" {
+		return path
+	}
+	if rel, err := filepath.Rel(a.pathBase, path); err == nil {
+		return rel
+	}
+	return path
+}
+
+// pathError writes the error response of an invalid request path.
+func (s *server) pathError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		http.Error(w, "path not found", http.StatusNotFound)
+	case errors.Is(err, errOutsideRoot):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	default:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	}
+}
+
+// run streams the output of the app as the response. Errors occurring before
+// any output are reported with an error status; later ones abort the response.
+func (s *server) run(w http.ResponseWriter, r *http.Request, app *App) {
+	if err := app.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	out := &responseWriter{w: w}
+	app.Out = out
+	err := app.Run(r.Context())
+	switch {
+	case err == nil:
+		if !out.started {
+			// Empty output.
+			out.start()
+		}
+	case r.Context().Err() != nil:
+		// The client is gone.
+	case !out.started:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	default:
+		s.app.logger().Errorf("%s %s: %s", r.Method, r.URL, err)
+		panic(http.ErrAbortHandler)
+	}
+}
+
+// validate checks the options of a request before running it.
+func (a *App) validate() error {
+	if !a.TreeEnabled && !a.SourceEnabled {
+		return errors.New("at least one of tree or source mode must be enabled")
+	}
+	for _, include := range []string{a.Include, a.SourceInclude, a.TreeInclude} {
+		if _, _, err := splitTargets(include); err != nil {
+			return err
+		}
+	}
+	return a.checkOptions()
+}
+
+// contextRequest returns the request of the app options.
+func (a *App) contextRequest() contextRequest {
+	return contextRequest{
+		Targets:            a.Targets,
+		Include:            a.Include,
+		Exclude:            a.Exclude,
+		TreeEnabled:        a.TreeEnabled,
+		TreeInclude:        a.TreeInclude,
+		TreeExclude:        a.TreeExclude,
+		SourceEnabled:      a.SourceEnabled,
+		SourceInclude:      a.SourceInclude,
+		SourceExclude:      a.SourceExclude,
+		SourceThreshold:    a.SourceThreshold,
+		Oversize:           a.Oversize,
+		OversizeHead:       a.OversizeHead,
+		OversizeTail:       a.OversizeTail,
+		StripComments:      a.StripComments,
+		KeepDocComments:    a.KeepDocComments,
+		CollapseBlankLines: a.CollapseBlankLines,
+		LineNumbers:        a.LineNumbers,
+		MaskPII:            a.MaskPII,
+		Skeleton:           a.Skeleton,
+		Outline:            a.Outline,
+		Full:               a.Full,
+		History:            a.History,
+		FileHistory:        a.FileHistory,
+		Blame:              a.Blame,
+		BlameThreshold:     a.BlameThreshold,
+		Order:              a.Order,
+		Since:              a.Since,
+		Raw:                a.Raw,
+		MaxOutputSize:      a.MaxOutputSize,
+	}
+}
+
+// apply sets the options of the request to the app.
+func (req *contextRequest) apply(a *App) {
+	a.Targets = req.Targets
+	a.Include, a.Exclude = req.Include, req.Exclude
+	a.TreeEnabled, a.TreeInclude, a.TreeExclude = req.TreeEnabled, req.TreeInclude, req.TreeExclude
+	a.SourceEnabled, a.SourceInclude, a.SourceExclude = req.SourceEnabled, req.SourceInclude, req.SourceExclude
+	a.SourceThreshold = req.SourceThreshold
+	a.Oversize, a.OversizeHead, a.OversizeTail = req.Oversize, req.OversizeHead, req.OversizeTail
+	a.StripComments, a.KeepDocComments = req.StripComments, req.KeepDocComments
+	a.CollapseBlankLines, a.LineNumbers, a.MaskPII = req.CollapseBlankLines, req.LineNumbers, req.MaskPII
+	a.Skeleton, a.Outline, a.Full = req.Skeleton, req.Outline, req.Full
+	a.History, a.FileHistory = req.History, req.FileHistory
+	a.Blame, a.BlameThreshold = req.Blame, req.BlameThreshold
+	a.Order, a.Since = req.Order, req.Since
+	a.Raw, a.MaxOutputSize = req.Raw, req.MaxOutputSize
+}
+
+// responseWriter streams the output to an HTTP response. The response starts (with a 200 status)
+// on the first write, so errors occurring before any output can still be reported.
+type responseWriter struct {
+	w       http.ResponseWriter
+	started bool
+}
+
+func (rw *responseWriter) start() {
+	rw.started = true
+	rw.w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	rw.w.Header().Set("X-Content-Type-Options", "nosniff")
+	rw.w.WriteHeader(http.StatusOK)
+}
+
+func (rw *responseWriter) Write(p []byte) (int, error) {
+	if !rw.started {
+		rw.start()
+	}
+	return rw.w.Write(p)
+}
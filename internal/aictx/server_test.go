@@ -0,0 +1,142 @@
+package aictx_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/amberpixels/aictx/internal/aictx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServer(t *testing.T) {
+	outside := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(outside, "secret.txt"), []byte("top secret\n"), 0o600))
+
+	root := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(root, "pkg"), 0o700))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "pkg", "a.go"), []byte("package pkg\n"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "README.md"), []byte("# Readme\n"), 0o600))
+	require.NoError(t, os.Symlink(outside, filepath.Join(root, "link")))
+	require.NoError(t, os.Symlink(filepath.Join(outside, "secret.txt"), filepath.Join(root, "leak.txt")))
+	require.NoError(t, os.Symlink("README.md", filepath.Join(root, "readme-link.txt")))
+	require.NoError(t, os.WriteFile(filepath.Join(root, ".env"), []byte("HIDDEN=1\n"), 0o600))
+
+	cacheDir := t.TempDir()
+	app := &aictx.App{
+		InputPath:       root,
+		TreeEnabled:     true,
+		SourceEnabled:   true,
+		SourceThreshold: 1,
+		Incremental:     true,
+		CacheDir:        cacheDir,
+	}
+	handler, err := app.Handler()
+	require.NoError(t, err)
+	srv := httptest.NewServer(handler)
+	defer srv.Close()
+
+	do := func(method, target, body string) (int, string) {
+		req, err := http.NewRequest(method, srv.URL+target, strings.NewReader(body))
+		require.NoError(t, err)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		data, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return resp.StatusCode, string(data)
+	}
+
+	t.Run("tree", func(t *testing.T) {
+		status, body := do(http.MethodGet, "/tree?path=pkg", "")
+		assert.Equal(t, http.StatusOK, status)
+		assert.Contains(t, body, "a.go")
+		assert.NotContains(t, body, "README.md")
+		assert.NotContains(t, body, "package pkg")
+	})
+
+	t.Run("source", func(t *testing.T) {
+		status, body := do(http.MethodGet, "/source?include=*.md&format=raw", "")
+		assert.Equal(t, http.StatusOK, status)
+		assert.Equal(t, "# Readme\n\n", body)
+
+		status, _ = do(http.MethodGet, "/source?format=html", "")
+		assert.Equal(t, http.StatusBadRequest, status)
+	})
+
+	t.Run("relative paths", func(t *testing.T) {
+		status, body := do(http.MethodGet, "/source?path=pkg", "")
+		assert.Equal(t, http.StatusOK, status)
+		assert.Contains(t, body, "File: "+filepath.Join("pkg", "a.go")+"\n")
+		assert.NotContains(t, body, root)
+	})
+
+	t.Run("context", func(t *testing.T) {
+		status, body := do(http.MethodPost, "/context", `{"path": "pkg", "treeEnabled": false, "lineNumbers": true}`)
+		assert.Equal(t, http.StatusOK, status)
+		assert.Contains(t, body, "1 │ package pkg")
+		assert.NotContains(t, body, "Project Tree")
+
+		status, _ = do(http.MethodPost, "/context", `{"noRedactSecrets": true}`)
+		assert.Equal(t, http.StatusBadRequest, status)
+		status, _ = do(http.MethodPost, "/context", `{"order": "random"}`)
+		assert.Equal(t, http.StatusBadRequest, status)
+	})
+
+	t.Run("path traversal", func(t *testing.T) {
+		for _, path := range []string{"..", "pkg/../..", "link", "link/secret.txt"} {
+			status, body := do(http.MethodGet, "/source?path="+path, "")
+			assert.Equal(t, http.StatusForbidden, status, path)
+			assert.NotContains(t, body, "top secret", path)
+		}
+		status, _ := do(http.MethodGet, "/tree?path=missing", "")
+		assert.Equal(t, http.StatusNotFound, status)
+
+		// Symlinks below the root are followed only within it.
+		status, body := do(http.MethodGet, "/source?include=leak.txt", "")
+		assert.Equal(t, http.StatusOK, status)
+		assert.NotContains(t, body, "top secret")
+		status, body = do(http.MethodPost, "/context", `{}`)
+		assert.Equal(t, http.StatusOK, status)
+		assert.NotContains(t, body, "leak.txt")
+		assert.NotContains(t, body, "top secret")
+		assert.Contains(t, body, "File: readme-link.txt\n")
+	})
+
+	t.Run("concurrent", func(t *testing.T) {
+		var wg sync.WaitGroup
+		for range 8 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				status, body := do(http.MethodGet, "/source?path=pkg", "")
+				assert.Equal(t, http.StatusOK, status)
+				assert.Contains(t, body, "package pkg")
+			}()
+		}
+		wg.Wait()
+
+		// Concurrent requests don't share the incremental cache.
+		entries, err := os.ReadDir(cacheDir)
+		require.NoError(t, err)
+		assert.Empty(t, entries)
+	})
+
+	t.Run("hidden files", func(t *testing.T) {
+		// Hidden files follow the options of the server only.
+		status, body := do(http.MethodGet, "/tree?show-hidden=true", "")
+		assert.Equal(t, http.StatusOK, status)
+		assert.NotContains(t, body, ".env")
+		for _, req := range []string{`{"treeShowHidden": true}`, `{"sourceShowHidden": true}`} {
+			status, body = do(http.MethodPost, "/context", req)
+			assert.Equal(t, http.StatusBadRequest, status, req)
+			assert.NotContains(t, body, "HIDDEN=1", req)
+		}
+	})
+}
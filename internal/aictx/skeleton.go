@@ -0,0 +1,111 @@
+package aictx
+
+import (
+	"bytes"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"path/filepath"
+)
+
+// skeletonBody replaces the elided function bodies in skeletons.
+const skeletonBody = " { ... }"
+
+// isGoFile reports whether the path is a Go source file.
+func isGoFile(path string) bool {
+	return filepath.Ext(path) == ".go"
+}
+
+// goSkeleton reduces Go source to its API shape: the package clause, imports, type,
+// constant and exported variable declarations, and the signatures of exported functions
+// and methods, with their doc comments. Function bodies are replaced by "{ ... }".
+func goSkeleton(src []byte) ([]byte, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", src, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if file.Doc != nil {
+		for _, c := range file.Doc.List {
+			buf.WriteString(c.Text + "\n")
+		}
+	}
+	buf.WriteString("package " + file.Name.Name + "\n")
+
+	for _, decl := range file.Decls {
+		var node any
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			if !isExportedFunc(d) {
+				continue
+			}
+			signature := *d
+			signature.Body = nil
+			node = &signature
+		case *ast.GenDecl:
+			if d.Tok == token.VAR && !hasExportedNames(d) {
+				continue
+			}
+			node = d
+		default:
+			continue
+		}
+
+		buf.WriteByte('\n')
+		// Comments are limited to the node's range, so the ones in removed bodies are dropped.
+		if err := format.Node(&buf, fset, &printer.CommentedNode{Node: node, Comments: file.Comments}); err != nil {
+			return nil, err
+		}
+		if fn, ok := decl.(*ast.FuncDecl); ok && fn.Body != nil {
+			buf.WriteString(skeletonBody)
+		}
+		buf.WriteByte('\n')
+	}
+
+	return buf.Bytes(), nil
+}
+
+// isExportedFunc reports whether the function is exported, i.e. it has an exported name
+// and, for methods, an exported receiver type.
+func isExportedFunc(fn *ast.FuncDecl) bool {
+	if !fn.Name.IsExported() {
+		return false
+	}
+	if fn.Recv == nil || len(fn.Recv.List) == 0 {
+		return true
+	}
+
+	typ := fn.Recv.List[0].Type
+	for {
+		switch t := typ.(type) {
+		case *ast.StarExpr:
+			typ = t.X
+		case *ast.IndexExpr: // generic receiver T[K]
+			typ = t.X
+		case *ast.IndexListExpr: // generic receiver T[K, V]
+			typ = t.X
+		case *ast.Ident:
+			return t.IsExported()
+		default:
+			return true
+		}
+	}
+}
+
+// hasExportedNames reports whether any of the declared names is exported.
+func hasExportedNames(d *ast.GenDecl) bool {
+	for _, spec := range d.Specs {
+		if vs, ok := spec.(*ast.ValueSpec); ok {
+			for _, name := range vs.Names {
+				if name.IsExported() {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,99 @@
+package aictx_test
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/amberpixels/aictx/internal/aictx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSkeleton(t *testing.T) {
+	const src = `// Package shapes is documented.
+package shapes
+
+import "math"
+
+// Shape is a geometric shape.
+type Shape interface {
+	// Area returns the area.
+	Area() float64
+}
+
+// Circle is a round shape.
+type Circle struct {
+	R float64 // radius
+}
+
+var cache = map[string]float64{}
+
+// Default is the default circle.
+var Default = Circle{R: 1}
+
+// Area returns the area of the circle.
+func (c Circle) Area() float64 {
+	// pi times r squared
+	return math.Pi * c.R * c.R
+}
+
+func helper() {}
+
+type private struct{}
+
+// Exported is not part of the API as its receiver is unexported.
+func (p private) Exported() {}
+`
+	const expected = `// Package shapes is documented.
+package shapes
+
+import "math"
+
+// Shape is a geometric shape.
+type Shape interface {
+	// Area returns the area.
+	Area() float64
+}
+
+// Circle is a round shape.
+type Circle struct {
+	R float64 // radius
+}
+
+// Default is the default circle.
+var Default = Circle{R: 1}
+
+// Area returns the area of the circle.
+func (c Circle) Area() float64 { ... }
+
+type private struct{}
+
+`
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "shapes.go"), []byte(src), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "full.go"), []byte(src), 0o600))
+
+	run := func(input string) string {
+		var out bytes.Buffer
+		app := &aictx.App{
+			InputPath:       filepath.Join(dir, input),
+			Local:           true,
+			SourceEnabled:   true,
+			SourceThreshold: 1,
+			Raw:             true,
+			Skeleton:        true,
+			Full:            "full.go",
+			Out:             &out,
+		}
+		require.NoError(t, app.Run(context.Background()))
+		return out.String()
+	}
+
+	assert.Equal(t, expected, run("shapes.go"))
+	// Files matching --full are kept complete.
+	assert.Equal(t, src+"\n", run("full.go"))
+}
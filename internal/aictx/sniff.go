@@ -0,0 +1,144 @@
+package aictx
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/go-git/go-billy/v5"
+)
+
+// sniffSize is the number of first bytes of a file read to detect its type.
+const sniffSize = 8 * KB
+
+// MIME types of UTF-16 text, detected from the byte order mark.
+const (
+	mimeUTF16BE = "text/plain; charset=utf-16be"
+	mimeUTF16LE = "text/plain; charset=utf-16le"
+)
+
+// magicNumbers are the signatures of binary formats not detected by http.DetectContentType
+// (which covers images, audio, video, fonts, PDF and common archives).
+//
+//nolint:gochecknoglobals // Hardcoded signatures.
+var magicNumbers = []struct {
+	offset int
+	magic  string
+	mime   string
+}{
+	{0, "\x7fELF", "application/x-elf"},
+	{0, "\xfe\xed\xfa\xce", "application/x-mach-binary"},
+	{0, "\xfe\xed\xfa\xcf", "application/x-mach-binary"},
+	{0, "\xce\xfa\xed\xfe", "application/x-mach-binary"},
+	{0, "\xcf\xfa\xed\xfe", "application/x-mach-binary"},
+	{0, "\xca\xfe\xba\xbe", "application/java-vm"},
+	{0, "MZ\x90\x00", "application/vnd.microsoft.portable-executable"},
+	{0, "SQLite format 3\x00", "application/vnd.sqlite3"},
+	{0, "7z\xbc\xaf\x27\x1c", "application/x-7z-compressed"},
+	{0, "\xfd7zXZ\x00", "application/x-xz"},
+	{0, "\x28\xb5\x2f\xfd", "application/zstd"},
+	{0, "BZh", "application/x-bzip2"},
+	{257, "ustar", "application/x-tar"},
+}
+
+// contentType is the type of a file, detected from its first bytes.
+type contentType struct {
+	mime   string
+	binary bool
+	lfs    bool
+}
+
+// sniff detects the type of a file from its first bytes (head) and its size.
+// Files are binary if they match a binary signature, or (unless they start with
+// a UTF-16 byte order mark) if their head contains a NUL byte or is not valid UTF-8.
+func sniff(head []byte, size int64) contentType {
+	if len(head) > sniffSize {
+		head = head[:sniffSize]
+	}
+	ct := contentType{lfs: isLFSPointer(head, size)}
+
+	for _, m := range magicNumbers {
+		if len(head) >= m.offset+len(m.magic) && string(head[m.offset:m.offset+len(m.magic)]) == m.magic {
+			// "BZh" is a plausible start of a text file: require the block size digit.
+			if m.magic == "BZh" && (len(head) < 4 || head[3] < '1' || head[3] > '9') { //nolint:mnd // "BZh" + digit
+				continue
+			}
+			ct.mime, ct.binary = m.mime, true
+			return ct
+		}
+	}
+
+	ct.mime = http.DetectContentType(head)
+	switch {
+	case ct.mime == mimeUTF16BE || ct.mime == mimeUTF16LE:
+		return ct
+	case !strings.HasPrefix(ct.mime, "text/") && ct.mime != "application/octet-stream" &&
+		ct.mime != "application/postscript":
+		// Images, audio, video, fonts, PDF and archives.
+		ct.binary = true
+	default:
+		ct.binary = bytes.IndexByte(head, 0) >= 0 || !validUTF8(head, size > int64(len(head)))
+	}
+	if ct.binary && strings.HasPrefix(ct.mime, "text/") {
+		ct.mime = "application/octet-stream"
+	}
+	return ct
+}
+
+// validUTF8 reports whether head is valid UTF-8. If head is truncated (the first bytes
+// of a larger file), it may end in the middle of a character.
+func validUTF8(head []byte, truncated bool) bool {
+	if truncated {
+		for i := 1; i < utf8.UTFMax && i <= len(head); i++ {
+			if utf8.RuneStart(head[len(head)-i]) {
+				if !utf8.FullRune(head[len(head)-i:]) {
+					head = head[:len(head)-i]
+				}
+				break
+			}
+		}
+	}
+	return utf8.Valid(head)
+}
+
+// sniffFile detects the type of the file at path (of the given size) by reading its first bytes.
+func sniffFile(fsys billy.Filesystem, path string, size int64) (contentType, error) {
+	f, err := fsys.Open(path)
+	if err != nil {
+		return contentType{}, err
+	}
+	defer f.Close()
+
+	head := make([]byte, sniffSize)
+	n, err := io.ReadFull(f, head)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return contentType{}, err
+	}
+	return sniff(head[:n], size), nil
+}
+
+// decodeText converts UTF-16 text (as detected by sniff) to UTF-8.
+// Other data is returned unchanged.
+func decodeText(data []byte, mime string) []byte {
+	var order binary.ByteOrder
+	switch mime {
+	case mimeUTF16BE:
+		order = binary.BigEndian
+	case mimeUTF16LE:
+		order = binary.LittleEndian
+	default:
+		return data
+	}
+
+	data = data[2:] // Skip the byte order mark.
+	units := make([]uint16, len(data)/2)
+	for i := range units {
+		units[i] = order.Uint16(data[2*i:])
+	}
+	return []byte(string(utf16.Decode(units)))
+}
@@ -0,0 +1,58 @@
+package aictx_test
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf16"
+
+	"github.com/amberpixels/aictx/internal/aictx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSniffContent(t *testing.T) {
+	utf16le := []byte{0xff, 0xfe}
+	for _, u := range utf16.Encode([]rune("héllo wörld\n")) {
+		utf16le = append(utf16le, byte(u), byte(u>>8))
+	}
+	files := map[string][]byte{
+		"image.png": []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"),
+		"app":       []byte("\x7fELF\x02\x01\x01"),
+		"data.db":   []byte("SQLite format 3\x00"),
+		"doc.pdf":   []byte("%PDF-1.7\n"),
+		"utf16.txt": utf16le,
+		// A multi-byte character crosses the end of the sniffed window.
+		"large.txt": []byte(strings.Repeat("a", 8*1024-1) + "é" + strings.Repeat("b", 100)),
+		"lfs.bin":   []byte("version https://git-lfs.github.com/spec/v1\noid sha256:abc\nsize 12345\n"),
+	}
+	dir := t.TempDir()
+	for name, data := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), data, 0o600))
+	}
+
+	var out bytes.Buffer
+	app := &aictx.App{
+		InputPath:       dir,
+		Local:           true,
+		TreeEnabled:     true,
+		SourceEnabled:   true,
+		SourceThreshold: 1,
+		Out:             &out,
+	}
+	require.NoError(t, app.Run(context.Background()))
+
+	for _, line := range []string{
+		"app *", "data.db *", "doc.pdf *", "image.png *", "lfs.bin (LFS)", "large.txt\n", "utf16.txt\n",
+	} {
+		assert.Contains(t, out.String(), line)
+	}
+	// UTF-16 text is emitted as UTF-8.
+	assert.Contains(t, out.String(), "-\nhéllo wörld\n")
+	assert.Contains(t, out.String(), "aé"+strings.Repeat("b", 100))
+	assert.NotContains(t, out.String(), "ELF")
+	assert.NotContains(t, out.String(), "%PDF")
+}
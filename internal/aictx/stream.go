@@ -0,0 +1,384 @@
+package aictx
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+
+	"github.com/go-git/go-billy/v5"
+)
+
+// streamBufferSize is the size of the buffers files are streamed through.
+const streamBufferSize = 64 * KB
+
+// minStreamSize is the size from which files are streamed: smaller files are rendered in
+// memory, from a single read.
+const minStreamSize = MB
+
+// maxStreamLine is the maximum length of the lines transformed when files are streamed:
+// longer lines (minified or generated code) are processed in parts of about this size,
+// so a secret spanning two parts is not redacted.
+const maxStreamLine = MB
+
+// streams reports whether the file is streamed: rendered line by line when it is written instead
+// of being read in memory. Large files are streamed unless a transform needs their whole content.
+func (a *App) streams(node *TreeNode) bool {
+	switch {
+	case node.Size < minStreamSize:
+		return false
+	case node.Oversized && a.Oversize != OversizeTruncate:
+		// Outlines need the whole file.
+		return false
+	case len(a.targetsFor(node.Path)) > 0, a.outlinerFor(node.Path) != nil:
+		return false
+	case a.Blame && a.git != nil:
+		return false
+	case (a.StripComments || a.KeepDocComments) && commentSyntaxFor(node.Path) != nil:
+		return false
+	case node.MIME == mimeUTF16BE || node.MIME == mimeUTF16LE:
+		// UTF-16 text is decoded in memory.
+		return false
+	}
+	return true
+}
+
+// streamedFile is a file rendered line by line when it is written. Its rendered lines are
+// spooled to a temporary file, so that the header, which needs the line count and the notes,
+// comes first while the file is read once and never held in memory.
+type streamedFile struct {
+	spool     *os.File
+	lineCount int
+	notes     []string
+	secrets   []secretFinding
+	masked    []string
+	// newline is set if the file ends with a newline.
+	newline bool
+	// ranges are the ranges of lines kept from truncated files, separated by gap.
+	ranges []lineRange
+	gap    string
+}
+
+// Kinds of the records of a spool.
+const (
+	// spoolLine is a line of the output.
+	spoolLine byte = iota
+	// spoolPart continues the previous line, for lines longer than maxStreamLine.
+	spoolPart
+)
+
+// streamFile renders the file line by line, applying the line based transforms on the way:
+// secret redaction, truncation of oversized files, blank line collapsing and masking, with the
+// values masked by rules without replacement replaced by placeholder. Line numbers are added
+// when it is written (see writeTo), once the line count is known. The caller must close the
+// returned file.
+func (a *App) streamFile(fs billy.Filesystem, node *TreeNode,
+	placeholder func(kind, value string) string,
+) (*streamedFile, error) {
+	f, err := fs.Open(node.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	// Oversized files keep their first head lines and the lines from tailStart on.
+	head, tail := max(a.OversizeHead, 0), max(a.OversizeTail, 0)
+	tailStart := int64(-1)
+	if node.Oversized {
+		if tailStart, err = tailOffset(f, tail); err != nil {
+			return nil, err
+		}
+	}
+
+	spool, err := os.CreateTemp("", "aictx-stream-*")
+	if err != nil {
+		return nil, err
+	}
+	sf := &streamedFile{spool: spool}
+	if err := a.spoolLines(f, node.Path, sf, head, tailStart, placeholder); err != nil {
+		sf.close()
+		return nil, err
+	}
+	if _, err := spool.Seek(0, io.SeekStart); err != nil {
+		sf.close()
+		return nil, err
+	}
+
+	if node.Oversized {
+		sf.ranges, sf.gap = truncateRanges(sf.lineCount, head, tail)
+		sf.notes = append(sf.notes, oversizeTruncateNote(sf.ranges, head, tail, sf.lineCount))
+	}
+	return sf, nil
+}
+
+// tailOffset returns the offset of the last tail lines of the file, read backwards from its end.
+// The file is left at its start.
+func tailOffset(f billy.File, tail int) (int64, error) {
+	size, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+	if tail == 0 {
+		return size, nil
+	}
+
+	buf := make([]byte, streamBufferSize)
+	newlines := 0
+	for end := size; end > 0; {
+		start := max(end-int64(len(buf)), 0)
+		chunk := buf[:end-start]
+		if _, err := f.ReadAt(chunk, start); err != nil && !errors.Is(err, io.EOF) {
+			return 0, err
+		}
+		for i := len(chunk) - 1; i >= 0; i-- {
+			// A final newline ends the last line.
+			if chunk[i] != '\n' || start+int64(i) == size-1 {
+				continue
+			}
+			if newlines++; newlines == tail {
+				return start + int64(i) + 1, nil
+			}
+		}
+		end = start
+	}
+	return 0, nil
+}
+
+// spoolLines renders the lines read from r to the spool of sf (see streamFile). Unless tailStart
+// is negative, only the first head lines and the lines from the offset tailStart on are kept.
+func (a *App) spoolLines(r io.Reader, path string, sf *streamedFile, head int, tailStart int64,
+	placeholder func(kind, value string) string,
+) error {
+	lr := lineReader{r: bufio.NewReaderSize(r, streamBufferSize)}
+	bw := bufio.NewWriterSize(sf.spool, streamBufferSize)
+	redactor := secretRedactor{path: path}
+	maskRules := a.maskRulesFor(path)
+
+	// pendingBlank is set when blank lines following kept (non-blank) lines were collapsed.
+	var pendingBlank, kept bool
+	for {
+		l, eol, part, err := lr.next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		sf.newline = eol
+		sf.lineCount = l.Num
+
+		if tailStart >= 0 && l.Num > head && lr.start < tailStart {
+			// Elided lines are only followed for private keys, so that kept lines are
+			// redacted as if the whole file was.
+			if !a.NoRedactSecrets {
+				redactor.skip(l)
+			}
+			continue
+		}
+
+		// Like in memory, the lines of private keys are dropped before blank lines are collapsed.
+		if !a.NoRedactSecrets {
+			var ok bool
+			if l, ok = redactor.redact(l, &sf.secrets); !ok {
+				// The private key is reported if any of its lines is kept.
+				key := secretFinding{Path: path, Line: redactor.keyLine, Kind: "private-key"}
+				if !slices.Contains(sf.secrets, key) {
+					sf.secrets = append(sf.secrets, key)
+				}
+				continue
+			}
+		}
+
+		lines := []sourceLine{l}
+		if a.CollapseBlankLines && !part {
+			if len(bytes.TrimSpace(l.Text)) == 0 {
+				pendingBlank = kept
+				continue
+			}
+			if pendingBlank {
+				lines = []sourceLine{{Num: l.Num - 1}, l}
+				pendingBlank = false
+			}
+			kept = true
+		}
+
+		for _, l := range lines {
+			if len(maskRules) > 0 {
+				l.Text = maskLine(maskRules, l.Text, placeholder, &sf.masked)
+			}
+			kind := spoolLine
+			if part {
+				kind = spoolPart
+			}
+			writeSpoolRecord(bw, kind, l)
+		}
+	}
+	return bw.Flush()
+}
+
+// writeSpoolRecord writes a line to a spool: its kind, number, length and text.
+func writeSpoolRecord(w *bufio.Writer, kind byte, l sourceLine) {
+	w.WriteByte(kind)
+	w.Write(binary.AppendUvarint(nil, uint64(l.Num)))
+	w.Write(binary.AppendUvarint(nil, uint64(len(l.Text))))
+	w.Write(l.Text)
+}
+
+// writeTo writes the spooled lines to w, numbered like in memory if lineNumbers is set:
+// aligned to the line count of the file.
+func (sf *streamedFile) writeTo(w io.Writer, lineNumbers bool) error {
+	br := bufio.NewReaderSize(sf.spool, streamBufferSize)
+	bw := bufio.NewWriterSize(w, streamBufferSize)
+	width := len(strconv.Itoa(sf.lineCount))
+
+	// Lines are separated by newlines, and the output ends with one if the file does.
+	// Like in memory, gap separates the lines of different ranges of truncated files.
+	var text []byte
+	var written bool
+	prevRange := -1
+	for {
+		kind, err := br.ReadByte()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		num, err := binary.ReadUvarint(br)
+		if err != nil {
+			return err
+		}
+		n, err := binary.ReadUvarint(br)
+		if err != nil {
+			return err
+		}
+		text = slices.Grow(text[:0], int(n))[:n]
+		if _, err := io.ReadFull(br, text); err != nil {
+			return err
+		}
+
+		l := sourceLine{Num: int(num), Text: text}
+		if kind == spoolLine {
+			if len(sf.ranges) > 1 {
+				idx := rangeIndex(sf.ranges, l.Num)
+				if prevRange >= 0 && idx != prevRange {
+					bw.WriteString("\n" + sf.gap)
+				}
+				prevRange = idx
+			}
+			if written {
+				bw.WriteByte('\n')
+			}
+			if lineNumbers {
+				l = numberLine(l, width)
+			}
+		}
+		if _, err := bw.Write(l.Text); err != nil {
+			return err
+		}
+		written = true
+	}
+	if written && sf.newline {
+		bw.WriteByte('\n')
+	}
+	return bw.Flush()
+}
+
+// close removes the spool of the file.
+func (sf *streamedFile) close() {
+	sf.spool.Close()
+	os.Remove(sf.spool.Name())
+}
+
+// lineReader reads the lines of a streamed file.
+type lineReader struct {
+	r   *bufio.Reader
+	buf []byte
+	num int
+	// cont is set when the next part continues the current line.
+	cont bool
+	// off is the offset of the next byte read, and start the offset of the current line.
+	off, start int64
+}
+
+// next returns the next line, or the next part of a line longer than maxStreamLine, whether
+// it ends with a newline and whether it continues the previous part. It returns io.EOF
+// after the last line.
+func (lr *lineReader) next() (sourceLine, bool, bool, error) {
+	lr.buf = lr.buf[:0]
+	if !lr.cont {
+		lr.start = lr.off
+	}
+	for {
+		chunk, err := lr.r.ReadSlice('\n')
+		lr.buf = append(lr.buf, chunk...)
+		lr.off += int64(len(chunk))
+		full := errors.Is(err, bufio.ErrBufferFull)
+		switch {
+		case full && len(lr.buf) < maxStreamLine:
+			continue
+		case errors.Is(err, io.EOF) && len(lr.buf) == 0:
+			return sourceLine{}, false, false, io.EOF
+		case err != nil && !full && !errors.Is(err, io.EOF):
+			return sourceLine{}, false, false, err
+		}
+
+		part := lr.cont
+		if !part {
+			lr.num++
+		}
+		lr.cont = full
+		eol := err == nil
+		text := lr.buf
+		if eol {
+			text = text[:len(text)-1]
+		}
+		return sourceLine{Num: lr.num, Text: text}, eol, part, nil
+	}
+}
+
+// errOutputLimit is returned by writes exceeding MaxOutputSize.
+var errOutputLimit = errors.New("maximum output size exceeded")
+
+// limitWriter writes up to limit bytes (without limit if <= 0) to w. The write exceeding
+// the limit is cut after its last complete line, so the output stops cleanly.
+type limitWriter struct {
+	w        io.Writer
+	limit    int64
+	n        int64
+	exceeded bool
+}
+
+func (lw *limitWriter) Write(p []byte) (int, error) {
+	if lw.exceeded {
+		return 0, errOutputLimit
+	}
+	if lw.limit <= 0 || lw.n+int64(len(p)) <= lw.limit {
+		n, err := lw.w.Write(p)
+		lw.n += int64(n)
+		return n, err
+	}
+
+	lw.exceeded = true
+	keep := p[:lw.limit-lw.n]
+	keep = keep[:bytes.LastIndexByte(keep, '\n')+1]
+	n, err := lw.w.Write(keep)
+	lw.n += int64(n)
+	if err != nil {
+		return n, err
+	}
+	return n, errOutputLimit
+}
+
+// truncationNote returns the note ending an output truncated at the given limit.
+func truncationNote(limit int64) string {
+	return fmt.Sprintf("… [output truncated: exceeds the maximum output size of %s] …", formatSize(limit))
+}
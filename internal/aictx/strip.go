@@ -0,0 +1,609 @@
+package aictx
+
+import (
+	"bytes"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// commentSyntax describes the comments and literals of a language: all the stripper
+// needs to know to tell comments from code (and from comment markers inside strings).
+type commentSyntax struct {
+	lineComments  []string
+	blockComments []blockComment
+	strings       []stringLiteral // longer delimiters first (`"""` before `"`)
+
+	// nestedBlocks allows block comments to nest (Rust).
+	nestedBlocks bool
+	// tokenComments requires line comments to start a token: "$#" or "a#b" are code (Shell, YAML).
+	tokenComments bool
+	// tokenStrings requires quotes to start a token, so that "it's" is plain text (YAML).
+	tokenStrings bool
+	// regexLiterals enables JS regular expression literals ("/\/*/" is not a comment).
+	regexLiterals bool
+	// charLiterals tells Rust char literals ('"') from lifetimes ('a).
+	charLiterals bool
+	// blockScalars keeps YAML block scalars ("key: |") verbatim.
+	blockScalars bool
+	// docStrings treats triple-quoted strings opening a module, class or function body
+	// as doc comments (Python).
+	docStrings bool
+
+	// isDoc reports whether the comment src[start:end] is a doc comment.
+	isDoc func(src []byte, start, end int) bool
+	// isDirective reports whether the comment src[start:end] has a meaning for the
+	// compiler or the shell (build tags, shebangs, ...) and must always be kept.
+	isDirective func(src []byte, start, end int) bool
+}
+
+// blockComment is a pair of block comment delimiters.
+type blockComment struct{ open, close string }
+
+// stringLiteral describes a string (or char) literal.
+type stringLiteral struct {
+	open, close string
+	// escape enables backslash escapes.
+	escape bool
+	// doubled escapes the closing delimiter by doubling it ('it''s').
+	doubled bool
+	// singleLine literals end at the end of the line even if not closed.
+	singleLine bool
+}
+
+// commentSyntaxes maps file extensions to the syntax of their language.
+//
+//nolint:gochecknoglobals // Hardcoded syntax table.
+var commentSyntaxes = newCommentSyntaxes()
+
+// newCommentSyntaxes builds the table of supported languages.
+func newCommentSyntaxes() map[string]*commentSyntax {
+	cStrings := []stringLiteral{
+		{open: `"`, close: `"`, escape: true, singleLine: true},
+		{open: `'`, close: `'`, escape: true, singleLine: true},
+	}
+	cSyntax := commentSyntax{
+		lineComments:  []string{"//"},
+		blockComments: []blockComment{{"/*", "*/"}},
+		strings:       cStrings,
+		isDoc:         cDoc,
+	}
+
+	goSyntax := &commentSyntax{
+		lineComments:  []string{"//"},
+		blockComments: []blockComment{{"/*", "*/"}},
+		strings: []stringLiteral{
+			{open: "`", close: "`"},
+			{open: `"`, close: `"`, escape: true, singleLine: true},
+			{open: `'`, close: `'`, escape: true, singleLine: true},
+		},
+		isDoc:       goDoc,
+		isDirective: goDirective,
+	}
+
+	javaSyntax := cSyntax
+	javaSyntax.strings = append([]stringLiteral{{open: `"""`, close: `"""`, escape: true}}, cStrings...)
+
+	jsSyntax := cSyntax
+	jsSyntax.strings = append([]stringLiteral{{open: "`", close: "`", escape: true}}, cStrings...)
+	jsSyntax.regexLiterals = true
+
+	csharpSyntax := cSyntax
+	csharpSyntax.strings = append([]stringLiteral{
+		{open: `"""`, close: `"""`},
+		{open: `@"`, close: `"`, doubled: true},
+	}, cStrings...)
+
+	rustSyntax := &commentSyntax{
+		lineComments:  []string{"//"},
+		blockComments: []blockComment{{"/*", "*/"}},
+		nestedBlocks:  true,
+		strings: []stringLiteral{
+			{open: `r##"`, close: `"##`},
+			{open: `r#"`, close: `"#`},
+			{open: `r"`, close: `"`},
+			{open: `"`, close: `"`, escape: true},
+		},
+		charLiterals: true,
+		isDoc:        rustDoc,
+	}
+
+	pythonSyntax := &commentSyntax{
+		lineComments: []string{"#"},
+		strings: []stringLiteral{
+			{open: `"""`, close: `"""`, escape: true},
+			{open: `'''`, close: `'''`, escape: true},
+			{open: `"`, close: `"`, escape: true, singleLine: true},
+			{open: `'`, close: `'`, escape: true, singleLine: true},
+		},
+		docStrings:  true,
+		isDirective: shebang,
+	}
+
+	shellSyntax := &commentSyntax{
+		lineComments:  []string{"#"},
+		tokenComments: true,
+		strings: []stringLiteral{
+			{open: `'`, close: `'`},
+			{open: `"`, close: `"`, escape: true},
+		},
+		isDirective: shebang,
+	}
+
+	sqlSyntax := &commentSyntax{
+		lineComments:  []string{"--"},
+		blockComments: []blockComment{{"/*", "*/"}},
+		strings: []stringLiteral{
+			{open: `$$`, close: `$$`},
+			{open: `'`, close: `'`, doubled: true},
+			{open: `"`, close: `"`, doubled: true},
+		},
+	}
+
+	yamlSyntax := &commentSyntax{
+		lineComments:  []string{"#"},
+		tokenComments: true,
+		strings: []stringLiteral{
+			{open: `'`, close: `'`, doubled: true, singleLine: true},
+			{open: `"`, close: `"`, escape: true, singleLine: true},
+		},
+		tokenStrings: true,
+		blockScalars: true,
+	}
+
+	syntaxes := make(map[string]*commentSyntax)
+	for exts, syntax := range map[string]*commentSyntax{
+		".go":                                   goSyntax,
+		".c,.h,.cc,.cpp,.cxx,.hh,.hpp,.hxx":     &cSyntax,
+		".java":                                 &javaSyntax,
+		".cs":                                   &csharpSyntax,
+		".js,.jsx,.mjs,.cjs,.ts,.tsx,.mts,.cts": &jsSyntax,
+		".rs":                                   rustSyntax,
+		".py,.pyi":                              pythonSyntax,
+		".sh,.bash,.zsh":                        shellSyntax,
+		".sql":                                  sqlSyntax,
+		".yml,.yaml":                            yamlSyntax,
+	} {
+		for _, ext := range strings.Split(exts, ",") {
+			syntaxes[ext] = syntax
+		}
+	}
+	return syntaxes
+}
+
+// commentSyntaxFor returns the comment syntax for the file, or nil for unknown languages.
+func commentSyntaxFor(path string) *commentSyntax {
+	return commentSyntaxes[strings.ToLower(filepath.Ext(path))]
+}
+
+// stripComments removes the comments from src and returns the remaining lines.
+// Lines left empty by the removal are dropped, while lines that were blank in the
+// original are kept. Doc comments are kept if keepDoc is set.
+func stripComments(syntax *commentSyntax, src []byte, keepDoc bool) []sourceLine {
+	if len(src) == 0 {
+		return nil
+	}
+
+	s := &stripper{
+		syntax:       syntax,
+		src:          src,
+		keepDoc:      keepDoc,
+		out:          make([]byte, 0, len(src)),
+		stripped:     make(map[int]bool),
+		scalarIndent: -1,
+	}
+	s.run()
+
+	rawLines := bytes.Split(bytes.TrimSuffix(s.out, []byte("\n")), []byte("\n"))
+	lines := make([]sourceLine, 0, len(rawLines))
+	for i, text := range rawLines {
+		if s.stripped[i] {
+			text = bytes.TrimRight(text, " \t\r")
+			if len(bytes.TrimSpace(text)) == 0 {
+				continue
+			}
+		}
+		lines = append(lines, sourceLine{Num: i + 1, Text: text})
+	}
+	return lines
+}
+
+// maskLiterals returns a copy of src where comments and the contents of string literals
+// are replaced by spaces. Offsets and line breaks are preserved, so that the structure
+// of the code (keywords, braces) can be analyzed without being fooled by them.
+func maskLiterals(syntax *commentSyntax, src []byte) []byte {
+	s := &stripper{
+		syntax:       syntax,
+		src:          src,
+		mask:         true,
+		out:          make([]byte, 0, len(src)),
+		stripped:     make(map[int]bool),
+		scalarIndent: -1,
+	}
+	s.run()
+	return s.out
+}
+
+// stripper is the state of a single stripComments or maskLiterals run.
+// The output keeps the line structure of the source: removed multi-line comments
+// leave their newlines behind, so that line numbers are preserved.
+type stripper struct {
+	syntax  *commentSyntax
+	src     []byte
+	keepDoc bool
+	mask    bool
+
+	out      []byte
+	line     int          // current (0-based) line
+	stripped map[int]bool // lines a comment was removed from
+
+	// lastCode is the last non-space byte of code (0 at the start of the file).
+	lastCode byte
+	// scalarIndent is the indentation of the line opening a YAML block scalar (-1 if none).
+	scalarIndent int
+}
+
+func (s *stripper) run() {
+	src := s.src
+	for i := 0; i < len(src); {
+		if s.scalarIndent >= 0 && (i == 0 || src[i-1] == '\n') {
+			if end, ok := s.blockScalarLine(i); ok {
+				s.emit(src[i:end])
+				i = end
+				continue
+			}
+			s.scalarIndent = -1
+		}
+
+		if src[i] == '\n' {
+			if s.syntax.blockScalars {
+				s.checkBlockScalar()
+			}
+			s.emit(src[i : i+1])
+			i++
+			continue
+		}
+
+		if end, ok := s.matchComment(i); ok {
+			s.comment(i, end)
+			i = end
+			continue
+		}
+		if end, ok := s.matchString(i); ok {
+			if s.syntax.docStrings && end-i >= 6 && s.isDocString(i, end) {
+				if s.keepDoc && !s.mask {
+					s.emit(src[i:end])
+				} else {
+					s.remove(src[i:end])
+				}
+			} else {
+				s.literal(src[i:end])
+			}
+			i = end
+			continue
+		}
+		if end, ok := s.matchLiteral(i); ok {
+			s.literal(src[i:end])
+			i = end
+			continue
+		}
+
+		s.emit(src[i : i+1])
+		i++
+	}
+}
+
+// emit copies code to the output.
+func (s *stripper) emit(b []byte) {
+	for _, c := range b {
+		switch c {
+		case '\n':
+			s.line++
+		case ' ', '\t', '\r':
+		default:
+			s.lastCode = c
+		}
+	}
+	s.out = append(s.out, b...)
+}
+
+// remove drops a comment from the output, keeping its newlines.
+// In mask mode the comment is replaced by spaces instead.
+func (s *stripper) remove(b []byte) {
+	s.stripped[s.line] = true
+	for _, c := range b {
+		switch {
+		case c == '\n':
+			s.out = append(s.out, '\n')
+			s.line++
+			s.stripped[s.line] = true
+		case s.mask:
+			s.out = append(s.out, ' ')
+		}
+	}
+}
+
+// literal copies a string (or char, regex) literal to the output.
+// In mask mode only its delimiters are kept: the contents are replaced by spaces.
+func (s *stripper) literal(b []byte) {
+	if !s.mask || len(b) < 2 {
+		s.emit(b)
+		return
+	}
+	s.emit(b[:1])
+	for _, c := range b[1 : len(b)-1] {
+		if c == '\n' {
+			s.out = append(s.out, '\n')
+			s.line++
+		} else {
+			s.out = append(s.out, ' ')
+		}
+	}
+	s.emit(b[len(b)-1:])
+}
+
+// comment handles the comment src[start:end].
+func (s *stripper) comment(start, end int) {
+	if s.mask {
+		s.remove(s.src[start:end])
+		return
+	}
+	keep := s.syntax.isDirective != nil && s.syntax.isDirective(s.src, start, end)
+	if s.keepDoc && s.syntax.isDoc != nil && s.syntax.isDoc(s.src, start, end) {
+		keep = true
+	}
+	if keep {
+		// Comments don't count as code for regex and docstring detection.
+		lastCode := s.lastCode
+		s.emit(s.src[start:end])
+		s.lastCode = lastCode
+		return
+	}
+	s.remove(s.src[start:end])
+}
+
+// matchComment returns the end of the comment starting at i, if any.
+func (s *stripper) matchComment(i int) (int, bool) {
+	src := s.src
+	for _, bc := range s.syntax.blockComments {
+		if !bytes.HasPrefix(src[i:], []byte(bc.open)) {
+			continue
+		}
+		depth := 1
+		for j := i + len(bc.open); j < len(src); j++ {
+			switch {
+			case s.syntax.nestedBlocks && bytes.HasPrefix(src[j:], []byte(bc.open)):
+				depth++
+				j += len(bc.open) - 1
+			case bytes.HasPrefix(src[j:], []byte(bc.close)):
+				depth--
+				j += len(bc.close) - 1
+				if depth == 0 {
+					return j + 1, true
+				}
+			}
+		}
+		return len(src), true
+	}
+
+	for _, lc := range s.syntax.lineComments {
+		if !bytes.HasPrefix(src[i:], []byte(lc)) {
+			continue
+		}
+		if s.syntax.tokenComments && i > 0 && !strings.ContainsRune(" \t\n;|&(", rune(src[i-1])) {
+			continue
+		}
+		if end := bytes.IndexByte(src[i:], '\n'); end >= 0 {
+			return i + end, true
+		}
+		return len(src), true
+	}
+	return 0, false
+}
+
+// matchString returns the end of the string literal starting at i, if any.
+func (s *stripper) matchString(i int) (int, bool) {
+	src := s.src
+	for _, sl := range s.syntax.strings {
+		if !bytes.HasPrefix(src[i:], []byte(sl.open)) {
+			continue
+		}
+		// Prefixed literals (r"...") must not be the end of an identifier (bar"...").
+		if isIdentByte(sl.open[0]) && i > 0 && isIdentByte(src[i-1]) {
+			continue
+		}
+		if s.syntax.tokenStrings && i > 0 && !strings.ContainsRune(" \t\n:[{,-", rune(src[i-1])) {
+			continue
+		}
+
+		for j := i + len(sl.open); j < len(src); j++ {
+			switch {
+			case sl.escape && src[j] == '\\':
+				j++
+			case sl.singleLine && src[j] == '\n':
+				return j, true
+			case bytes.HasPrefix(src[j:], []byte(sl.close)):
+				if sl.doubled && bytes.HasPrefix(src[j+len(sl.close):], []byte(sl.close)) {
+					j += 2*len(sl.close) - 1
+					continue
+				}
+				return j + len(sl.close), true
+			}
+		}
+		return len(src), true
+	}
+	return 0, false
+}
+
+// matchLiteral returns the end of a Rust char literal or a JS regex literal starting at i, if any.
+func (s *stripper) matchLiteral(i int) (int, bool) {
+	src := s.src
+	switch {
+	case s.syntax.charLiterals && src[i] == '\'' && i+1 < len(src):
+		if src[i+1] == '\\' {
+			if end := bytes.IndexByte(src[i+2:], '\''); end >= 0 && end < 10 {
+				return i + 2 + end + 1, true
+			}
+			return 0, false
+		}
+		_, size := utf8.DecodeRune(src[i+1:])
+		if i+1+size < len(src) && src[i+1+size] == '\'' {
+			return i + 1 + size + 1, true
+		}
+	case s.syntax.regexLiterals && src[i] == '/' && s.regexAllowed():
+		inClass := false
+		for j := i + 1; j < len(src); j++ {
+			switch src[j] {
+			case '\\':
+				j++
+			case '[':
+				inClass = true
+			case ']':
+				inClass = false
+			case '/':
+				if !inClass {
+					return j + 1, true
+				}
+			case '\n':
+				return 0, false
+			}
+		}
+	}
+	return 0, false
+}
+
+// regexAllowed reports whether a "/" at the current position starts a regex rather than a division.
+func (s *stripper) regexAllowed() bool {
+	return s.lastCode == 0 || strings.IndexByte("(,=:[!&|?{};+-*%<>~^", s.lastCode) >= 0
+}
+
+// isDocString reports whether the string src[start:end] is a Python docstring:
+// a triple-quoted string alone on its line, opening the module or a class/function body.
+func (s *stripper) isDocString(start, end int) bool {
+	if !bytes.HasPrefix(s.src[start:], []byte(`"""`)) && !bytes.HasPrefix(s.src[start:], []byte(`'''`)) {
+		return false
+	}
+	if s.lastCode != 0 && s.lastCode != ':' {
+		return false
+	}
+	lineStart := bytes.LastIndexByte(s.src[:start], '\n') + 1
+	if len(bytes.TrimSpace(s.src[lineStart:start])) > 0 {
+		return false
+	}
+	rest, _, _ := bytes.Cut(s.src[end:], []byte("\n"))
+	rest = bytes.TrimSpace(rest)
+	return len(rest) == 0 || rest[0] == '#'
+}
+
+// yamlBlockScalarRe matches a YAML line opening a block scalar ("key: |", "- >-").
+var yamlBlockScalarRe = regexp.MustCompile(`(^|[\s:-])[|>][+-]?[0-9]?[+-]?\s*$`)
+
+// checkBlockScalar is called at the end of each YAML line to detect block scalars.
+func (s *stripper) checkBlockScalar() {
+	lineStart := bytes.LastIndexByte(s.out, '\n') + 1
+	line := s.out[lineStart:]
+	if yamlBlockScalarRe.Match(line) {
+		s.scalarIndent = indentOf(line)
+	}
+}
+
+// blockScalarLine returns the end (including the newline) of the line starting at i
+// if it belongs to the current block scalar, i.e. it is blank or more indented.
+func (s *stripper) blockScalarLine(i int) (int, bool) {
+	end := len(s.src)
+	if j := bytes.IndexByte(s.src[i:], '\n'); j >= 0 {
+		end = i + j + 1
+	}
+	line := s.src[i:end]
+	if len(bytes.TrimSpace(line)) > 0 && indentOf(line) <= s.scalarIndent {
+		return 0, false
+	}
+	return end, true
+}
+
+// indentOf returns the number of leading spaces and tabs of the line.
+func indentOf(line []byte) int {
+	return len(line) - len(bytes.TrimLeft(line, " \t"))
+}
+
+// isIdentByte reports whether c can be part of an identifier.
+func isIdentByte(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+// goDeclRe matches the Go lines a doc comment can be attached to: declarations,
+// exported names in groups (struct fields, interface methods, constants) and the package clause.
+var goDeclRe = regexp.MustCompile(`^(func|type|var|const|package)\b|^\(?[A-Z]\w*`)
+
+// goDoc reports whether the comment is (part of) a Go doc comment: a comment group
+// starting its line and directly followed by a declaration.
+func goDoc(src []byte, start, end int) bool {
+	next, ok := lineAfterCommentGroup(src, start, end)
+	return ok && goDeclRe.Match(next)
+}
+
+// goDirective reports whether the comment is a Go directive (//go:build, //go:generate, ...)
+// or the cgo preamble preceding `import "C"`.
+func goDirective(src []byte, start, end int) bool {
+	text := src[start:end]
+	for _, prefix := range []string{"//go:", "// +build", "//line ", "//export ", "//extern "} {
+		if bytes.HasPrefix(text, []byte(prefix)) {
+			return true
+		}
+	}
+	next, ok := lineAfterCommentGroup(src, start, end)
+	return ok && bytes.HasPrefix(next, []byte(`import "C"`))
+}
+
+// lineAfterCommentGroup returns the trimmed line following the group of "//" comments
+// containing src[start:end]. It returns false if the comment doesn't start its line,
+// or if the group is followed by a blank line.
+func lineAfterCommentGroup(src []byte, start, end int) ([]byte, bool) {
+	lineStart := bytes.LastIndexByte(src[:start], '\n') + 1
+	if len(bytes.TrimSpace(src[lineStart:start])) > 0 {
+		return nil, false
+	}
+
+	rest := src[end:]
+	for {
+		_, after, found := bytes.Cut(rest, []byte("\n"))
+		if !found {
+			return nil, false
+		}
+		rest = after
+		line, _, _ := bytes.Cut(rest, []byte("\n"))
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			return nil, false
+		}
+		if !bytes.HasPrefix(line, []byte("//")) {
+			return line, true
+		}
+	}
+}
+
+// cDoc reports whether the comment is a Javadoc/JSDoc/Doxygen doc comment (/** */ or ///).
+func cDoc(src []byte, start, end int) bool {
+	text := src[start:end]
+	return bytes.HasPrefix(text, []byte("/**")) && !bytes.HasPrefix(text, []byte("/**/")) ||
+		bytes.HasPrefix(text, []byte("///"))
+}
+
+// rustDoc reports whether the comment is a Rust doc comment (///, //!, /** */ or /*! */).
+func rustDoc(src []byte, start, end int) bool {
+	text := src[start:end]
+	switch {
+	case bytes.HasPrefix(text, []byte("////")), bytes.HasPrefix(text, []byte("/***")),
+		bytes.HasPrefix(text, []byte("/**/")):
+		return false
+	default:
+		return bytes.HasPrefix(text, []byte("///")) || bytes.HasPrefix(text, []byte("//!")) ||
+			bytes.HasPrefix(text, []byte("/**")) || bytes.HasPrefix(text, []byte("/*!"))
+	}
+}
+
+// shebang reports whether the comment is the "#!" line of a script.
+func shebang(src []byte, start, _ int) bool {
+	return start == 0 && bytes.HasPrefix(src, []byte("#!"))
+}
@@ -0,0 +1,105 @@
+package aictx_test
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/amberpixels/aictx/internal/aictx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStripComments(t *testing.T) {
+	tests := []struct {
+		name     string
+		file     string
+		input    string
+		keepDoc  bool
+		expected string
+	}{
+		{
+			name: "go",
+			file: "main.go",
+			input: "// Copyright header.\n\n//go:build linux\n\n// Package main is documented.\npackage main\n\n" +
+				"func main() { // inline\n\ts := \"// not a comment\" /* block */\n\t_ = `/* raw */`\n}\n",
+			expected: "\n//go:build linux\n\npackage main\n\n" +
+				"func main() {\n\ts := \"// not a comment\"\n\t_ = `/* raw */`\n}\n",
+		},
+		{
+			name:     "go keeps doc comments",
+			file:     "main.go",
+			input:    "// Package main is documented.\npackage main\n\n// helper comment\n\n// F is documented.\nfunc F() {}\n",
+			keepDoc:  true,
+			expected: "// Package main is documented.\npackage main\n\n\n// F is documented.\nfunc F() {}\n",
+		},
+		{
+			name:     "python docstrings and shebang",
+			file:     "main.py",
+			input:    "#!/usr/bin/env python3\n\"\"\"Module doc.\"\"\"\n# comment\ndef f():\n    \"\"\"Doc.\"\"\"\n    return \"# not\"\n",
+			expected: "#!/usr/bin/env python3\ndef f():\n    return \"# not\"\n",
+		},
+		{
+			name:     "typescript regex and template literals",
+			file:     "main.ts",
+			input:    "/** Doc. */\nconst re = /\\/*x/g; // c\nconst t = `// ${a}`;\nconst d = a / b; // div\n",
+			keepDoc:  true,
+			expected: "/** Doc. */\nconst re = /\\/*x/g;\nconst t = `// ${a}`;\nconst d = a / b;\n",
+		},
+		{
+			name:     "rust nested comments and lifetimes",
+			file:     "lib.rs",
+			input:    "/// Doc.\nfn f<'a>(x: &'a str) -> char { /* a /* b */ c */ '\"' }\n",
+			expected: "fn f<'a>(x: &'a str) -> char {  '\"' }\n",
+		},
+		{
+			name:     "shell",
+			file:     "run.sh",
+			input:    "#!/bin/sh\n# comment\necho \"$# args # here\" ${#x} # trailing\n",
+			expected: "#!/bin/sh\necho \"$# args # here\" ${#x}\n",
+		},
+		{
+			name:     "sql",
+			file:     "query.sql",
+			input:    "-- comment\nSELECT 'it''s -- not' /* c */ FROM t; -- trailing\n",
+			expected: "SELECT 'it''s -- not'  FROM t;\n",
+		},
+		{
+			name:     "yaml block scalars",
+			file:     "config.yaml",
+			input:    "# top\nurl: \"http://x#y\" # c\ntext: it's # c\nscript: |\n  # kept\n  run\nnext: 1 # c\n",
+			expected: "url: \"http://x#y\"\ntext: it's\nscript: |\n  # kept\n  run\nnext: 1\n",
+		},
+		{
+			name:     "unknown language is untouched",
+			file:     "notes.txt",
+			input:    "# not stripped\n// neither\n",
+			expected: "# not stripped\n// neither\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, tt.file)
+			require.NoError(t, os.WriteFile(path, []byte(tt.input), 0o600))
+
+			var out bytes.Buffer
+			app := &aictx.App{
+				InputPath:       path,
+				Local:           true,
+				SourceEnabled:   true,
+				SourceThreshold: 1,
+				Raw:             true,
+				StripComments:   true,
+				KeepDocComments: tt.keepDoc,
+				Out:             &out,
+			}
+			require.NoError(t, app.Run(context.Background()))
+			// Raw mode separates files with a blank line.
+			assert.Equal(t, tt.expected+"\n", out.String())
+		})
+	}
+}
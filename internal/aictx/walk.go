@@ -0,0 +1,193 @@
+package aictx
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/go-git/go-billy/v5"
+)
+
+// walkNode is an entry of the input, annotated with the decisions of both modes.
+// The input is walked once, and the trees of tree and source modes are built from the result.
+type walkNode struct {
+	name    string
+	path    string
+	isDir   bool
+	size    int64
+	modTime time.Time
+
+	// inTree and inSource report whether the file is allowed in tree and source mode,
+	// or whether the directory contains such files.
+	inTree, inSource bool
+
+	// oversized is set for files exceeding SourceThreshold.
+	oversized bool
+
+	// mime, isBinary and isLFS are set by classify (for files shown in the tree).
+	mime            string
+	isBinary, isLFS bool
+
+	// children are the entries of a directory allowed in either mode.
+	children []*walkNode
+}
+
+// walk reads the input at root (described by info) in a single traversal: each entry is listed
+// once, with the sizes reported by ReadDir, and decided for both modes as it is visited.
+// Directories without any allowed file are left out.
+func (a *App) walk(ctx context.Context, fsys billy.Filesystem, root string, info os.FileInfo) (*walkNode, error) {
+	// Note: the name is taken from the path, as mounted submodules report "/" as their name.
+	node := &walkNode{
+		name:    filepath.Base(root),
+		path:    root,
+		isDir:   info.IsDir(),
+		size:    info.Size(),
+		modTime: info.ModTime(),
+	}
+	if !node.isDir {
+		a.decide(node)
+		return node, nil
+	}
+	node.size = 0
+	return node, a.walkDir(ctx, fsys, node)
+}
+
+// walkDir reads the entries of the directory node, recursively.
+func (a *App) walkDir(ctx context.Context, fsys billy.Filesystem, node *walkNode) error {
+	// Check for cancellation.
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+	}
+
+	entries, err := fsys.ReadDir(node.path)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		child := &walkNode{
+			name:  entry.Name(),
+			path:  filepath.Join(node.path, entry.Name()),
+			isDir: entry.IsDir(),
+		}
+		if child.isDir {
+			if a.excludesBelow(child.path, false) && a.excludesBelow(child.path, true) {
+				// Nothing below is allowed (e.g. .git or node_modules): don't read it.
+				continue
+			}
+			if err := a.walkDir(ctx, fsys, child); err != nil {
+				return err
+			}
+		} else {
+			child.size, child.modTime = entry.Size(), entry.ModTime()
+			if entry.Mode()&os.ModeSymlink != 0 {
+				if a.realRoot != "" && !resolvesWithin(a.realRoot, child.path) {
+					// Don't follow symlinks out of the served directory.
+					continue
+				}
+				// Symlinks are listed with their own size: use the size of their target.
+				info, err := fsys.Stat(child.path)
+				if err != nil {
+					return err
+				}
+				child.size, child.modTime = info.Size(), info.ModTime()
+			}
+			a.decide(child)
+		}
+
+		if child.inTree || child.inSource {
+			node.children = append(node.children, child)
+			node.inTree = node.inTree || child.inTree
+			node.inSource = node.inSource || child.inSource
+		}
+	}
+	return nil
+}
+
+// decide sets the decisions of both modes for a file.
+func (a *App) decide(node *walkNode) {
+	node.inTree = a.isAllowed(node.path, false)
+	node.inSource = a.isAllowed(node.path, true) && !a.skipOversized(node.size)
+	node.oversized = exceedsThreshold(node.size, a.SourceThreshold)
+}
+
+// files returns the files of the walked tree allowed in the given mode, in tree order.
+func (node *walkNode) files(sourceMode bool) []*walkNode {
+	var files []*walkNode
+	var visit func(n *walkNode)
+	visit = func(n *walkNode) {
+		if !n.allowed(sourceMode) {
+			return
+		}
+		if !n.isDir {
+			files = append(files, n)
+			return
+		}
+		for _, child := range n.children {
+			visit(child)
+		}
+	}
+	visit(node)
+	return files
+}
+
+// allowed returns the decision of the given mode.
+func (node *walkNode) allowed(sourceMode bool) bool {
+	if sourceMode {
+		return node.inSource
+	}
+	return node.inTree
+}
+
+// tree builds the TreeNode tree of the entries allowed in the given mode.
+// It returns nil if no entry is allowed.
+func (node *walkNode) tree(sourceMode bool) *TreeNode {
+	if !node.allowed(sourceMode) {
+		return nil
+	}
+	t := &TreeNode{
+		Name:     node.name,
+		Path:     node.path,
+		IsDir:    node.isDir,
+		Size:     node.size,
+		ModTime:  node.modTime,
+		IsBinary: node.isBinary,
+		IsLFS:    node.isLFS,
+		MIME:     node.mime,
+	}
+	if sourceMode {
+		t.Oversized = node.oversized
+	}
+	for _, child := range node.children {
+		if c := child.tree(sourceMode); c != nil {
+			t.Children = append(t.Children, c)
+		}
+	}
+	return t
+}
+
+// treeRoot builds the TreeNode tree of tree mode. The root directory is kept even if empty.
+func (node *walkNode) treeRoot() *TreeNode {
+	if t := node.tree(false); t != nil {
+		return t
+	}
+	return &TreeNode{Name: node.name, Path: node.path, IsDir: node.isDir}
+}
+
+// classify sniffs the first bytes of the files shown in the tree concurrently (see Jobs)
+// to detect their MIME type and mark binary files and LFS pointers.
+func (a *App) classify(ctx context.Context, fsys billy.Filesystem, root *walkNode) error {
+	return forEachOrdered(ctx, a.jobs(), root.files(false),
+		func(_ context.Context, node *walkNode) error {
+			ct, err := sniffFile(fsys, node.path, node.size)
+			if err != nil {
+				return err
+			}
+			node.mime, node.isBinary, node.isLFS = ct.mime, ct.binary, ct.lfs
+			return nil
+		},
+		func(_ int, _ *walkNode, err error) error { return err },
+	)
+}
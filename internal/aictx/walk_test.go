@@ -0,0 +1,129 @@
+package aictx_test
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/amberpixels/aictx/internal/aictx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// makeDeepTree creates a binary tree of directories of the given depth, with a Go file
+// and a text file in each directory.
+func makeDeepTree(tb testing.TB, dir string, depth int) {
+	tb.Helper()
+	require.NoError(tb, os.MkdirAll(dir, 0o700))
+	require.NoError(tb, os.WriteFile(filepath.Join(dir, "main.go"), []byte("package main\n"), 0o600))
+	require.NoError(tb, os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("notes\n"), 0o600))
+	if depth == 0 {
+		return
+	}
+	for i := range 2 {
+		makeDeepTree(tb, filepath.Join(dir, "dir"+strconv.Itoa(i)), depth-1)
+	}
+}
+
+func TestWalkMatchesOneByOne(t *testing.T) {
+	dir := t.TempDir()
+	files := []string{
+		".gitignore",
+		".git/config",
+		".git/objects/ab/cdef",
+		"main.go",
+		"sub/.cache/hidden.txt",
+		"sub/main_test.go",
+		"node_modules/pkg/index.js",
+		"build/out.bin",
+		"dist/app.js",
+		"gen.go/readme.txt",
+		"rootonly/a.txt",
+		"rootonly.txt",
+		"__pycache__/m.pyc",
+	}
+	for _, name := range files {
+		require.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0o700))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte("build\n"), 0o600))
+	}
+
+	// Relative paths are hidden or not differently, e.g. ".git/config".
+	t.Chdir(dir)
+	for _, root := range []string{dir, "."} {
+		for _, app := range []*aictx.App{
+			{Exclude: "dist/**,*.go,/rootonly"},
+			{Include: "*.go,*.txt", SourceExclude: "sub"},
+			{TreeShowHidden: true, NoGitIgnore: true, Exclude: "objects"},
+			{NoCoreIgnores: true, TreeExclude: "node_modules"},
+		} {
+			app.InputPath, app.Local, app.SourceThreshold = root, true, 1
+			reference := *app
+			tree, source, err := app.WalkFiles(context.Background())
+			require.NoError(t, err)
+			expectedTree, expectedSource, err := reference.WalkFilesOneByOne(context.Background())
+			require.NoError(t, err)
+			assert.Equal(t, expectedTree, tree)
+			assert.Equal(t, expectedSource, source)
+		}
+	}
+}
+
+// BenchmarkWalk compares the walk with deciding every file of the input one by one,
+// on a tree with a large ignored directory.
+func BenchmarkWalk(b *testing.B) {
+	dir := b.TempDir()
+	makeDeepTree(b, dir, 6)
+	makeDeepTree(b, filepath.Join(dir, ".git"), 10)
+	makeDeepTree(b, filepath.Join(dir, "build"), 10)
+	require.NoError(b, os.WriteFile(filepath.Join(dir, ".gitignore"), []byte("build\n"), 0o600))
+	b.Chdir(dir)
+
+	newApp := func() *aictx.App {
+		return &aictx.App{InputPath: ".", Local: true, SourceThreshold: 1}
+	}
+	b.Run("walk", func(b *testing.B) {
+		for range b.N {
+			_, _, err := newApp().WalkFiles(context.Background())
+			require.NoError(b, err)
+		}
+	})
+	b.Run("one-by-one", func(b *testing.B) {
+		for range b.N {
+			_, _, err := newApp().WalkFilesOneByOne(context.Background())
+			require.NoError(b, err)
+		}
+	})
+}
+
+func BenchmarkWalkDeepTree(b *testing.B) {
+	dir := b.TempDir()
+	makeDeepTree(b, dir, 10)
+
+	for _, bc := range []struct {
+		name    string
+		include string
+	}{
+		{name: "all", include: ""},
+		{name: "go", include: "*.go"},
+		{name: "none", include: "*.rs"},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			for range b.N {
+				app := &aictx.App{
+					InputPath:       dir,
+					Local:           true,
+					TreeEnabled:     true,
+					SourceEnabled:   true,
+					SourceThreshold: 1,
+					Include:         bc.include,
+					NoRedactSecrets: true,
+					Out:             io.Discard,
+				}
+				require.NoError(b, app.Run(context.Background()))
+			}
+		})
+	}
+}
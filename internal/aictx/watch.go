@@ -0,0 +1,183 @@
+package aictx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// outputTempSuffix is the suffix (a pattern of os.CreateTemp) of the temporary files
+// the output file is written to before being replaced.
+const outputTempSuffix = ".tmp*"
+
+// Watch runs the app, then runs it again each time files under the (local) input directory
+// change, until ctx is canceled. Events are debounced: a run starts once no change was seen
+// for the debounce duration. Changes to files excluded from both modes (ignored, hidden or
+// the output file itself) are ignored. The output file (OutFilename, if set) is replaced
+// atomically, so readers never see a partial output.
+func (a *App) Watch(ctx context.Context, debounce time.Duration) error {
+	// Run changes the app (input path, patterns, state): each run starts from the original.
+	config := *a
+
+	app, err := config.regenerate(ctx)
+	if err != nil {
+		return err
+	}
+	if !app.Local || app.Rev != "" {
+		return errors.New("watch mode needs a local directory (without --rev)")
+	}
+	if info, err := os.Stat(app.InputPath); err != nil || !info.IsDir() {
+		return fmt.Errorf("watch mode needs a local directory, got %q", app.InputPath)
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+	if _, err := app.watchDirs(watcher, app.InputPath); err != nil {
+		return fmt.Errorf("error watching %s: %w", app.InputPath, err)
+	}
+	a.logger().Infof("Watching %s for changes", app.InputPath)
+
+	timer := time.NewTimer(debounce)
+	timer.Stop()
+	var changes int
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			a.logger().Warnf("Watch error: %s", err)
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if app.triggers(watcher, event) {
+				changes++
+				timer.Reset(debounce)
+			}
+		case <-timer.C:
+			start := time.Now()
+			next, err := config.regenerate(ctx)
+			if ctx.Err() != nil {
+				return nil
+			}
+			if err != nil {
+				a.logger().Errorf("Regeneration failed after %d change(s): %s", changes, err)
+			} else {
+				app = next
+				a.logger().Info(app.regenerationSummary(changes, time.Since(start)))
+			}
+			changes = 0
+		}
+	}
+}
+
+// regenerate runs a copy of the app. The output file, if any, is written to a temporary file
+// first, then renamed. Secrets found with FailOnSecrets are reported, but the output is kept.
+func (a *App) regenerate(ctx context.Context) (*App, error) {
+	app := *a
+	if app.OutFilename == "" {
+		return &app, app.ignoreSecretsFound(app.Run(ctx))
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(app.OutFilename), filepath.Base(app.OutFilename)+outputTempSuffix)
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	app.Out = tmp
+	if err := app.ignoreSecretsFound(app.Run(ctx)); err != nil {
+		tmp.Close()
+		return nil, err
+	}
+	if err := tmp.Close(); err != nil {
+		return nil, err
+	}
+	return &app, os.Rename(tmp.Name(), app.OutFilename)
+}
+
+// ignoreSecretsFound logs ErrSecretsFound instead of returning it: in watch mode, it must not
+// stop the regenerations.
+func (a *App) ignoreSecretsFound(err error) error {
+	if errors.Is(err, ErrSecretsFound) {
+		a.logger().Warn(err)
+		return nil
+	}
+	return err
+}
+
+// regenerationSummary returns the line logged after a regeneration.
+func (a *App) regenerationSummary(changes int, elapsed time.Duration) string {
+	dest := "stdout"
+	if a.OutFilename != "" {
+		dest = a.OutFilename
+		if info, err := os.Stat(a.OutFilename); err == nil {
+			dest += " (" + formatSize(info.Size()) + ")"
+		}
+	}
+	return fmt.Sprintf("Regenerated %s after %d change(s) in %s", dest, changes, elapsed.Round(time.Millisecond))
+}
+
+// watchDirs watches the directory at root and its subdirectories, except the excluded ones.
+// It returns the number of files allowed in either mode found under root.
+func (a *App) watchDirs(watcher *fsnotify.Watcher, root string) (int, error) {
+	var files int
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		switch {
+		case err != nil:
+			return err
+		case !d.IsDir():
+			if a.isWatched(path) {
+				files++
+			}
+			return nil
+		case path != root && a.isExcludedDir(path):
+			return filepath.SkipDir
+		}
+		return watcher.Add(path)
+	})
+	return files, err
+}
+
+// triggers reports whether the event changes the output: it is on a file allowed in either mode,
+// or it creates a directory containing such files (which is watched from then on).
+func (a *App) triggers(watcher *fsnotify.Watcher, event fsnotify.Event) bool {
+	if event.Op == fsnotify.Chmod {
+		return false
+	}
+	path := filepath.Clean(event.Name)
+	if event.Has(fsnotify.Create) {
+		if info, err := os.Stat(path); err == nil && info.IsDir() {
+			if a.isExcludedDir(path) {
+				return false
+			}
+			files, err := a.watchDirs(watcher, path)
+			if err != nil {
+				a.logger().Warnf("Error watching %s: %s", path, err)
+			}
+			return files > 0
+		}
+	}
+	return a.isWatched(path)
+}
+
+// isWatched reports whether the file is allowed in either enabled mode.
+func (a *App) isWatched(path string) bool {
+	return a.TreeEnabled && a.isAllowed(path, false) || a.SourceEnabled && a.isAllowed(path, true)
+}
+
+// isExcludedDir reports whether all the files below the directory are excluded from both enabled modes.
+func (a *App) isExcludedDir(path string) bool {
+	return (!a.TreeEnabled || a.excludesBelow(path, false)) && (!a.SourceEnabled || a.excludesBelow(path, true))
+}
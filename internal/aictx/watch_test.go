@@ -0,0 +1,67 @@
+package aictx_test
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/amberpixels/aictx/internal/aictx"
+	"github.com/charmbracelet/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWatch(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) {
+		require.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0o700))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600))
+	}
+	write(".gitignore", "ignored\n")
+	write("a.go", "package a\n")
+
+	out := filepath.Join(dir, "output.txt")
+	app := &aictx.App{
+		Lgr:             log.New(io.Discard),
+		InputPath:       dir,
+		Local:           true,
+		TreeEnabled:     true,
+		SourceEnabled:   true,
+		SourceThreshold: 1,
+		OutFilename:     out,
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- app.Watch(ctx, 20*time.Millisecond) }()
+	defer func() {
+		cancel()
+		require.NoError(t, <-done)
+	}()
+
+	output := func() string {
+		data, _ := os.ReadFile(out)
+		return string(data)
+	}
+	require.Eventually(t, func() bool { return output() != "" }, 5*time.Second, 10*time.Millisecond)
+	assert.Contains(t, output(), "package a")
+
+	// New files, in new directories too, are picked up.
+	time.Sleep(100 * time.Millisecond) // Let the watches be set up.
+	write("sub/b.go", "package b\n")
+	require.Eventually(t, func() bool { return strings.Contains(output(), "package b") },
+		5*time.Second, 10*time.Millisecond)
+
+	// Ignored files don't trigger a regeneration, nor does the output file itself.
+	info, err := os.Stat(out)
+	require.NoError(t, err)
+	write("ignored/c.go", "package c\n")
+	time.Sleep(300 * time.Millisecond)
+	after, err := os.Stat(out)
+	require.NoError(t, err)
+	assert.Equal(t, info.ModTime(), after.ModTime())
+	assert.NotContains(t, output(), "package c")
+}